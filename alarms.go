@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// alarmEvaluationWindow is how long a metric alarm has to look at its metric before it can go into
+// ALARM, the period times the evaluation periods. Metric math alarms take their period from the
+// metric that returns data.
+func alarmEvaluationWindow(alarm *cloudwatch.MetricAlarm) time.Duration {
+	period := aws.Int64Value(alarm.Period)
+	for _, metric := range alarm.Metrics {
+		if aws.BoolValue(metric.ReturnData) && metric.MetricStat != nil {
+			period = aws.Int64Value(metric.MetricStat.Period)
+		}
+	}
+	return time.Second * time.Duration(period*aws.Int64Value(alarm.EvaluationPeriods))
+}
+
+// warnShortBake warns when the bake period is shorter than the slowest of the alarms can go into
+// ALARM. Such a bake passes before the alarm can say anything about the new version.
+func warnShortBake(ctx context.Context, cloudwatchSession *cloudwatch.CloudWatch, alarmNames []*string, period time.Duration) error {
+	output, err := cloudwatchSession.DescribeAlarmsWithContext(ctx, &cloudwatch.DescribeAlarmsInput{AlarmNames: alarmNames})
+	if err != nil {
+		return err
+	}
+	slowest := time.Duration(0)
+	slowestName := ""
+	for _, alarm := range output.MetricAlarms {
+		if window := alarmEvaluationWindow(alarm); window > slowest {
+			slowest = window
+			slowestName = aws.StringValue(alarm.AlarmName)
+		}
+	}
+	if period < slowest {
+		logger.warnf("the bake period of %s is shorter than the %s that alarm %s needs to evaluate, it may not go into ALARM before the bake ends. Bake for at least %s.", period, slowest, slowestName, slowest)
+	}
+	return nil
+}
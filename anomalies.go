@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Thresholds for the anomaly heuristics. They are deliberately loose, the findings are only reported.
+const (
+	churnFactor             = 2
+	registrationCycles      = 3
+	runningDirectionChanges = 3
+)
+
+var (
+	startedTasksPattern      = regexp.MustCompile(`has started (\d+) tasks`)
+	stoppedTasksPattern      = regexp.MustCompile(`has stopped (\d+) running tasks`)
+	registeredTargetsPattern = regexp.MustCompile(`\bregistered (\d+) targets`)
+	deregisteredPattern      = regexp.MustCompile(`deregistered (\d+) targets`)
+)
+
+// anomalyObservations is what we have seen of the service while waiting.
+type anomalyObservations struct {
+	seenEvents      map[string]bool
+	runningCounts   []int64
+	maxDesired      int64
+	startedTasks    int64
+	stoppedTasks    int64
+	registrations   int
+	deregistrations int
+}
+
+// observeAnomalies keeps track of the service behaviour each time it is described.
+func (sh *serviceHandler) observeAnomalies() {
+	observed := &sh.anomalies
+	if observed.seenEvents == nil {
+		observed.seenEvents = map[string]bool{}
+	}
+
+	running := aws.Int64Value(sh.currentOutput.RunningCount)
+	if last := len(observed.runningCounts) - 1; last < 0 || observed.runningCounts[last] != running {
+		observed.runningCounts = append(observed.runningCounts, running)
+	}
+	if desired := aws.Int64Value(sh.currentOutput.DesiredCount); desired > observed.maxDesired {
+		observed.maxDesired = desired
+	}
+
+	for _, event := range sh.currentOutput.Events {
+		id := aws.StringValue(event.Id)
+		if observed.seenEvents[id] || aws.TimeValue(event.CreatedAt).Before(sh.started) {
+			continue
+		}
+		observed.seenEvents[id] = true
+
+		message := aws.StringValue(event.Message)
+		observed.startedTasks += matchedCount(startedTasksPattern, message)
+		observed.stoppedTasks += matchedCount(stoppedTasksPattern, message)
+		if deregisteredPattern.MatchString(message) {
+			observed.deregistrations++
+		} else if registeredTargetsPattern.MatchString(message) {
+			observed.registrations++
+		}
+	}
+}
+
+// matchedCount returns the number captured by the pattern, or 0 when it does not match.
+func matchedCount(pattern *regexp.Regexp, message string) int64 {
+	match := pattern.FindStringSubmatch(message)
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.ParseInt(match[1], 10, 64)
+	return count
+}
+
+// anomalyFindings describes anything unusual seen while waiting. A deployment can succeed
+// and still have findings, they are worth a look before the next deployment.
+func (sh *serviceHandler) anomalyFindings() []string {
+	observed := sh.anomalies
+	findings := []string{}
+
+	if observed.maxDesired > 0 && observed.startedTasks > churnFactor*observed.maxDesired {
+		findings = append(findings, fmt.Sprintf("abnormal task churn, %d tasks started and %d stopped for a desired count of %d", observed.startedTasks, observed.stoppedTasks, observed.maxDesired))
+	}
+
+	if observed.registrations >= registrationCycles && observed.deregistrations >= registrationCycles {
+		findings = append(findings, fmt.Sprintf("targets were registered %d times and deregistered %d times", observed.registrations, observed.deregistrations))
+	}
+
+	changes := 0
+	for i := 2; i < len(observed.runningCounts); i++ {
+		before := observed.runningCounts[i-1] - observed.runningCounts[i-2]
+		after := observed.runningCounts[i] - observed.runningCounts[i-1]
+		if (before > 0) != (after > 0) {
+			changes++
+		}
+	}
+	if changes >= runningDirectionChanges {
+		counts := []string{}
+		for _, count := range observed.runningCounts {
+			counts = append(counts, strconv.FormatInt(count, 10))
+		}
+		findings = append(findings, fmt.Sprintf("running count changed direction %d times: %s", changes, strings.Join(counts, ", ")))
+	}
+
+	return findings
+}
+
+// printAnomalies prints the anomaly findings, if there are any.
+func (sh *serviceHandler) printAnomalies() {
+	findings := sh.anomalyFindings()
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Println("Anomalies seen while waiting:")
+	for _, finding := range findings {
+		fmt.Printf("  %s\n", finding)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/apprunner"
+)
+
+// appRunnerHandler waits for the latest operation on an App Runner service, normally a deployment, to finish.
+type appRunnerHandler struct {
+	ctx           context.Context
+	session       *apprunner.AppRunner
+	serviceArn    *string
+	checkInterval int
+	checkTimeout  int
+}
+
+func newAppRunnerHandler(ctx context.Context, awsSession *session.Session, serviceArn string, checkInterval, checkTimeout int) *appRunnerHandler {
+	return &appRunnerHandler{
+		ctx:           ctx,
+		session:       apprunner.New(awsSession),
+		serviceArn:    aws.String(serviceArn),
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+	}
+}
+
+// latestOperation returns the most recent operation on the service. They are listed newest first.
+func (ah *appRunnerHandler) latestOperation() (*apprunner.OperationSummary, error) {
+	output, err := ah.session.ListOperationsWithContext(ah.ctx, &apprunner.ListOperationsInput{
+		ServiceArn: ah.serviceArn,
+		MaxResults: aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.OperationSummaryList) == 0 {
+		return nil, fmt.Errorf("no operations found for the service")
+	}
+	return output.OperationSummaryList[0], nil
+}
+
+// waitForOperation waits for the latest operation to succeed. Failed and rolled back operations fail straight away.
+func (ah *appRunnerHandler) waitForOperation() error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(ah.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(ah.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	var progress progressLine
+	for {
+		operation, err := ah.latestOperation()
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(operation.Status)
+		switch status {
+		case apprunner.OperationStatusSucceeded:
+			logger.infof("Operation %s %s is %s.", aws.StringValue(operation.Type), aws.StringValue(operation.Id), status)
+			return nil
+		case apprunner.OperationStatusFailed, apprunner.OperationStatusRollbackInProgress, apprunner.OperationStatusRollbackFailed, apprunner.OperationStatusRollbackSucceeded:
+			return fmt.Errorf("operation %s %s is %s", aws.StringValue(operation.Type), aws.StringValue(operation.Id), status)
+		}
+		progress.logf(logger, status, "Waiting another %d seconds for operation %s %s, currently %s.", ah.checkInterval, aws.StringValue(operation.Type), aws.StringValue(operation.Id), status)
+
+		select {
+		case <-checkTimer.C:
+		case <-ah.ctx.Done():
+			return ah.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for operation %s", aws.StringValue(operation.Id))
+		}
+	}
+}
+
+// checkServiceRunning makes sure the service is RUNNING after the operation.
+func (ah *appRunnerHandler) checkServiceRunning() error {
+	output, err := ah.session.DescribeServiceWithContext(ah.ctx, &apprunner.DescribeServiceInput{ServiceArn: ah.serviceArn})
+	if err != nil {
+		return err
+	}
+	status := aws.StringValue(output.Service.Status)
+	if status != apprunner.ServiceStatusRunning {
+		return fmt.Errorf("service %s is %s", aws.StringValue(output.Service.ServiceName), status)
+	}
+	logger.infof("Service %s is %s at %s.", aws.StringValue(output.Service.ServiceName), status, aws.StringValue(output.Service.ServiceUrl))
+	return nil
+}
+
+// verifyAppRunnerService is -platform apprunner, -service is the App Runner service ARN.
+func verifyAppRunnerService(ctx context.Context, awsSession *session.Session) {
+	started := time.Now()
+	appRunner := newAppRunnerHandler(ctx, awsSession, *flagServiceName, *flagCheckInterval, *flagTimeout)
+
+	logger.infof("Waiting for the latest App Runner operation.")
+	if err := appRunner.waitForOperation(); err != nil {
+		logger.errorf("The App Runner operation did not succeed. Error: %s", err)
+		exitWithResult(*flagServiceName, started, "failed", 1)
+	}
+	if err := appRunner.checkServiceRunning(); err != nil {
+		logger.errorf("The App Runner service is not running. Error: %s", err)
+		exitWithResult(*flagServiceName, started, "failed", 1)
+	}
+	logger.infof("Service looks good.")
+	exitWithResult(*flagServiceName, started, "success", 0)
+}
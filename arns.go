@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// ecsResource is what an ECS ARN points to. Service and task ARNs in the old format have no
+// cluster, they are in the cluster named default unless -cluster says otherwise.
+type ecsResource struct {
+	arn     string
+	region  string
+	account string
+	kind    string
+	cluster string
+	name    string
+}
+
+// parseEcsArn parses a cluster, service or task ARN like
+// arn:aws:ecs:eu-west-1:123456789012:service/production/web.
+func parseEcsArn(value string) (ecsResource, error) {
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return ecsResource{}, err
+	}
+	if parsed.Service != "ecs" {
+		return ecsResource{}, fmt.Errorf("%s is not an ECS ARN", value)
+	}
+	resource := ecsResource{arn: value, region: parsed.Region, account: parsed.AccountID}
+	parts := strings.Split(parsed.Resource, "/")
+	resource.kind = parts[0]
+	switch {
+	case resource.kind == "cluster" && len(parts) == 2:
+		resource.name = parts[1]
+	case (resource.kind == "service" || resource.kind == "task") && len(parts) == 2:
+		resource.name = parts[1]
+	case (resource.kind == "service" || resource.kind == "task") && len(parts) == 3:
+		resource.cluster, resource.name = parts[1], parts[2]
+	default:
+		return ecsResource{}, fmt.Errorf("%s is not a cluster, service or task ARN", value)
+	}
+	if resource.name == "" || (len(parts) == 3 && resource.cluster == "") {
+		return ecsResource{}, fmt.Errorf("%s has an empty name", value)
+	}
+	return resource, nil
+}
+
+// applyArnFlags lets -service be a service or task ARN and -cluster a cluster ARN, the way
+// Terraform outputs them, and replaces them with the names in the ARNs. It returns the ARN the
+// region and account come from, which is empty when no ARN was given. The service of a task
+// ARN can only be looked up once there is an AWS session, see taskService.
+func applyArnFlags() (ecsResource, error) {
+	found := ecsResource{}
+	if strings.HasPrefix(*flagClusterName, "arn:") {
+		cluster, err := parseEcsArn(*flagClusterName)
+		if err != nil {
+			return ecsResource{}, fmt.Errorf("bad -cluster ARN. Error: %s", err)
+		}
+		if cluster.kind != "cluster" {
+			return ecsResource{}, fmt.Errorf("-cluster %s is not a cluster ARN", *flagClusterName)
+		}
+		*flagClusterName = cluster.name
+		found = cluster
+	}
+	if !strings.HasPrefix(*flagServiceName, "arn:") {
+		return found, nil
+	}
+
+	service, err := parseEcsArn(*flagServiceName)
+	if err != nil {
+		return ecsResource{}, fmt.Errorf("bad -service ARN. Error: %s", err)
+	}
+	if service.kind != "service" && service.kind != "task" {
+		return ecsResource{}, fmt.Errorf("-service %s is not a service or task ARN", *flagServiceName)
+	}
+	if found.region != "" && (found.region != service.region || found.account != service.account) {
+		return ecsResource{}, fmt.Errorf("the -cluster and -service ARNs are in different regions or accounts")
+	}
+	if service.cluster != "" {
+		if *flagClusterName != "" && *flagClusterName != service.cluster {
+			return ecsResource{}, fmt.Errorf("-service is in cluster %s but -cluster is %s", service.cluster, *flagClusterName)
+		}
+		*flagClusterName = service.cluster
+	}
+	if service.kind == "service" {
+		*flagServiceName = service.name
+	}
+	return service, nil
+}
+
+// taskService returns the name of the service that started the task.
+func taskService(ctx context.Context, client *ecs.ECS, cluster, taskArn string) (string, error) {
+	input := &ecs.DescribeTasksInput{Tasks: []*string{aws.String(taskArn)}}
+	if cluster != "" {
+		input.Cluster = aws.String(cluster)
+	}
+	output, err := client.DescribeTasksWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if len(output.Tasks) == 0 {
+		return "", fmt.Errorf("task %s was not found", taskArn)
+	}
+	group := aws.StringValue(output.Tasks[0].Group)
+	if !strings.HasPrefix(group, "service:") {
+		return "", fmt.Errorf("task %s was not started by a service, its group is %s", taskArn, group)
+	}
+	return strings.TrimPrefix(group, "service:"), nil
+}
+
+// checkArnAccount warns when the AWS credentials are for a different account than the ARN, the
+// service will not be found then.
+func checkArnAccount(ctx context.Context, awsSession *session.Session, account string) {
+	identity, err := sts.New(awsSession).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		logger.debugf("Could not look up the account of the AWS credentials. Error: %s", err)
+		return
+	}
+	if callerAccount := aws.StringValue(identity.Account); callerAccount != account {
+		logger.warnf("the ARN is in account %s but the AWS credentials are for account %s.", account, callerAccount)
+	}
+}
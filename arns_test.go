@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestParseEcsArn(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected ecsResource
+		err      bool
+	}{
+		"cluster": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:cluster/production",
+			expected: ecsResource{
+				region: "eu-west-1", account: "123456789012", kind: "cluster", name: "production",
+			},
+		},
+		"long service": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:service/production/web",
+			expected: ecsResource{
+				region: "eu-west-1", account: "123456789012", kind: "service", cluster: "production", name: "web",
+			},
+		},
+		"short service": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:service/web",
+			expected: ecsResource{
+				region: "eu-west-1", account: "123456789012", kind: "service", name: "web",
+			},
+		},
+		"long task": {
+			value: "arn:aws:ecs:us-east-1:123456789012:task/production/0123456789abcdef0123456789abcdef",
+			expected: ecsResource{
+				region: "us-east-1", account: "123456789012", kind: "task", cluster: "production", name: "0123456789abcdef0123456789abcdef",
+			},
+		},
+		"short task": {
+			value: "arn:aws:ecs:us-east-1:123456789012:task/1f3a5b7c-1234-5678-9abc-def012345678",
+			expected: ecsResource{
+				region: "us-east-1", account: "123456789012", kind: "task", name: "1f3a5b7c-1234-5678-9abc-def012345678",
+			},
+		},
+		"china partition": {
+			value: "arn:aws-cn:ecs:cn-north-1:123456789012:service/production/web",
+			expected: ecsResource{
+				region: "cn-north-1", account: "123456789012", kind: "service", cluster: "production", name: "web",
+			},
+		},
+		"gov cloud partition": {
+			value: "arn:aws-us-gov:ecs:us-gov-west-1:123456789012:cluster/production",
+			expected: ecsResource{
+				region: "us-gov-west-1", account: "123456789012", kind: "cluster", name: "production",
+			},
+		},
+		"extra slash in the resource": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:service/production/web/extra",
+			err:   true,
+		},
+		"cluster with a slash": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:cluster/production/web",
+			err:   true,
+		},
+		"empty name": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:service/production/",
+			err:   true,
+		},
+		"empty cluster": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:service//web",
+			err:   true,
+		},
+		"task definition": {
+			value: "arn:aws:ecs:eu-west-1:123456789012:task-definition/web:3",
+			err:   true,
+		},
+		"other service": {
+			value: "arn:aws:lambda:eu-west-1:123456789012:function:web",
+			err:   true,
+		},
+		"too few sections": {
+			value: "arn:aws:ecs:eu-west-1:service/web",
+			err:   true,
+		},
+		"not an arn": {
+			value: "production/web",
+			err:   true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseEcsArn(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.expected.arn = test.value
+			if got != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
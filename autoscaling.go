@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// autoscalingResourceId is how Application Auto Scaling identifies the service.
+func (sh *serviceHandler) autoscalingResourceId() string {
+	clusterArn := aws.StringValue(sh.currentOutput.ClusterArn)
+	clusterName := clusterArn[strings.LastIndex(clusterArn, "/")+1:]
+	return fmt.Sprintf("service/%s/%s", clusterName, aws.StringValue(sh.currentOutput.ServiceName))
+}
+
+// scalableTarget returns the Application Auto Scaling target for the service desired count.
+// A nil target means the service is not managed by autoscaling.
+func (sh *serviceHandler) scalableTarget() (*applicationautoscaling.ScalableTarget, error) {
+	output, err := sh.autoscalingSession.DescribeScalableTargetsWithContext(sh.ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+		ResourceIds:       []*string{aws.String(sh.autoscalingResourceId())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.ScalableTargets) == 0 {
+		return nil, nil
+	}
+	return output.ScalableTargets[0], nil
+}
+
+// checkAutoscalingBounds compares the desired count with the autoscaling min and max capacity and
+// with what the target tracking policies would scale it to. A desired count outside of the bounds
+// or away from the policy target is changed by autoscaling straight after the deployment.
+// The returned error describes the inconsistency, the caller decides if it is fatal.
+func (sh *serviceHandler) checkAutoscalingBounds() error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+
+	target, err := sh.scalableTarget()
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		sh.log.infof("Service is not managed by Application Auto Scaling.")
+		return nil
+	}
+
+	desired := aws.Int64Value(sh.currentOutput.DesiredCount)
+	min := aws.Int64Value(target.MinCapacity)
+	max := aws.Int64Value(target.MaxCapacity)
+	sh.log.infof("Autoscaling bounds are min: %d, max: %d. Desired count is %d.", min, max, desired)
+
+	if suspended := target.SuspendedState; suspended != nil {
+		if aws.BoolValue(suspended.DynamicScalingInSuspended) || aws.BoolValue(suspended.DynamicScalingOutSuspended) || aws.BoolValue(suspended.ScheduledScalingSuspended) {
+			sh.log.infof("Autoscaling is partially suspended: scale in %t, scale out %t, scheduled %t.",
+				aws.BoolValue(suspended.DynamicScalingInSuspended),
+				aws.BoolValue(suspended.DynamicScalingOutSuspended),
+				aws.BoolValue(suspended.ScheduledScalingSuspended),
+			)
+		}
+	}
+
+	if desired < min || desired > max {
+		return fmt.Errorf("desired count %d is outside of the autoscaling bounds %d-%d and will be changed by autoscaling", desired, min, max)
+	}
+	return sh.checkTargetTracking(target)
+}
+
+// targetTrackingMetrics are the AWS/ECS metrics of the predefined target tracking metric types.
+// Other metrics, like the request count per target, are reported but not compared.
+var targetTrackingMetrics = map[string]string{
+	applicationautoscaling.MetricTypeEcsserviceAverageCpuutilization:    "CPUUtilization",
+	applicationautoscaling.MetricTypeEcsserviceAverageMemoryUtilization: "MemoryUtilization",
+}
+
+// targetTrackingWindow is how far back the current value of a tracked metric is averaged.
+const targetTrackingWindow = 5 * time.Minute
+
+// checkTargetTracking compares the current value of the metric of every target tracking policy
+// with the policy target, and errors when the policy would move the desired count.
+func (sh *serviceHandler) checkTargetTracking(target *applicationautoscaling.ScalableTarget) error {
+	policies := []*applicationautoscaling.ScalingPolicy{}
+	err := sh.autoscalingSession.DescribeScalingPoliciesPagesWithContext(sh.ctx,
+		&applicationautoscaling.DescribeScalingPoliciesInput{
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ResourceId:        aws.String(sh.autoscalingResourceId()),
+		},
+		func(page *applicationautoscaling.DescribeScalingPoliciesOutput, lastPage bool) bool {
+			policies = append(policies, page.ScalingPolicies...)
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	desired := aws.Int64Value(sh.currentOutput.DesiredCount)
+	scaleInSuspended, scaleOutSuspended := false, false
+	if target.SuspendedState != nil {
+		scaleInSuspended = aws.BoolValue(target.SuspendedState.DynamicScalingInSuspended)
+		scaleOutSuspended = aws.BoolValue(target.SuspendedState.DynamicScalingOutSuspended)
+	}
+	problems := []string{}
+	for _, policy := range policies {
+		config := policy.TargetTrackingScalingPolicyConfiguration
+		if aws.StringValue(policy.PolicyType) != applicationautoscaling.PolicyTypeTargetTrackingScaling || config == nil {
+			continue
+		}
+		name := aws.StringValue(policy.PolicyName)
+		targetValue := aws.Float64Value(config.TargetValue)
+		metricName := ""
+		if config.PredefinedMetricSpecification != nil {
+			metricName = targetTrackingMetrics[aws.StringValue(config.PredefinedMetricSpecification.PredefinedMetricType)]
+		}
+		if metricName == "" {
+			sh.log.infof("Target tracking policy %s has a target of %.1f, its metric is not compared.", name, targetValue)
+			continue
+		}
+
+		current, err := sh.averageServiceMetric(metricName, targetTrackingWindow)
+		if err != nil {
+			return err
+		}
+		if current < 0 {
+			sh.log.warnf("no %s data found for target tracking policy %s", metricName, name)
+			continue
+		}
+		expected := targetTrackingCount(desired, current, targetValue, aws.Int64Value(target.MinCapacity), aws.Int64Value(target.MaxCapacity))
+		sh.log.infof("Target tracking policy %s keeps %s at %.1f, it is at %.1f. That needs a desired count of about %d.", name, metricName, targetValue, current, expected)
+		scaleIn := expected < desired && !aws.BoolValue(config.DisableScaleIn) && !scaleInSuspended
+		scaleOut := expected > desired && !scaleOutSuspended
+		if scaleIn || scaleOut {
+			problems = append(problems, fmt.Sprintf("policy %s will change the desired count from %d to about %d", name, desired, expected))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("desired count is away from the autoscaling target: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// targetTrackingCount estimates the desired count that a target tracking policy moves to, given
+// the current and target values of its metric. The metric is assumed to scale with the count.
+func targetTrackingCount(desired int64, current, target float64, min, max int64) int64 {
+	expected := desired
+	if target > 0 && desired > 0 {
+		expected = int64(math.Ceil(float64(desired) * current / target))
+	}
+	if expected < min {
+		expected = min
+	}
+	if expected > max {
+		expected = max
+	}
+	return expected
+}
+
+// averageServiceMetric averages an AWS/ECS metric of the service over the window.
+// -1 is returned when there is no data.
+func (sh *serviceHandler) averageServiceMetric(metricName string, window time.Duration) (float64, error) {
+	clusterArn := aws.StringValue(sh.currentOutput.ClusterArn)
+	output, err := sh.cloudwatchSession.GetMetricStatisticsWithContext(sh.ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/ECS"),
+		MetricName: aws.String(metricName),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String(clusterArn[strings.LastIndex(clusterArn, "/")+1:])},
+			{Name: aws.String("ServiceName"), Value: sh.currentOutput.ServiceName},
+		},
+		StartTime:  aws.Time(time.Now().Add(-window)),
+		EndTime:    aws.Time(time.Now()),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticAverage)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(output.Datapoints) == 0 {
+		return -1, nil
+	}
+	sum := 0.0
+	for _, point := range output.Datapoints {
+		sum += aws.Float64Value(point.Average)
+	}
+	return sum / float64(len(output.Datapoints)), nil
+}
+
+// printScalingActivitiesSince prints the autoscaling activities of the service that started after
+// the given time. Activities that are in reported are skipped, new ones are added to it.
+func (sh *serviceHandler) printScalingActivitiesSince(since time.Time, reported map[string]bool) error {
+	activities := []*applicationautoscaling.ScalingActivity{}
+	err := sh.autoscalingSession.DescribeScalingActivitiesPagesWithContext(sh.ctx,
+		&applicationautoscaling.DescribeScalingActivitiesInput{
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ResourceId:        aws.String(sh.autoscalingResourceId()),
+		},
+		func(page *applicationautoscaling.DescribeScalingActivitiesOutput, lastPage bool) bool {
+			for _, activity := range page.ScalingActivities {
+				if aws.TimeValue(activity.StartTime).Before(since) {
+					// Activities are returned newest first.
+					return false
+				}
+				activities = append(activities, activity)
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := len(activities) - 1; i >= 0; i-- {
+		activity := activities[i]
+		if reported[aws.StringValue(activity.ActivityId)] {
+			continue
+		}
+		reported[aws.StringValue(activity.ActivityId)] = true
+		sh.log.infof("Autoscaling activity at %s (%s): %s",
+			aws.TimeValue(activity.StartTime).Format(time.RFC3339),
+			aws.StringValue(activity.StatusCode),
+			aws.StringValue(activity.Description),
+		)
+		sh.log.debugf("  Cause: %s", aws.StringValue(activity.Cause))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestTargetTrackingCount(t *testing.T) {
+	tests := map[string]struct {
+		desired  int64
+		current  float64
+		target   float64
+		min      int64
+		max      int64
+		expected int64
+	}{
+		"on target": {
+			desired: 4, current: 50, target: 50, min: 1, max: 10,
+			expected: 4,
+		},
+		"over target scales out": {
+			desired: 2, current: 90, target: 50, min: 1, max: 10,
+			expected: 4,
+		},
+		"under target scales in": {
+			desired: 4, current: 20, target: 50, min: 1, max: 10,
+			expected: 2,
+		},
+		"rounds up": {
+			desired: 3, current: 51, target: 50, min: 1, max: 10,
+			expected: 4,
+		},
+		"capped at the max": {
+			desired: 8, current: 100, target: 40, min: 1, max: 10,
+			expected: 10,
+		},
+		"floored at the min": {
+			desired: 4, current: 1, target: 50, min: 2, max: 10,
+			expected: 2,
+		},
+		"no target": {
+			desired: 3, current: 80, target: 0, min: 1, max: 10,
+			expected: 3,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := targetTrackingCount(test.desired, test.current, test.target, test.min, test.max)
+			if got != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// debugAwsRequests prints every AWS API call made through clients of the session once it is done,
+// with how long it took including retries and the request ID. AWS support asks for the request ID,
+// and the retries show when we are being throttled.
+func debugAwsRequests(awsSession *session.Session) {
+	awsSession.Handlers.Complete.PushBack(func(r *request.Request) {
+		result := "OK"
+		if r.Error != nil {
+			result = r.Error.Error()
+			if awsErr, ok := r.Error.(awserr.Error); ok {
+				result = awsErr.Code()
+			}
+		}
+		requestId := r.RequestID
+		if requestId == "" {
+			requestId = "none"
+		}
+		logger.infof("AWS %s %s took %s with %d retries. Request ID: %s. Result: %s",
+			r.ClientInfo.ServiceName,
+			r.Operation.Name,
+			time.Since(r.Time).Round(time.Millisecond),
+			r.RetryCount,
+			requestId,
+			result,
+		)
+	})
+}
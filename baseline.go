@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// minimumBaselineRuns is how many successful runs the history needs before a phase is compared with them.
+const minimumBaselineRuns = 3
+
+// phaseBaselines works out the median time spent in each phase by the successful runs.
+func phaseBaselines(records []historyRecord) map[string]time.Duration {
+	samples := map[string][]time.Duration{}
+	for _, record := range records {
+		if record.Result != "success" {
+			continue
+		}
+		// A phase can show up more than once when there were retries.
+		perRun := map[string]time.Duration{}
+		for _, phase := range record.Phases {
+			perRun[phase.Name] += phase.Duration
+		}
+		for name, duration := range perRun {
+			samples[name] = append(samples[name], duration)
+		}
+	}
+
+	baselines := map[string]time.Duration{}
+	for name, durations := range samples {
+		if len(durations) < minimumBaselineRuns {
+			continue
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		middle := len(durations) / 2
+		if len(durations)%2 == 0 {
+			baselines[name] = (durations[middle-1] + durations[middle]) / 2
+		} else {
+			baselines[name] = durations[middle]
+		}
+	}
+	return baselines
+}
+
+// setBaselines sets the historical phase durations and how many times slower than usual
+// a phase must be before we warn about it. A factor of 0 turns the warnings off.
+func (sh *serviceHandler) setBaselines(baselines map[string]time.Duration, factor float64) {
+	sh.baselines = baselines
+	sh.baselineFactor = factor
+	sh.baselineWarnings = map[string]int{}
+}
+
+// compareWithBaseline warns when the current phase is taking a lot longer than it normally does.
+// The warning is given again for every whole multiple of the usual time after that.
+func (sh *serviceHandler) compareWithBaseline() {
+	baseline, ok := sh.baselines[sh.currentPhase]
+	if !ok || baseline <= 0 || sh.baselineFactor <= 0 {
+		return
+	}
+	elapsed := time.Since(sh.phaseStarted)
+	slower := float64(elapsed) / float64(baseline)
+	if slower < sh.baselineFactor || int(slower) <= sh.baselineWarnings[sh.currentPhase] {
+		return
+	}
+	sh.baselineWarnings[sh.currentPhase] = int(slower)
+	sh.log.warnf("this deploy is %dx slower than usual at the %s phase, %s so far against a median of %s.",
+		int(slower), sh.currentPhase, elapsed.Round(time.Second), baseline.Round(time.Second))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// beanstalkHandler waits for an Elastic Beanstalk environment to be Ready and Green after a deployment.
+type beanstalkHandler struct {
+	ctx             context.Context
+	session         *elasticbeanstalk.ElasticBeanstalk
+	environmentName *string
+	expectedVersion string
+	checkInterval   int
+	checkTimeout    int
+	started         time.Time
+	seenEvents      map[string]bool
+}
+
+func newBeanstalkHandler(ctx context.Context, awsSession *session.Session, environmentName, expectedVersion string, checkInterval, checkTimeout int) *beanstalkHandler {
+	return &beanstalkHandler{
+		ctx:             ctx,
+		session:         elasticbeanstalk.New(awsSession),
+		environmentName: aws.String(environmentName),
+		expectedVersion: expectedVersion,
+		checkInterval:   checkInterval,
+		checkTimeout:    checkTimeout,
+		started:         time.Now(),
+		seenEvents:      map[string]bool{},
+	}
+}
+
+func (bh *beanstalkHandler) describeEnvironment() (*elasticbeanstalk.EnvironmentDescription, error) {
+	output, err := bh.session.DescribeEnvironmentsWithContext(bh.ctx, &elasticbeanstalk.DescribeEnvironmentsInput{
+		EnvironmentNames: []*string{bh.environmentName},
+		IncludeDeleted:   aws.Bool(false),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Environments) == 0 {
+		return nil, fmt.Errorf("environment %s not found", aws.StringValue(bh.environmentName))
+	}
+	return output.Environments[0], nil
+}
+
+// printNewEvents prints the environment events since we started, oldest first.
+func (bh *beanstalkHandler) printNewEvents() error {
+	output, err := bh.session.DescribeEventsWithContext(bh.ctx, &elasticbeanstalk.DescribeEventsInput{
+		EnvironmentName: bh.environmentName,
+		StartTime:       aws.Time(bh.started),
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(output.Events) - 1; i >= 0; i-- {
+		event := output.Events[i]
+		key := aws.TimeValue(event.EventDate).String() + aws.StringValue(event.Message)
+		if bh.seenEvents[key] {
+			continue
+		}
+		bh.seenEvents[key] = true
+		fmt.Printf("%s %s %s\n", aws.TimeValue(event.EventDate).Format(time.RFC3339), aws.StringValue(event.Severity), aws.StringValue(event.Message))
+	}
+	return nil
+}
+
+// waitForReady waits for the environment to be Ready, Green and running the expected version, when there is one.
+func (bh *beanstalkHandler) waitForReady() error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(bh.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(bh.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	var progress progressLine
+	for {
+		if err := bh.printNewEvents(); err != nil {
+			return err
+		}
+		environment, err := bh.describeEnvironment()
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(environment.Status)
+		health := aws.StringValue(environment.Health)
+		version := aws.StringValue(environment.VersionLabel)
+		if status == elasticbeanstalk.EnvironmentStatusTerminating || status == elasticbeanstalk.EnvironmentStatusTerminated {
+			return fmt.Errorf("environment is %s", status)
+		}
+		if status == elasticbeanstalk.EnvironmentStatusReady && health == elasticbeanstalk.EnvironmentHealthGreen && (bh.expectedVersion == "" || version == bh.expectedVersion) {
+			logger.infof("Environment %s is %s and %s with version %s.", aws.StringValue(bh.environmentName), status, health, version)
+			return nil
+		}
+		progress.logf(logger, status+health+version, "Waiting another %d seconds for environment %s, currently %s and %s with version %s.", bh.checkInterval, aws.StringValue(bh.environmentName), status, health, version)
+
+		select {
+		case <-checkTimer.C:
+		case <-bh.ctx.Done():
+			return bh.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for environment %s, it is %s and %s with version %s", aws.StringValue(bh.environmentName), status, health, version)
+		}
+	}
+}
+
+// verifyBeanstalkEnvironment is -platform beanstalk.
+func verifyBeanstalkEnvironment(ctx context.Context, awsSession *session.Session) {
+	started := time.Now()
+	environment := newBeanstalkHandler(ctx, awsSession, *flagEnvironment, *flagExpectVersion, *flagCheckInterval, *flagTimeout)
+
+	logger.infof("Waiting for environment %s to be Ready and Green.", *flagEnvironment)
+	if err := environment.waitForReady(); err != nil {
+		logger.errorf("The environment did not become ready. Error: %s", err)
+		exitWithResult(*flagEnvironment, started, "failed", 1)
+	}
+	logger.infof("Environment looks good.")
+	exitWithResult(*flagEnvironment, started, "success", 0)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// bundleStoppedTasks is how many of the most recently stopped tasks go in the bundle.
+const bundleStoppedTasks = 5
+
+// writeBundle writes the state of the failed service to a zip file of JSON documents that can be
+// attached to an incident ticket. Parts that can't be collected are left out of the bundle and
+// reported, a partial bundle is better than none.
+func (sh *serviceHandler) writeBundle(path string) error {
+	files := map[string]interface{}{
+		"service.json":     sh.currentOutput,
+		"deployments.json": sh.currentOutput.Deployments,
+		"events.json":      sh.currentOutput.Events,
+	}
+
+	stopped, err := sh.recentStoppedTasks(bundleStoppedTasks)
+	if err != nil {
+		sh.log.errorf("There was an error listing the STOPPED tasks for the bundle. Error: %s", err)
+	} else {
+		if redactedTasks, err := sh.redactor.tasks(stopped); err != nil {
+			sh.log.errorf("There was an error redacting the STOPPED tasks for the bundle. Error: %s", err)
+		} else {
+			files["stopped_tasks.json"] = redactedTasks
+		}
+		logs := map[string][]logExcerpt{}
+		for _, task := range stopped {
+			excerpts, err := sh.taskLogExcerpts(task, logExcerptLines)
+			if err != nil {
+				sh.log.errorf("There was an error reading the logs of task %s for the bundle. Error: %s", taskId(aws.StringValue(task.TaskArn)), err)
+				continue
+			}
+			logs[taskId(aws.StringValue(task.TaskArn))] = excerpts
+		}
+		files["logs.json"] = logs
+	}
+
+	targetHealth := map[string][]*elbv2.TargetHealthDescription{}
+	for _, loadBalancer := range sh.currentOutput.LoadBalancers {
+		if loadBalancer.TargetGroupArn == nil {
+			continue
+		}
+		output, err := sh.elbv2Session.DescribeTargetHealthWithContext(sh.ctx, &elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: loadBalancer.TargetGroupArn,
+		})
+		if err != nil {
+			sh.log.errorf("There was an error describing the target health for the bundle. Error: %s", err)
+			continue
+		}
+		targetHealth[aws.StringValue(loadBalancer.TargetGroupArn)] = output.TargetHealthDescriptions
+	}
+	files["target_health.json"] = targetHealth
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	archive := zip.NewWriter(out)
+	for name, content := range files {
+		body, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s. Error: %s", name, err)
+		}
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(body); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// canaryTasksPerSet limits how many tasks of each deployment are compared, which keeps
+// the number of metric queries reasonable for large services.
+const canaryTasksPerSet = 20
+
+// canaryAnalysis compares the Container Insights task metrics of the tasks in the new deployment
+// with the tasks of the old deployments while both are running. It fails if the average of a metric
+// for the new tasks is more than threshold percent higher than for the old tasks.
+// The task level metrics need Container Insights with enhanced observability on the cluster.
+func (sh *serviceHandler) canaryAnalysis(window time.Duration, threshold float64, metrics []string) error {
+	newTasks, oldTasks, err := sh.waitForCanaryTasks()
+	if err != nil {
+		return err
+	}
+	if len(newTasks) == 0 || len(oldTasks) == 0 {
+		sh.log.infof("There are no old and new tasks running side by side, skipping the canary analysis.")
+		return nil
+	}
+	newTasks = limitTasks(newTasks, canaryTasksPerSet)
+	oldTasks = limitTasks(oldTasks, canaryTasksPerSet)
+
+	start := time.Now()
+	sh.log.infof("Comparing %d new tasks with %d old tasks for %s.", len(newTasks), len(oldTasks), window)
+	if err := sleepContext(sh.ctx, window); err != nil {
+		return err
+	}
+
+	clusterArn := aws.StringValue(sh.currentOutput.ClusterArn)
+	clusterName := clusterArn[strings.LastIndex(clusterArn, "/")+1:]
+
+	// Each query is for one metric of one task, remember which set it belongs to.
+	queries := []*cloudwatch.MetricDataQuery{}
+	querySet := map[string]string{}
+	queryMetric := map[string]string{}
+	addQueries := func(set string, tasks []*ecs.Task) {
+		for _, task := range tasks {
+			for _, metric := range metrics {
+				id := fmt.Sprintf("m%d", len(queries))
+				querySet[id] = set
+				queryMetric[id] = metric
+				queries = append(queries, &cloudwatch.MetricDataQuery{
+					Id: aws.String(id),
+					MetricStat: &cloudwatch.MetricStat{
+						Metric: &cloudwatch.Metric{
+							Namespace:  aws.String(containerInsightsNamespace),
+							MetricName: aws.String(metric),
+							Dimensions: []*cloudwatch.Dimension{
+								{Name: aws.String("ClusterName"), Value: aws.String(clusterName)},
+								{Name: aws.String("TaskDefinitionFamily"), Value: aws.String(taskDefinitionFamily(aws.StringValue(task.TaskDefinitionArn)))},
+								{Name: aws.String("TaskId"), Value: aws.String(taskId(aws.StringValue(task.TaskArn)))},
+							},
+						},
+						Period: aws.Int64(60),
+						Stat:   aws.String(cloudwatch.StatisticAverage),
+					},
+				})
+			}
+		}
+	}
+	addQueries("new", newTasks)
+	addQueries("old", oldTasks)
+
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	err = sh.cloudwatchSession.GetMetricDataPagesWithContext(sh.ctx,
+		&cloudwatch.GetMetricDataInput{
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(time.Now()),
+			MetricDataQueries: queries,
+		},
+		func(page *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+			for _, result := range page.MetricDataResults {
+				id := aws.StringValue(result.Id)
+				key := querySet[id] + "/" + queryMetric[id]
+				for _, value := range aws.Float64ValueSlice(result.Values) {
+					sums[key] += value
+					counts[key]++
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	for _, metric := range metrics {
+		if counts["new/"+metric] == 0 || counts["old/"+metric] == 0 {
+			sh.log.warnf("no %s data found for both the old and new tasks, is Container Insights with enhanced observability enabled?", metric)
+			continue
+		}
+		newAverage := sums["new/"+metric] / float64(counts["new/"+metric])
+		oldAverage := sums["old/"+metric] / float64(counts["old/"+metric])
+		sh.log.infof("Average %s is %.2f for the new tasks and %.2f for the old tasks.", metric, newAverage, oldAverage)
+		if newAverage > oldAverage*(1+threshold/100) {
+			problems = append(problems, fmt.Sprintf("%s is %.2f on the new tasks against %.2f on the old tasks", metric, newAverage, oldAverage))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the new tasks regressed by more than %.0f%%: %s", threshold, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// waitForCanaryTasks waits until the PRIMARY deployment has RUNNING tasks and returns them with
+// the RUNNING tasks of the other deployments. No old tasks are returned when the deployment
+// finishes before we get to see both.
+func (sh *serviceHandler) waitForCanaryTasks() ([]*ecs.Task, []*ecs.Task, error) {
+	deadline := time.Now().Add(sh.phaseTimeout(sh.deploymentTimeout))
+	for {
+		if err := sh.refresh(); err != nil {
+			return nil, nil, err
+		}
+		primary := sh.primaryDeployment()
+		if primary == nil {
+			return nil, nil, fmt.Errorf("no PRIMARY deployment found")
+		}
+		if len(sh.currentOutput.Deployments) < 2 {
+			return nil, nil, nil
+		}
+
+		if aws.Int64Value(primary.RunningCount) > 0 {
+			newTasks, err := sh.deploymentTasks(aws.StringValue(primary.Id), ecs.DesiredStatusRunning)
+			if err != nil {
+				return nil, nil, err
+			}
+			oldTasks := []*ecs.Task{}
+			for _, deployment := range sh.currentOutput.Deployments {
+				if deployment == primary {
+					continue
+				}
+				tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+				if err != nil {
+					return nil, nil, err
+				}
+				oldTasks = append(oldTasks, tasks...)
+			}
+			return newTasks, oldTasks, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("timed out waiting for the new deployment to run tasks")
+		}
+		sh.log.debugf("Waiting %d seconds for the new deployment to run tasks.", sh.checkInterval)
+		if err := sleepContext(sh.ctx, time.Second*time.Duration(sh.checkInterval)); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// taskDefinitionFamily is the family part of a task definition ARN.
+func taskDefinitionFamily(taskDefinitionArn string) string {
+	family := taskDefinitionArn[strings.LastIndex(taskDefinitionArn, "/")+1:]
+	if i := strings.LastIndex(family, ":"); i >= 0 {
+		family = family[:i]
+	}
+	return family
+}
+
+func limitTasks(tasks []*ecs.Task, max int) []*ecs.Task {
+	if len(tasks) > max {
+		return tasks[:max]
+	}
+	return tasks
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// serviceListeners returns the listeners of every load balancer the service target groups are attached to.
+func (sh *serviceHandler) serviceListeners() ([]*elbv2.Listener, error) {
+	lbArns, err := sh.serviceLoadBalancerArns()
+	if err != nil {
+		return nil, err
+	}
+	listeners := []*elbv2.Listener{}
+	for _, lbArn := range lbArns {
+		err := sh.elbv2Session.DescribeListenersPagesWithContext(sh.ctx,
+			&elbv2.DescribeListenersInput{LoadBalancerArn: aws.String(lbArn)},
+			func(page *elbv2.DescribeListenersOutput, lastPage bool) bool {
+				listeners = append(listeners, page.Listeners...)
+				return true
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return listeners, nil
+}
+
+// checkCertificateExpiry looks at the certificates of the HTTPS and TLS listeners in front of the
+// service and returns an error listing the ones that expire within the days. A deploy that
+// succeeds behind a certificate about to expire is still an outage waiting to happen.
+func (sh *serviceHandler) checkCertificateExpiry(days int) error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+	listeners, err := sh.serviceListeners()
+	if err != nil {
+		return err
+	}
+
+	acmSession := acm.New(sh.awsSession)
+	limit := time.Now().AddDate(0, 0, days)
+	problems := []string{}
+	for _, listener := range listeners {
+		protocol := aws.StringValue(listener.Protocol)
+		if protocol != elbv2.ProtocolEnumHttps && protocol != elbv2.ProtocolEnumTls {
+			continue
+		}
+		certificates := []*elbv2.Certificate{}
+		// The default certificate and any extra SNI certificates are all listed here.
+		input := &elbv2.DescribeListenerCertificatesInput{ListenerArn: listener.ListenerArn}
+		for {
+			output, err := sh.elbv2Session.DescribeListenerCertificatesWithContext(sh.ctx, input)
+			if err != nil {
+				return err
+			}
+			certificates = append(certificates, output.Certificates...)
+			if aws.StringValue(output.NextMarker) == "" {
+				break
+			}
+			input.Marker = output.NextMarker
+		}
+
+		for _, certificate := range certificates {
+			arn := aws.StringValue(certificate.CertificateArn)
+			if !strings.Contains(arn, ":acm:") {
+				sh.log.debugf("Certificate %s is not in ACM, its expiry can't be checked.", arn)
+				continue
+			}
+			output, err := acmSession.DescribeCertificateWithContext(sh.ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(arn)})
+			if err != nil {
+				return err
+			}
+			notAfter := aws.TimeValue(output.Certificate.NotAfter)
+			sh.log.debugf("Certificate %s for %s on port %d expires at %s.", arn, aws.StringValue(output.Certificate.DomainName), aws.Int64Value(listener.Port), notAfter.Format(time.RFC3339))
+			if notAfter.Before(limit) {
+				problems = append(problems, fmt.Sprintf("certificate %s for %s on port %d expires at %s", arn, aws.StringValue(output.Certificate.DomainName), aws.Int64Value(listener.Port), notAfter.Format(time.RFC3339)))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("certificates expire within %d days:\n  %s", days, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
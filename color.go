@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+	// colorDefault is the default color. It is as long as the others, for the tables.
+	colorDefault = "\033[39m"
+)
+
+// colorOutput is true when the rollout and health states are colored. setupColor turns it on for
+// terminals.
+var colorOutput = false
+
+// setupColor colors the states when stdout is a terminal, unless -no-color or the NO_COLOR
+// environment variable say otherwise. The json log is never colored.
+func setupColor(noColor bool) {
+	colorOutput = !noColor && os.Getenv("NO_COLOR") == "" && !jsonLogs() && isTerminal(os.Stdout)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// stateColor is the color of a rollout, deployment or health state. Green is done and healthy,
+// yellow is still going and red is failed or unhealthy. Only the first word of the state counts,
+// so "IN_PROGRESS (2 deployments)" is yellow.
+func stateColor(state string) string {
+	words := strings.Fields(state)
+	if len(words) == 0 {
+		return ""
+	}
+	switch strings.ToUpper(words[0]) {
+	case "COMPLETED", "STEADY", "HEALTHY", "PRIMARY", "RUNNING":
+		return colorGreen
+	case "IN_PROGRESS", "INITIAL", "DRAINING", "PENDING", "ACTIVE", "UNKNOWN":
+		return colorYellow
+	case "FAILED", "UNHEALTHY", "UNAVAILABLE", "STOPPED", "INACTIVE":
+		return colorRed
+	}
+	return ""
+}
+
+// colorState colors the state for the terminal.
+func colorState(state string) string {
+	color := stateColor(state)
+	if !colorOutput || color == "" {
+		return state
+	}
+	return color + state + colorReset
+}
+
+// colorCell colors text in a table. tabwriter counts the escape sequences towards the width of
+// the column, so every cell of a colored column goes through here, the header too, and gets
+// sequences of the same length.
+func colorCell(text, color string) string {
+	if !colorOutput {
+		return text
+	}
+	if color == "" {
+		color = colorDefault
+	}
+	return color + text + colorReset
+}
+
+// colorStateCell colors the state in a table column, see colorCell.
+func colorStateCell(state string) string {
+	return colorCell(state, stateColor(state))
+}
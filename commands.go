@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// subcommand is a subcommand of the CLI. Each parses its own arguments.
+type subcommand struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string)
+}
+
+// subcommands are the subcommands in the order the usage lists them. Without one the arguments
+// are the flags of wait.
+func subcommands() []subcommand {
+	return []subcommand{
+		{"wait", "Wait for the deployment of a service and check it, the default. wait stack waits for a CloudFormation stack", runWaitCommand},
+		{"deploy", "Deploy new images to a service and wait for it", func(ctx context.Context, args []string) { runWait(ctx, args, true) }},
+		{"status", "Show the deployments, task counts and target health of a service without waiting", runStatus},
+		{"events", "Show the events of a service", runEvents},
+		{"tasks", "Show the stopped tasks of a service and why they stopped", runTasks},
+		{"watch-cluster", "Show the rollout of every service in a cluster", runWatchCluster},
+		{"compare", "Compare two task definitions", runCompare},
+		{"shift", "Shift listener traffic between blue/green target groups", runShift},
+		{"doctor", "Check the flags, credentials and permissions of a run", runDoctor},
+		{"history", "List the runs recorded in the -history-db", runHistory},
+		{"daemon", "Verify every deployment of the services in a config file", runDaemon},
+		{"help", "Show this help", func(ctx context.Context, args []string) { printUsage() }},
+	}
+}
+
+// findSubcommand returns the subcommand with the name.
+func findSubcommand(name string) (subcommand, bool) {
+	for _, command := range subcommands() {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return subcommand{}, false
+}
+
+// runWaitCommand is the wait subcommand, wait stack waits for a CloudFormation stack instead.
+func runWaitCommand(ctx context.Context, args []string) {
+	if len(args) > 0 && args[0] == "stack" {
+		runWaitStack(ctx, args[1:])
+		return
+	}
+	runWait(ctx, args, false)
+}
+
+// printUsage lists the subcommands and the flags of wait.
+func printUsage() {
+	fmt.Println("Usage: are-we-there-yet [subcommand] [flags]")
+	fmt.Println()
+	fmt.Println("Subcommands:")
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, command := range subcommands() {
+		fmt.Fprintf(table, "  %s\t%s\n", command.name, command.summary)
+	}
+	table.Flush()
+	fmt.Println()
+	fmt.Println("Flags of wait and deploy, the other subcommands show theirs with -h:")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// runCompare is the compare subcommand. It prints the differences between two task definition
+// revisions, or between a revision and the one the service runs with -with-running.
+func runCompare(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	cluster := flags.String("cluster", "", "Cluster of the -service for -with-running")
+	service := flags.String("service", "", "Service whose task definition to compare with for -with-running")
+	withRunning := flags.Bool("with-running", false, "Compare the task definition the service runs with the one given")
+	redact := flags.String("redact", *flagRedact, "Regular expression for command arguments to redact. Environment variable values and secrets are always redacted")
+	debugAws := flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID")
+	flags.Usage = func() {
+		fmt.Println("Usage: are-we-there-yet compare family:12 family:13")
+		fmt.Println("       are-we-there-yet compare -with-running -cluster production -service web family:13")
+		flags.PrintDefaults()
+	}
+	region := flags.String("region", "", regionUsage)
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+
+	wanted := 2
+	if *withRunning {
+		wanted = 1
+	}
+	if flags.NArg() != wanted {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	awsSession, err := newAwsSession(*region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *debugAws {
+		debugAwsRequests(awsSession)
+	}
+	sh := newServiceHandler(ctx, awsSession, *service, *cluster, *flagCheckInterval, *flagTimeout)
+	redactor, err := newRedactor(*redact)
+	if err != nil {
+		logger.errorf("Bad value for -redact. Error: %s", err)
+		os.Exit(1)
+	}
+	sh.setRedactor(redactor)
+
+	before, after := flags.Arg(0), flags.Arg(1)
+	if *withRunning {
+		if err := sh.refresh(); err != nil {
+			logger.errorf("There was an error describing the service. Error: %s", err)
+			os.Exit(1)
+		}
+		before, after = aws.StringValue(sh.currentOutput.TaskDefinition), flags.Arg(0)
+	}
+	if err := sh.printTaskDefinitionDiff(before, after); err != nil {
+		logger.errorf("There was an error comparing the task definitions. Error: %s", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the optional configuration file passed with -config. It can be JSON or, with a .yaml or
+// .yml extension, YAML with the same field names.
+type config struct {
+	// Flags are the values of flags for every target, like {"timeout": 20, "check-listeners": true}.
+	// Flags given on the command line win.
+	Flags map[string]interface{} `json:"flags"`
+	// Targets are the services to wait for, so pipelines don't need to pass them as flags.
+	Targets []targetConfig `json:"targets"`
+	// EventPatterns are matched against service events while waiting.
+	EventPatterns []eventPatternConfig `json:"event_patterns"`
+	// NotifyWebhook receives a JSON message for every event that matches a notify pattern.
+	NotifyWebhook string `json:"notify_webhook"`
+	// Watches are the services the daemon subcommand verifies every deployment of.
+	Watches []watchConfig `json:"watches"`
+	// Tenants can register their own watches with the daemon through its API.
+	Tenants []tenantConfig `json:"tenants"`
+	// WebhookAllowlist are the URLs that the notify_webhook of a watch registered by a tenant must
+	// start with.
+	WebhookAllowlist []string `json:"webhook_allowlist"`
+}
+
+// tenantConfig is a team sharing the daemon. It sends its token in the X-Api-Key header.
+type tenantConfig struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// Clusters are the clusters the tenant may register watches in.
+	Clusters []string `json:"clusters"`
+}
+
+// watchConfig is a service for the daemon to watch. The thresholds that are not set use the
+// defaults of the flags with the same name.
+type watchConfig struct {
+	Cluster string `json:"cluster"`
+	Service string `json:"service"`
+	// NotifyWebhook receives the result of every deployment of the service, falling back to the
+	// notify_webhook of the config.
+	NotifyWebhook   string `json:"notify_webhook,omitempty"`
+	StabilityWindow string `json:"stability_window,omitempty"`
+	Timeout         int    `json:"timeout,omitempty"`
+	MaxFailedTasks  *int64 `json:"max_failed_tasks,omitempty"`
+	// Schedule is a cron schedule, like "0 * * * *", to verify the service on between deployments.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// targetConfig is a service to wait for. Its flags win over the flags of the config.
+type targetConfig struct {
+	Cluster string                 `json:"cluster"`
+	Service string                 `json:"service"`
+	Flags   map[string]interface{} `json:"flags"`
+}
+
+type eventPatternConfig struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+func loadConfig(path string) (*config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		// Going through JSON lets YAML use the same field names.
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("failed to parse %s. Error: %s", path, err)
+		}
+		if content, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("failed to parse %s. Error: %s", path, err)
+		}
+	}
+	cfg := &config{}
+	// Numbers in the flags stay as they are written instead of becoming floats. Misspelled fields
+	// are an error instead of being ignored.
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s. Error: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// eventTriggers compiles the event patterns in the config.
+func (c *config) eventTriggers() ([]eventTrigger, error) {
+	triggers := []eventTrigger{}
+	for _, eventPattern := range c.EventPatterns {
+		pattern, err := regexp.Compile(eventPattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad event pattern %q. Error: %s", eventPattern.Pattern, err)
+		}
+		switch eventPattern.Action {
+		case eventActionFail, eventActionWarn:
+		case eventActionNotify:
+			if c.NotifyWebhook == "" {
+				return nil, fmt.Errorf("event pattern %q uses notify but there is no notify_webhook", eventPattern.Pattern)
+			}
+		default:
+			return nil, fmt.Errorf("event pattern %q has unknown action %q, use fail, warn or notify", eventPattern.Pattern, eventPattern.Action)
+		}
+		triggers = append(triggers, eventTrigger{pattern: pattern, action: eventPattern.Action})
+	}
+	return triggers, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := map[string]struct {
+		file     string
+		content  string
+		expected *config
+		err      bool
+	}{
+		"json": {
+			file:    "config.json",
+			content: `{"flags": {"timeout": 20}, "targets": [{"cluster": "production", "service": "web", "flags": {"check-listeners": true}}]}`,
+			expected: &config{
+				Flags: map[string]interface{}{"timeout": json.Number("20")},
+				Targets: []targetConfig{
+					{Cluster: "production", Service: "web", Flags: map[string]interface{}{"check-listeners": true}},
+				},
+			},
+		},
+		"yaml": {
+			file:    "config.yaml",
+			content: "flags:\n  timeout: 20\ntargets:\n  - cluster: production\n    service: web\n",
+			expected: &config{
+				Flags:   map[string]interface{}{"timeout": json.Number("20")},
+				Targets: []targetConfig{{Cluster: "production", Service: "web"}},
+			},
+		},
+		"unknown field": {
+			file:    "config.json",
+			content: `{"target": [{"service": "web"}]}`,
+			err:     true,
+		},
+		"unknown yaml field": {
+			file:    "config.yml",
+			content: "flag:\n  timeout: 20\n",
+			err:     true,
+		},
+		"unknown target field": {
+			file:    "config.json",
+			content: `{"targets": [{"service": "web", "timeout": 20}]}`,
+			err:     true,
+		},
+		"bad json": {
+			file:    "config.json",
+			content: `{"flags": `,
+			err:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadConfig(path)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
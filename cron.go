@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors are the shorthands for common schedules.
+var cronDescriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronSchedule is a standard 5 field cron schedule: minute, hour, day of month, month and day of
+// week. Every field is a bit set of the values it matches.
+type cronSchedule struct {
+	spec     string
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// Like cron, when both days and weekdays are restricted a time matching either is enough.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// parseCron parses a schedule like "*/15 9-17 * * 1-5" or one of the cronDescriptors.
+func parseCron(spec string) (*cronSchedule, error) {
+	expanded := spec
+	if descriptor, ok := cronDescriptors[strings.TrimSpace(spec)]; ok {
+		expanded = descriptor
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q needs 5 fields: minute, hour, day of month, month and day of week", spec)
+	}
+
+	schedule := &cronSchedule{
+		spec:       spec,
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("bad minute in schedule %q. Error: %s", spec, err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("bad hour in schedule %q. Error: %s", spec, err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("bad day of month in schedule %q. Error: %s", spec, err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("bad month in schedule %q. Error: %s", spec, err)
+	}
+	// 7 is also Sunday.
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("bad day of week in schedule %q. Error: %s", spec, err)
+	}
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	return schedule, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each with an optional /step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	bits := uint64(0)
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[slash+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step in %q", item)
+			}
+			item = item[:slash]
+		}
+
+		low, high := min, max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("bad value %q", bounds[0])
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("bad value %q", bounds[1])
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the end every 15.
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is outside of %d-%d", item, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// next returns the first time after the given time that the schedule matches, to the minute. The
+// zero time is returned for schedules that never match, like the 31st of February.
+func (c *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	after := time.Date(2024, time.May, 15, 10, 20, 30, 0, time.UTC)
+	tests := map[string]struct {
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		"every minute": {
+			spec:     "* * * * *",
+			after:    after,
+			expected: time.Date(2024, time.May, 15, 10, 21, 0, 0, time.UTC),
+		},
+		"on the minute is after": {
+			spec:     "* * * * *",
+			after:    time.Date(2024, time.May, 15, 10, 20, 0, 0, time.UTC),
+			expected: time.Date(2024, time.May, 15, 10, 21, 0, 0, time.UTC),
+		},
+		"step": {
+			spec:     "*/15 * * * *",
+			after:    after,
+			expected: time.Date(2024, time.May, 15, 10, 30, 0, 0, time.UTC),
+		},
+		"step from a value": {
+			spec:     "5/20 * * * *",
+			after:    after,
+			expected: time.Date(2024, time.May, 15, 10, 25, 0, 0, time.UTC),
+		},
+		"step over a range": {
+			spec:     "0 8-18/4 * * *",
+			after:    after,
+			expected: time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC),
+		},
+		"range": {
+			spec:     "0 9-17 * * *",
+			after:    time.Date(2024, time.May, 15, 17, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, time.May, 16, 9, 0, 0, 0, time.UTC),
+		},
+		"list": {
+			spec:     "0,45 10,14 * * *",
+			after:    after,
+			expected: time.Date(2024, time.May, 15, 10, 45, 0, 0, time.UTC),
+		},
+		"weekdays": {
+			spec:     "0 9 * * 1-5",
+			after:    time.Date(2024, time.May, 17, 10, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, time.May, 20, 9, 0, 0, 0, time.UTC),
+		},
+		"seven is sunday": {
+			spec:     "0 0 * * 7",
+			after:    after,
+			expected: time.Date(2024, time.May, 19, 0, 0, 0, 0, time.UTC),
+		},
+		"day of month or day of week": {
+			spec:     "0 0 20 * 5",
+			after:    after,
+			expected: time.Date(2024, time.May, 17, 0, 0, 0, 0, time.UTC),
+		},
+		"day of month before day of week": {
+			spec:     "0 0 16 * 5",
+			after:    after,
+			expected: time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC),
+		},
+		"month rollover": {
+			spec:     "0 0 1 * *",
+			after:    after,
+			expected: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"year rollover": {
+			spec:     "30 6 * 1 *",
+			after:    time.Date(2024, time.December, 31, 23, 59, 0, 0, time.UTC),
+			expected: time.Date(2025, time.January, 1, 6, 30, 0, 0, time.UTC),
+		},
+		"skips short months": {
+			spec:     "0 0 31 * *",
+			after:    time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC),
+		},
+		"leap day": {
+			spec:     "0 0 29 2 *",
+			after:    after,
+			expected: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"descriptor": {
+			spec:     "@daily",
+			after:    after,
+			expected: time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			schedule, err := parseCron(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.next(test.after); !got.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := map[string]struct {
+		spec string
+	}{
+		"too few fields":       {spec: "* * * *"},
+		"too many fields":      {spec: "* * * * * *"},
+		"unknown descriptor":   {spec: "@fortnightly"},
+		"minute out of range":  {spec: "60 * * * *"},
+		"hour out of range":    {spec: "0 24 * * *"},
+		"day zero":             {spec: "0 0 0 * *"},
+		"month out of range":   {spec: "0 0 1 13 *"},
+		"weekday out of range": {spec: "0 0 * * 8"},
+		"backwards range":      {spec: "0 17-9 * * *"},
+		"zero step":            {spec: "*/0 * * * *"},
+		"bad step":             {spec: "*/x * * * *"},
+		"not a number":         {spec: "a * * * *"},
+		"empty list item":      {spec: "1,,2 * * * *"},
+		"never runs":           {spec: "0 0 31 2 *"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseCron(test.spec); err == nil {
+				t.Errorf("expected an error for %q", test.spec)
+			}
+		})
+	}
+}
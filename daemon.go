@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// watchSettings are the thresholds and notification settings of a watch, resolved from the config.
+type watchSettings struct {
+	notifyWebhook   string
+	stabilityWindow time.Duration
+	timeout         int
+	maxFailedTasks  int64
+	triggers        []eventTrigger
+	// schedule runs the verification periodically when it is set.
+	schedule *cronSchedule
+}
+
+// daemonWatch is a service the daemon watches. Its settings can change on a reload while it runs.
+type daemonWatch struct {
+	id      string
+	cluster string
+	service string
+	config  watchConfig
+	// tenant registered the watch through the API, it is empty for the watches in the config file.
+	tenant string
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	settings watchSettings
+
+	// lastResult is only used by the goroutine running the watch.
+	lastResult string
+}
+
+func (w *daemonWatch) current() watchSettings {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.settings
+}
+
+func (w *daemonWatch) set(settings watchSettings) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.settings = settings
+}
+
+// daemon verifies every deployment of the services in the config until it is stopped. The config
+// is loaded again when it changes or on SIGHUP, so services can be added without a restart.
+type daemon struct {
+	ctx           context.Context
+	awsSession    *session.Session
+	srv           *server
+	configPath    string
+	configChanged time.Time
+	checkInterval int
+	group         sync.WaitGroup
+
+	// lock guards the config and the watches, the registry API changes them too.
+	lock     sync.Mutex
+	cfg      *config
+	triggers []eventTrigger
+	watches  map[string]*daemonWatch
+}
+
+// watchId is how a watch is known to the server, /watches/{id}/stream.
+func watchId(cluster, service string) string {
+	return cluster + ":" + service
+}
+
+// configTriggers returns the built in event triggers followed by the ones in the config.
+func configTriggers(cfg *config) ([]eventTrigger, error) {
+	triggers := append([]eventTrigger{}, builtinEventTriggers...)
+	patterns, err := cfg.eventTriggers()
+	if err != nil {
+		return nil, err
+	}
+	return append(triggers, patterns...), nil
+}
+
+// resolveWatch works out the settings of a watch, the thresholds it does not set come from the flags.
+func resolveWatch(cfg *config, triggers []eventTrigger, watch watchConfig) (watchSettings, error) {
+	if watch.Cluster == "" || watch.Service == "" {
+		return watchSettings{}, fmt.Errorf("every watch needs a cluster and a service")
+	}
+	ws := watchSettings{
+		notifyWebhook:   cfg.NotifyWebhook,
+		stabilityWindow: *flagStability,
+		timeout:         *flagTimeout,
+		maxFailedTasks:  *flagMaxFailed,
+		triggers:        triggers,
+	}
+	if watch.NotifyWebhook != "" {
+		ws.notifyWebhook = watch.NotifyWebhook
+	}
+	var err error
+	if watch.StabilityWindow != "" {
+		ws.stabilityWindow, err = time.ParseDuration(watch.StabilityWindow)
+		if err != nil {
+			return watchSettings{}, fmt.Errorf("bad stability_window for service %s. Error: %s", watch.Service, err)
+		}
+	}
+	if watch.Timeout > 0 {
+		ws.timeout = watch.Timeout
+	}
+	if watch.MaxFailedTasks != nil {
+		ws.maxFailedTasks = *watch.MaxFailedTasks
+	}
+	if watch.Schedule != "" {
+		ws.schedule, err = parseCron(watch.Schedule)
+		if err != nil {
+			return watchSettings{}, fmt.Errorf("bad schedule for service %s. Error: %s", watch.Service, err)
+		}
+	}
+	return ws, nil
+}
+
+// reload loads the config and starts, updates and stops the watches of the config file to match
+// it. Watches registered through the API pick up the new defaults and are stopped when their
+// tenant is removed or may no longer use their cluster or webhook. A bad config is reported and
+// the running watches are left alone.
+func (d *daemon) reload() error {
+	info, err := os.Stat(d.configPath)
+	if err != nil {
+		return err
+	}
+	d.configChanged = info.ModTime()
+	cfg, err := loadConfig(d.configPath)
+	if err != nil {
+		return err
+	}
+	triggers, err := configTriggers(cfg)
+	if err != nil {
+		return err
+	}
+	tenants := map[string]bool{}
+	for _, tenant := range cfg.Tenants {
+		if tenant.Name == "" || tenant.Token == "" || len(tenant.Clusters) == 0 {
+			return fmt.Errorf("every tenant needs a name, a token and the clusters it may watch")
+		}
+		tenants[tenant.Name] = true
+	}
+	settings := map[string]watchSettings{}
+	for _, watch := range cfg.Watches {
+		id := watchId(watch.Cluster, watch.Service)
+		if _, ok := settings[id]; ok {
+			return fmt.Errorf("service %s in cluster %s is watched twice", watch.Service, watch.Cluster)
+		}
+		if settings[id], err = resolveWatch(cfg, triggers, watch); err != nil {
+			return err
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cfg, d.triggers = cfg, triggers
+	for id, watch := range d.watches {
+		_, configured := settings[id]
+		switch {
+		case watch.tenant == "" && !configured:
+			d.stopWatch(id)
+		case watch.tenant != "" && configured:
+			logger.infof("Service %s in cluster %s registered by %s is in the config now.", watch.service, watch.cluster, watch.tenant)
+			watch.tenant = ""
+		case watch.tenant != "" && !tenants[watch.tenant]:
+			logger.infof("Tenant %s was removed from the config.", watch.tenant)
+			d.stopWatch(id)
+		case watch.tenant != "":
+			if err := d.tenantAllows(watch.tenant, watch.config); err != nil {
+				logger.infof("Stopping the watch of %s: %s.", watch.tenant, err)
+				d.stopWatch(id)
+			} else if ws, err := resolveWatch(cfg, triggers, watch.config); err == nil {
+				watch.set(ws)
+			}
+		}
+	}
+
+	for _, watch := range cfg.Watches {
+		id := watchId(watch.Cluster, watch.Service)
+		if existing, ok := d.watches[id]; ok {
+			existing.config = watch
+			existing.set(settings[id])
+			continue
+		}
+		d.startWatch(id, "", watch, settings[id])
+	}
+	logger.infof("Loaded %s, watching %d services.", d.configPath, len(d.watches))
+	return nil
+}
+
+// startWatch starts watching a service. The caller holds the lock.
+func (d *daemon) startWatch(id, tenant string, config watchConfig, settings watchSettings) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	watch := &daemonWatch{
+		id:       id,
+		cluster:  config.Cluster,
+		service:  config.Service,
+		config:   config,
+		tenant:   tenant,
+		cancel:   cancel,
+		settings: settings,
+	}
+	d.watches[id] = watch
+	logger.infof("Watching service %s in cluster %s.", watch.service, watch.cluster)
+	d.group.Add(1)
+	go func() {
+		defer d.group.Done()
+		d.runWatch(ctx, watch)
+	}()
+}
+
+// stopWatch stops watching a service. The caller holds the lock.
+func (d *daemon) stopWatch(id string) {
+	watch := d.watches[id]
+	logger.infof("Stopped watching service %s in cluster %s.", watch.service, watch.cluster)
+	watch.cancel()
+	delete(d.watches, id)
+	if d.srv != nil {
+		d.srv.removeWatch(id)
+	}
+}
+
+// configModified tells if the config file changed since it was last loaded.
+func (d *daemon) configModified() bool {
+	info, err := os.Stat(d.configPath)
+	if err != nil {
+		logger.warnf("could not look at %s. Error: %s", d.configPath, err)
+		return false
+	}
+	return !info.ModTime().Equal(d.configChanged)
+}
+
+// runWatch looks at the service every check interval and verifies every deployment that is in
+// progress. A deployment is only verified once. Between deployments the service is verified on the
+// schedule of the watch, if it has one.
+func (d *daemon) runWatch(ctx context.Context, watch *daemonWatch) {
+	client := ecs.New(d.awsSession)
+	verified := ""
+	scheduled := ""
+	next := time.Time{}
+	for first := true; ; first = false {
+		if !first && sleepContext(ctx, time.Second*time.Duration(d.checkInterval)) != nil {
+			return
+		}
+		// The schedule can change in a reload.
+		if schedule := watch.current().schedule; schedule == nil {
+			scheduled, next = "", time.Time{}
+		} else if schedule.spec != scheduled {
+			scheduled, next = schedule.spec, schedule.next(time.Now())
+			logger.infof("Next scheduled verification of service %s in cluster %s is at %s.", watch.service, watch.cluster, next.Format(time.RFC3339))
+		}
+
+		output, err := client.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(watch.cluster),
+			Services: []*string{aws.String(watch.service)},
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.errorf("There was an error describing service %s in cluster %s. Error: %s", watch.service, watch.cluster, err)
+			continue
+		}
+		if len(output.Services) == 0 {
+			logger.warnf("service %s was not found in cluster %s.", watch.service, watch.cluster)
+			continue
+		}
+		deployment := ecswait.PrimaryDeployment(output.Services[0])
+		if deployment != nil && aws.StringValue(deployment.RolloutState) == ecs.DeploymentRolloutStateInProgress {
+			if id := aws.StringValue(deployment.Id); id != verified {
+				verified = id
+				d.verify(ctx, watch, fmt.Sprintf("Deployment %s of %s in %s", id, watch.service, watch.cluster), true)
+			}
+			continue
+		}
+
+		if !next.IsZero() && !time.Now().Before(next) {
+			// A deployment in progress is verified on its own, the schedule waits for it to finish.
+			d.verify(ctx, watch, fmt.Sprintf("Scheduled verification of %s in %s", watch.service, watch.cluster), false)
+			if schedule := watch.current().schedule; schedule != nil {
+				next = schedule.next(time.Now())
+			}
+		}
+	}
+}
+
+// verify waits for the service like a normal run and sends the result to the notify webhook.
+// Unless always is set, the result is only sent when it is different from the last one, so a
+// periodic verification of a healthy service stays quiet.
+func (d *daemon) verify(ctx context.Context, watch *daemonWatch, subject string, always bool) {
+	settings := watch.current()
+	sh := newServiceHandler(ctx, d.awsSession, watch.service, watch.cluster, d.checkInterval, settings.timeout)
+	sh.setStabilityWindow(settings.stabilityWindow)
+	sh.setMaxFailedTasks(settings.maxFailedTasks)
+	sh.setEventTriggers(settings.triggers)
+	sh.setNotifyWebhook(settings.notifyWebhook)
+	if d.srv != nil {
+		d.srv.addWatch(watch.id, sh)
+	}
+
+	sh.log.infof("%s started.", subject)
+	err := sh.wait()
+	if ctx.Err() != nil {
+		// The watch was removed or the daemon is stopping.
+		return
+	}
+	result, message := "success", fmt.Sprintf("%s looks good.", subject)
+	if err != nil {
+		result, message = "failed", fmt.Sprintf("%s failed. Error: %s", subject, err)
+		sh.log.errorf("%s", message)
+	} else {
+		sh.log.infof("%s", message)
+	}
+	sh.publishResult(result)
+
+	previous := watch.lastResult
+	watch.lastResult = result
+	if !always {
+		// Nothing is known before the first result, only a failure is news then.
+		if previous == "" {
+			previous = "success"
+		}
+		if result == previous {
+			return
+		}
+	}
+
+	// The webhook may have changed in a reload while we waited.
+	if webhook := watch.current().notifyWebhook; webhook != "" {
+		if err := sendNotification(webhook, message); err != nil {
+			sh.log.errorf("There was an error sending the notification. Error: %s", err)
+		}
+	}
+}
+
+// runDaemon is the daemon subcommand.
+func runDaemon(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := flags.String("config", "", "Config file with the services to watch. It is loaded again when it changes or on SIGHUP")
+	checkInterval := flags.Int("check", *flagCheckInterval, "Seconds between checks")
+	reloadInterval := flags.Duration("reload-interval", 10*time.Second, "How often to look for changes to the -config file")
+	listen := flags.String("listen", "", "Address to serve HTTP on, like :8080. See the server mode of a normal run")
+	listenApiKey := flags.String("listen-api-key", "", "Value that requests to -listen must send in the X-Api-Key header")
+	listenDebug := flags.Bool("listen-debug", false, "Serve pprof on /debug/pprof/ and the internal state of the watches on /debug/state with -listen")
+	debugAws := flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID")
+	flags.Usage = func() {
+		fmt.Println("Usage: are-we-there-yet daemon -config awty.json -listen :8080")
+		flags.PrintDefaults()
+	}
+	region := flags.String("region", "", regionUsage)
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+	if *configPath == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	awsSession, err := newAwsSession(*region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *debugAws {
+		debugAwsRequests(awsSession)
+	}
+
+	d := &daemon{
+		ctx:           ctx,
+		awsSession:    awsSession,
+		configPath:    *configPath,
+		checkInterval: *checkInterval,
+		watches:       map[string]*daemonWatch{},
+	}
+	if *listen != "" {
+		d.srv = newServer(*listenApiKey)
+	}
+	if err := d.reload(); err != nil {
+		logger.errorf("There was an error loading the config. Error: %s", err)
+		os.Exit(1)
+	}
+	if d.srv != nil {
+		d.enableRegistry()
+		if *listenDebug {
+			d.srv.enableDebug()
+		}
+		d.srv.start(*listen)
+		go d.srv.validateCredentials(ctx, awsSession)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(*reloadInterval)
+	defer ticker.Stop()
+	for {
+		reload := false
+		select {
+		case <-ctx.Done():
+			logger.infof("Stopping the daemon.")
+			d.group.Wait()
+			return
+		case <-hangup:
+			reload = true
+		case <-ticker.C:
+			reload = d.configModified()
+		}
+		if !reload {
+			continue
+		}
+		if err := d.reload(); err != nil {
+			logger.errorf("There was an error reloading the config, keeping the running watches. Error: %s", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// parseDeadline works out the wall clock deadline from -deadline or -deadline-in, counting
+// -deadline-in from now. The zero time is returned when neither is set.
+func parseDeadline(deadline string, deadlineIn time.Duration, now time.Time) (time.Time, error) {
+	var at time.Time
+	switch {
+	case deadline != "" && deadlineIn > 0:
+		return time.Time{}, fmt.Errorf("use -deadline or -deadline-in, not both")
+	case deadline != "":
+		var err error
+		at, err = time.Parse(time.RFC3339, deadline)
+		if err != nil {
+			return time.Time{}, err
+		}
+	case deadlineIn > 0:
+		at = now.Add(deadlineIn)
+	default:
+		return time.Time{}, nil
+	}
+	if !at.After(now) {
+		return time.Time{}, fmt.Errorf("the deadline %s has already passed", at.Format(time.RFC3339))
+	}
+	return at, nil
+}
+
+// withDeadline bounds the run by the deadline, so every phase and attempt stops once it is
+// reached. Pipelines with a fixed change window need to know that we will never run over it.
+func withDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	logger.debugf("Giving up at %s, %s from now.", deadline.Format(time.RFC3339), time.Until(deadline).Round(time.Second))
+	return context.WithDeadline(ctx, deadline)
+}
+
+// deadlineReached tells if the run stopped because of the deadline rather than an interrupt.
+func deadlineReached(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		deadline   string
+		deadlineIn time.Duration
+		expected   time.Time
+		fails      bool
+	}{
+		"neither": {},
+		"RFC3339": {
+			deadline: "2024-05-01T14:30:00Z",
+			expected: time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC),
+		},
+		"RFC3339 with an offset": {
+			deadline: "2024-05-01T16:30:00+02:00",
+			expected: time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC),
+		},
+		"duration": {
+			deadlineIn: 90 * time.Minute,
+			expected:   time.Date(2024, 5, 1, 13, 30, 0, 0, time.UTC),
+		},
+		"both": {
+			deadline:   "2024-05-01T14:30:00Z",
+			deadlineIn: time.Hour,
+			fails:      true,
+		},
+		"not RFC3339": {
+			deadline: "2024-05-01 14:30",
+			fails:    true,
+		},
+		"no timezone": {
+			deadline: "2024-05-01T14:30:00",
+			fails:    true,
+		},
+		"in the past": {
+			deadline: "2024-05-01T11:59:00Z",
+			fails:    true,
+		},
+		"in the past by its offset": {
+			deadline: "2024-05-01T13:30:00+02:00",
+			fails:    true,
+		},
+		"now": {
+			deadline: "2024-05-01T12:00:00Z",
+			fails:    true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseDeadline(test.deadline, test.deadlineIn, now)
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
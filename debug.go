@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// watchState is what /debug/state shows about a watch.
+type watchState struct {
+	Cluster          string        `json:"cluster"`
+	Service          string        `json:"service"`
+	DeploymentId     string        `json:"deployment_id"`
+	Phase            string        `json:"phase"`
+	PhaseStarted     time.Time     `json:"phase_started"`
+	Phases           []phaseTiming `json:"phases"`
+	Started          time.Time     `json:"started"`
+	Checks           int           `json:"checks"`
+	UnhealthyTargets int           `json:"unhealthy_targets"`
+	EventTriggers    int           `json:"event_triggers"`
+	SeenEvents       int           `json:"seen_events"`
+	Checkers         []string      `json:"checkers"`
+	Anomalies        []string      `json:"anomalies"`
+}
+
+// debugState is the body of /debug/state.
+type debugState struct {
+	Goroutines int                   `json:"goroutines"`
+	Watches    map[string]watchState `json:"watches"`
+}
+
+// enableDebug adds the pprof endpoints under /debug/pprof/ and the internal state of the watches on /debug/state.
+func (srv *server) enableDebug() {
+	srv.mux.HandleFunc("/debug/pprof/", srv.authorized(pprof.Index))
+	srv.mux.HandleFunc("/debug/pprof/cmdline", srv.authorized(pprof.Cmdline))
+	srv.mux.HandleFunc("/debug/pprof/profile", srv.authorized(pprof.Profile))
+	srv.mux.HandleFunc("/debug/pprof/symbol", srv.authorized(pprof.Symbol))
+	srv.mux.HandleFunc("/debug/pprof/trace", srv.authorized(pprof.Trace))
+	srv.mux.HandleFunc("/debug/state", srv.scoped(srv.handleDebugState))
+}
+
+// handleDebugState shows the internal state of the watches the request may see.
+func (srv *server) handleDebugState(w http.ResponseWriter, r *http.Request, visible func(id string) bool) {
+	state := debugState{
+		Goroutines: runtime.NumGoroutine(),
+		Watches:    map[string]watchState{},
+	}
+
+	_, watches := srv.visibleWatches(visible)
+	for id, sh := range watches {
+		checkers := []string{}
+		for _, c := range sh.checkers {
+			checkers = append(checkers, c.Name())
+		}
+		view := sh.view()
+		state.Watches[id] = watchState{
+			Cluster:          aws.StringValue(sh.clusterName),
+			Service:          aws.StringValue(sh.serviceName),
+			DeploymentId:     view.deploymentId,
+			Phase:            view.phase,
+			PhaseStarted:     view.phaseStarted,
+			Phases:           view.phases,
+			Started:          sh.started,
+			Checks:           view.checks,
+			UnhealthyTargets: view.unhealthyTargets,
+			EventTriggers:    len(sh.eventTriggers),
+			SeenEvents:       view.seenEvents,
+			Checkers:         checkers,
+			Anomalies:        view.anomalies,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(state)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// parseImages reads a comma separated list of container=image pairs.
+func parseImages(value string) (map[string]string, error) {
+	images := map[string]string{}
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%q is not a container=image pair", item)
+		}
+		images[parts[0]] = parts[1]
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images given")
+	}
+	return images, nil
+}
+
+// deployImages registers a copy of the service task definition with the container images swapped
+// and updates the service to it. The new task definition ARN is returned.
+func (sh *serviceHandler) deployImages(images map[string]string) (string, error) {
+	if err := sh.refresh(); err != nil {
+		return "", err
+	}
+	output, err := sh.session.DescribeTaskDefinitionWithContext(sh.ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: sh.currentOutput.TaskDefinition,
+		Include:        []*string{aws.String(ecs.TaskDefinitionFieldTags)},
+	})
+	if err != nil {
+		return "", err
+	}
+	td := output.TaskDefinition
+
+	containers := []*ecs.ContainerDefinition{}
+	if err := deepCopy(td.ContainerDefinitions, &containers); err != nil {
+		return "", err
+	}
+	for name, image := range images {
+		container := containerDefinition(&ecs.TaskDefinition{ContainerDefinitions: containers}, name)
+		if container == nil {
+			return "", fmt.Errorf("task definition %s has no container %s", aws.StringValue(td.TaskDefinitionArn), name)
+		}
+		sh.log.infof("Changing the image of container %s from %s to %s.", name, aws.StringValue(container.Image), image)
+		container.Image = aws.String(image)
+	}
+
+	input := &ecs.RegisterTaskDefinitionInput{
+		Family:                  td.Family,
+		ContainerDefinitions:    containers,
+		Cpu:                     td.Cpu,
+		Memory:                  td.Memory,
+		EphemeralStorage:        td.EphemeralStorage,
+		ExecutionRoleArn:        td.ExecutionRoleArn,
+		TaskRoleArn:             td.TaskRoleArn,
+		NetworkMode:             td.NetworkMode,
+		IpcMode:                 td.IpcMode,
+		PidMode:                 td.PidMode,
+		InferenceAccelerators:   td.InferenceAccelerators,
+		PlacementConstraints:    td.PlacementConstraints,
+		ProxyConfiguration:      td.ProxyConfiguration,
+		RequiresCompatibilities: td.RequiresCompatibilities,
+		RuntimePlatform:         td.RuntimePlatform,
+		Volumes:                 td.Volumes,
+	}
+	if len(output.Tags) > 0 {
+		input.Tags = output.Tags
+	}
+	registered, err := sh.session.RegisterTaskDefinitionWithContext(sh.ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to register the task definition. Error: %s", err)
+	}
+	newArn := aws.StringValue(registered.TaskDefinition.TaskDefinitionArn)
+	sh.log.infof("Registered task definition %s.", newArn)
+
+	_, err = sh.session.UpdateServiceWithContext(sh.ctx, &ecs.UpdateServiceInput{
+		Cluster:        sh.clusterName,
+		Service:        sh.serviceName,
+		TaskDefinition: aws.String(newArn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update the service. Error: %s", err)
+	}
+	sh.log.infof("Updated service %s to %s.", aws.StringValue(sh.serviceName), newArn)
+	return newArn, nil
+}
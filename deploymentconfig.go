@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Rolling update defaults that ECS uses when the service does not set them.
+const (
+	defaultMinimumHealthyPercent = 100
+	defaultMaximumPercent        = 200
+)
+
+// deploymentConfigurationWarnings explains the ways the rolling update settings of the service
+// can't work for its desired count. ECS rounds the maximum percent down and the minimum healthy
+// percent up, so with small desired counts the percentages leave no room to replace tasks.
+func deploymentConfigurationWarnings(service *ecs.Service) []string {
+	if controller := service.DeploymentController; controller != nil && aws.StringValue(controller.Type) != ecs.DeploymentControllerTypeEcs {
+		return nil
+	}
+	// Daemon services always stop a task before starting its replacement.
+	if aws.StringValue(service.SchedulingStrategy) == ecs.SchedulingStrategyDaemon {
+		return nil
+	}
+	desired := aws.Int64Value(service.DesiredCount)
+	if desired == 0 {
+		return nil
+	}
+
+	minimumHealthy := int64(defaultMinimumHealthyPercent)
+	maximum := int64(defaultMaximumPercent)
+	if config := service.DeploymentConfiguration; config != nil {
+		if config.MinimumHealthyPercent != nil {
+			minimumHealthy = aws.Int64Value(config.MinimumHealthyPercent)
+		}
+		if config.MaximumPercent != nil {
+			maximum = aws.Int64Value(config.MaximumPercent)
+		}
+	}
+
+	maxTasks := desired * maximum / 100
+	minHealthyTasks := (desired*minimumHealthy + 99) / 100
+	extra := maxTasks - desired
+	stoppable := desired - minHealthyTasks
+	settings := fmt.Sprintf("with a desired count of %d, minimum healthy %d%% and maximum %d%%", desired, minimumHealthy, maximum)
+
+	warnings := []string{}
+	switch {
+	case extra <= 0 && stoppable <= 0:
+		warnings = append(warnings, fmt.Sprintf(
+			"the rollout can't make progress %s. ECS may run at most %d tasks and must keep %d healthy, so it can neither start a new task nor stop an old one. Raise the maximum percent or lower the minimum healthy percent",
+			settings, maxTasks, minHealthyTasks,
+		))
+	case extra <= 0:
+		warnings = append(warnings, fmt.Sprintf(
+			"the rollout is not zero downtime %s. ECS may run at most %d tasks, so it has to stop old tasks before starting new ones and capacity drops to %d tasks. Raise the maximum percent to start new tasks first",
+			settings, maxTasks, minHealthyTasks,
+		))
+	}
+	if minHealthyTasks == 0 && extra > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"the rollout is not zero downtime %s. ECS is allowed to stop every running task at once. Raise the minimum healthy percent to keep tasks serving",
+			settings,
+		))
+	}
+	return warnings
+}
+
+// printDeploymentConfigurationWarnings prints the deployment configuration warnings of the service.
+func (sh *serviceHandler) printDeploymentConfigurationWarnings() {
+	for _, warning := range deploymentConfigurationWarnings(sh.currentOutput) {
+		sh.log.warnf("%s.", warning)
+	}
+}
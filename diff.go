@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// flatten turns a JSON document into a map of paths to values, like ContainerDefinitions[web].Image.
+// Elements of lists that have a Name are keyed by it instead of their position, so adding a
+// container or environment variable does not show every following element as changed.
+func flatten(prefix string, value interface{}, into map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flatten(path, child, into)
+		}
+	case []interface{}:
+		for i, child := range v {
+			key := fmt.Sprint(i)
+			if object, ok := child.(map[string]interface{}); ok {
+				if name, ok := object["Name"].(string); ok {
+					key = name
+				}
+			}
+			flatten(fmt.Sprintf("%s[%s]", prefix, key), child, into)
+		}
+	case nil:
+	default:
+		content, _ := json.Marshal(v)
+		into[prefix] = string(content)
+	}
+}
+
+// diffValues describes every difference between two values, one line per changed path. The
+// ignored top level fields are left out, they change every time without meaning anything.
+func diffValues(before, after interface{}, ignored ...string) ([]string, error) {
+	flat := func(value interface{}) (map[string]string, error) {
+		generic := map[string]interface{}{}
+		if err := deepCopy(value, &generic); err != nil {
+			return nil, err
+		}
+		for _, field := range ignored {
+			delete(generic, field)
+		}
+		paths := map[string]string{}
+		flatten("", generic, paths)
+		return paths, nil
+	}
+	beforePaths, err := flat(before)
+	if err != nil {
+		return nil, err
+	}
+	afterPaths, err := flat(after)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for path := range beforePaths {
+		paths = append(paths, path)
+	}
+	for path := range afterPaths {
+		if _, ok := beforePaths[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []string{}
+	for _, path := range paths {
+		old, hadOld := beforePaths[path]
+		new, hasNew := afterPaths[path]
+		switch {
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", path, new))
+		case !hasNew:
+			changes = append(changes, fmt.Sprintf("- %s: %s", path, old))
+		case old != new:
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", path, old, new))
+		}
+	}
+	return changes, nil
+}
+
+// taskDefinitionNoise are the task definition fields that differ between any two revisions.
+var taskDefinitionNoise = []string{"TaskDefinitionArn", "Revision", "RegisteredAt", "RegisteredBy", "DeregisteredAt", "Status"}
+
+// diffTaskDefinitions describes the differences between two task definitions with the credentials redacted.
+func (sh *serviceHandler) diffTaskDefinitions(before, after *ecs.TaskDefinition) ([]string, error) {
+	redactedBefore, err := sh.redactor.taskDefinition(before)
+	if err != nil {
+		return nil, err
+	}
+	redactedAfter, err := sh.redactor.taskDefinition(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffValues(redactedBefore, redactedAfter, taskDefinitionNoise...)
+}
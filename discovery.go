@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// describeServicesBatchSize is the maximum number of services DescribeServices accepts in one call.
+const describeServicesBatchSize = 10
+
+// discoveredService is a service found by the organization sweep and whether it is stable.
+type discoveredService struct {
+	account string
+	cluster string
+	service *ecs.Service
+}
+
+// parseTag splits a key=value tag filter.
+func parseTag(tag string) (string, string, error) {
+	parts := strings.SplitN(tag, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("expected key=value, got %q", tag)
+	}
+	return parts[0], parts[1], nil
+}
+
+// sweepOrganization finds the services with the tag in every active account of the organization,
+// using the role in each account, and prints if they are stable. It exits 1 if any are not,
+// or if an account can't be looked at.
+func sweepOrganization(ctx context.Context, awsSession *session.Session, roleName, tag string) {
+	key, value, err := parseTag(tag)
+	if err != nil {
+		logger.errorf("Bad value for -discover-tag. Error: %s", err)
+		os.Exit(1)
+	}
+
+	accounts := []*organizations.Account{}
+	err = organizations.New(awsSession).ListAccountsPagesWithContext(ctx, &organizations.ListAccountsInput{},
+		func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+			accounts = append(accounts, page.Accounts...)
+			return true
+		},
+	)
+	if err != nil {
+		logger.errorf("There was an error listing the organization accounts. Error: %s", err)
+		os.Exit(1)
+	}
+
+	found := []discoveredService{}
+	problems := 0
+	for _, account := range accounts {
+		if aws.StringValue(account.Status) != organizations.AccountStatusActive {
+			continue
+		}
+		accountId := aws.StringValue(account.Id)
+		roleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, roleName)
+		client := ecs.New(awsSession, &aws.Config{Credentials: stscreds.NewCredentials(awsSession, roleArn)})
+		services, err := taggedServices(ctx, client, key, value)
+		if err != nil {
+			logger.warnf("could not look for services in account %s (%s). Error: %s", accountId, aws.StringValue(account.Name), err)
+			problems++
+			continue
+		}
+		for _, service := range services {
+			clusterArn := aws.StringValue(service.ClusterArn)
+			found = append(found, discoveredService{
+				account: accountId,
+				cluster: clusterArn[strings.LastIndex(clusterArn, "/")+1:],
+				service: service,
+			})
+		}
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ACCOUNT\tCLUSTER\tSERVICE\tDEPLOYMENTS\tRUNNING\tDESIRED\tSTABLE")
+	for _, ds := range found {
+		if !ecswait.Stable(ds.service) {
+			problems++
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%d\t%t\n",
+			ds.account,
+			ds.cluster,
+			aws.StringValue(ds.service.ServiceName),
+			len(ds.service.Deployments),
+			aws.Int64Value(ds.service.RunningCount),
+			aws.Int64Value(ds.service.DesiredCount),
+			ecswait.Stable(ds.service),
+		)
+	}
+	table.Flush()
+
+	if problems > 0 {
+		fmt.Printf("%d of %d services are not stable or could not be checked.\n", problems, len(found))
+		os.Exit(1)
+	}
+	fmt.Printf("All %d services are stable.\n", len(found))
+}
+
+// taggedServices returns the services in every cluster of the account that have the tag.
+func taggedServices(ctx context.Context, client *ecs.ECS, key, value string) ([]*ecs.Service, error) {
+	clusters := []*string{}
+	err := client.ListClustersPagesWithContext(ctx, &ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, lastPage bool) bool {
+		clusters = append(clusters, page.ClusterArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := []*ecs.Service{}
+	for _, cluster := range clusters {
+		services, err := clusterServices(ctx, client, cluster, ecs.ServiceFieldTags)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			for _, tag := range service.Tags {
+				if aws.StringValue(tag.Key) == key && aws.StringValue(tag.Value) == value {
+					tagged = append(tagged, service)
+					break
+				}
+			}
+		}
+	}
+	return tagged, nil
+}
+
+// clusterServices describes every service in the cluster, with the extra fields to include.
+func clusterServices(ctx context.Context, client *ecs.ECS, cluster *string, include ...string) ([]*ecs.Service, error) {
+	arns := []*string{}
+	err := client.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: cluster}, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+		arns = append(arns, page.ServiceArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := []*ecs.Service{}
+	for start := 0; start < len(arns); start += describeServicesBatchSize {
+		end := start + describeServicesBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		input := &ecs.DescribeServicesInput{
+			Cluster:  cluster,
+			Services: arns[start:end],
+		}
+		if len(include) > 0 {
+			input.Include = aws.StringSlice(include)
+		}
+		output, err := client.DescribeServicesWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, output.Services...)
+	}
+	return services, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Results of a doctor check.
+const (
+	doctorOk   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+// doctor collects the results of the doctor checks and prints them as a checklist.
+type doctor struct {
+	failed bool
+}
+
+func (d *doctor) report(result, check, format string, args ...interface{}) {
+	if result == doctorFail {
+		d.failed = true
+	}
+	fmt.Printf("[%-4s] %s: %s\n", result, check, fmt.Sprintf(format, args...))
+}
+
+// flagProblems returns the flag combinations that can't work or make no sense.
+func flagProblems() []string {
+	problems := []string{}
+	if *flagPlatform == "ecs" && *flagScheduledRule == "" && *flagDiscoverTag == "" {
+		if *flagServiceName == "" {
+			problems = append(problems, "-service is required")
+		}
+		if *flagClusterName == "" {
+			problems = append(problems, "-cluster is required")
+		}
+	}
+	if *flagDeadline != "" && *flagDeadlineIn > 0 {
+		problems = append(problems, "-deadline and -deadline-in can't be used together")
+	} else if _, err := parseDeadline(*flagDeadline, *flagDeadlineIn, time.Now()); err != nil {
+		problems = append(problems, fmt.Sprintf("-deadline is not valid: %s", err))
+	}
+	if value := *flagCheckAutoscaling; value != "" && value != "warn" && value != "fail" {
+		problems = append(problems, "-check-autoscaling must be warn or fail")
+	}
+	if value := *flagCheckCertificates; value != "" && value != "warn" && value != "fail" {
+		problems = append(problems, "-check-certificates must be warn or fail")
+	}
+	switch *flagTroubleshoot {
+	case troubleshootOff, troubleshootBasic, troubleshootFull:
+	default:
+		problems = append(problems, "-troubleshoot must be off, basic or full")
+	}
+	if _, ok := reportFormats[*flagReportAs]; !ok {
+		problems = append(problems, fmt.Sprintf("-report-format must be one of %s", reportFormatNames()))
+	}
+	if _, err := parseAssignPublicIp(*flagExpectAssignPublicIp); err != nil {
+		problems = append(problems, fmt.Sprintf("-expect-assign-public-ip is not valid: %s", err))
+	}
+	if _, err := parseRequiredPermissions(*flagTaskRoleActions); err != nil {
+		problems = append(problems, fmt.Sprintf("-task-role-actions is not valid: %s", err))
+	}
+	if _, err := newRedactor(*flagRedact); err != nil {
+		problems = append(problems, fmt.Sprintf("-redact is not valid: %s", err))
+	}
+	if *flagDnsName != "" && !*flagCheckDns {
+		problems = append(problems, "-dns-name does nothing without -check-dns")
+	}
+	if *flagTrafficGroup != "" && *flagTrafficShare <= 0 {
+		problems = append(problems, "-traffic-target-group does nothing without -traffic-share")
+	}
+	if *flagExpectRunning >= 0 && *flagMinRunning > *flagExpectRunning {
+		problems = append(problems, "-min-running is more than -expect-running")
+	}
+	if *flagListenApiKey != "" && *flagListen == "" {
+		problems = append(problems, "-listen-api-key does nothing without -listen")
+	}
+	return problems
+}
+
+// requiredActions returns the IAM actions the flags need.
+func requiredActions() []string {
+	actions := []string{"ecs:DescribeServices", "ecs:ListTasks", "ecs:DescribeTasks", "ecs:DescribeTaskDefinition", "elasticloadbalancing:DescribeTargetHealth"}
+	if *flagReapOldTasks || *flagRestartUnhealthy > 0 {
+		actions = append(actions, "ecs:StopTask")
+	}
+	if *flagProtectTasks {
+		actions = append(actions, "ecs:UpdateTaskProtection")
+	}
+	if *flagTroubleshoot == troubleshootFull || *flagBundle != "" || *flagCheckLogs {
+		actions = append(actions, "logs:GetLogEvents")
+	}
+	if *flagCanaryWindow > 0 || *flagMaxCpuUtilization > 0 || *flagMaxMemoryUtilization > 0 {
+		actions = append(actions, "cloudwatch:GetMetricData")
+	}
+	if *flagCheckCertificates != "" {
+		actions = append(actions, "elasticloadbalancing:DescribeListenerCertificates", "acm:DescribeCertificate")
+	}
+	if *flagExpectWebAcl != "" {
+		actions = append(actions, "wafv2:GetWebACLForResource")
+	}
+	return actions
+}
+
+// principalArn turns the caller identity into an ARN that IAM can simulate the policies of.
+// Assumed role sessions are simulated as the role.
+func principalArn(ctx context.Context, iamSession *iam.IAM, callerArn string) (string, error) {
+	parsed, err := arn.Parse(callerArn)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(parsed.Resource, "assumed-role/") {
+		return callerArn, nil
+	}
+	roleName := strings.Split(parsed.Resource, "/")[1]
+	output, err := iamSession.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Role.Arn), nil
+}
+
+// runDoctor is the doctor subcommand. It takes the same flags as a normal run and checks that the
+// run can work before a pipeline relies on it.
+func runDoctor(ctx context.Context, args []string) {
+	flag.CommandLine.Parse(args)
+	setupLogging(flagLogging, *flagVerbose)
+	d := &doctor{}
+
+	if problems := flagProblems(); len(problems) > 0 {
+		d.report(doctorFail, "flags", "%s", strings.Join(problems, "; "))
+	} else {
+		d.report(doctorOk, "flags", "consistent")
+	}
+
+	awsSession, err := newAwsSession(*flagRegion)
+	if err != nil {
+		d.report(doctorFail, "session", "%s", err)
+		os.Exit(1)
+	}
+	if *flagDebugAws {
+		debugAwsRequests(awsSession)
+	}
+	if region := aws.StringValue(awsSession.Config.Region); region == "" {
+		d.report(doctorFail, "region", "no region is configured, use -region or set AWS_REGION")
+	} else {
+		d.report(doctorOk, "region", "%s", region)
+	}
+
+	identity, err := sts.New(awsSession).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		d.report(doctorFail, "credentials", "%s", err)
+		os.Exit(1)
+	}
+	d.report(doctorOk, "credentials", "%s in account %s", aws.StringValue(identity.Arn), aws.StringValue(identity.Account))
+
+	sh := newServiceHandler(ctx, awsSession, *flagServiceName, *flagClusterName, *flagCheckInterval, *flagTimeout)
+	principal, err := principalArn(ctx, sh.iamSession, aws.StringValue(identity.Arn))
+	if err != nil {
+		d.report(doctorWarn, "permissions", "can't find the IAM principal to simulate: %s", err)
+	} else {
+		actions := requiredActions()
+		allowed, err := sh.simulatePrincipalPolicy(principal, actions, "*")
+		if err != nil {
+			d.report(doctorWarn, "permissions", "can't simulate the policies of %s: %s", principal, err)
+		} else if missing := missingActions(actions, allowed); len(missing) > 0 {
+			d.report(doctorFail, "permissions", "%s is not allowed %s", principal, strings.Join(missing, ", "))
+		} else {
+			d.report(doctorOk, "permissions", "%s is allowed %d actions", principal, len(actions))
+		}
+	}
+
+	if *flagServiceName != "" && *flagClusterName != "" {
+		if err := sh.refresh(); err != nil {
+			d.report(doctorFail, "service", "%s", err)
+		} else {
+			d.report(doctorOk, "service", "%s is %s with %d of %d tasks running", aws.StringValue(sh.currentOutput.ServiceName), aws.StringValue(sh.currentOutput.Status), aws.Int64Value(sh.currentOutput.RunningCount), aws.Int64Value(sh.currentOutput.DesiredCount))
+			controller := ecs.DeploymentControllerTypeEcs
+			if sh.currentOutput.DeploymentController != nil {
+				controller = aws.StringValue(sh.currentOutput.DeploymentController.Type)
+			}
+			if controller == ecs.DeploymentControllerTypeEcs {
+				d.report(doctorOk, "deployment controller", "%s", controller)
+			} else {
+				d.report(doctorFail, "deployment controller", "%s deployments have no rollout state to wait for, only the ECS controller is supported", controller)
+			}
+		}
+	}
+
+	if d.failed {
+		os.Exit(1)
+	}
+}
+
+// missingActions returns the actions that are not in allowed.
+func missingActions(actions, allowed []string) []string {
+	isAllowed := map[string]bool{}
+	for _, action := range allowed {
+		isAllowed[strings.ToLower(action)] = true
+	}
+	missing := []string{}
+	for _, action := range actions {
+		if !isAllowed[strings.ToLower(action)] {
+			missing = append(missing, action)
+		}
+	}
+	return missing
+}
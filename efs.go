@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/efs"
+)
+
+// efsMountFailurePattern matches the stopped reasons that ECS gives when an EFS volume could not be mounted.
+var efsMountFailurePattern = regexp.MustCompile(`(?i)(EFS utils|mount\.nfs4?|failed to resolve "fs-|efs.*mount)`)
+
+func efsFileSystemIds(td *ecs.TaskDefinition) []string {
+	ids := []string{}
+	for _, volume := range td.Volumes {
+		if volume.EfsVolumeConfiguration != nil {
+			ids = append(ids, aws.StringValue(volume.EfsVolumeConfiguration.FileSystemId))
+		}
+	}
+	return ids
+}
+
+// checkEfsMountTargets makes sure that every EFS file system used by the task definition has an
+// available mount target in each availability zone that the service can start tasks in.
+func (sh *serviceHandler) checkEfsMountTargets() error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+	fileSystemIds := efsFileSystemIds(td)
+	if len(fileSystemIds) == 0 {
+		sh.log.infof("Task definition has no EFS volumes.")
+		return nil
+	}
+
+	zones, err := sh.serviceAvailabilityZones()
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		sh.log.debugf("Service does not use awsvpc networking, mount targets can't be compared with the task subnets.")
+	}
+
+	problems := []string{}
+	for _, fileSystemId := range fileSystemIds {
+		available := map[string]bool{}
+		input := &efs.DescribeMountTargetsInput{FileSystemId: aws.String(fileSystemId)}
+		for {
+			output, err := sh.efsSession.DescribeMountTargetsWithContext(sh.ctx, input)
+			if err != nil {
+				return err
+			}
+			for _, target := range output.MountTargets {
+				if aws.StringValue(target.LifeCycleState) == efs.LifeCycleStateAvailable {
+					available[aws.StringValue(target.AvailabilityZoneName)] = true
+				}
+			}
+			if aws.StringValue(output.NextMarker) == "" {
+				break
+			}
+			input.Marker = output.NextMarker
+		}
+		if len(available) == 0 {
+			problems = append(problems, fmt.Sprintf("%s has no available mount targets", fileSystemId))
+			continue
+		}
+		for _, zone := range zones {
+			if !available[zone] {
+				problems = append(problems, fmt.Sprintf("%s has no available mount target in %s", fileSystemId, zone))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("EFS volumes can't be mounted:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// serviceAvailabilityZones returns the availability zones of the subnets that the service runs tasks in.
+func (sh *serviceHandler) serviceAvailabilityZones() ([]string, error) {
+	network := sh.currentOutput.NetworkConfiguration
+	if network == nil || network.AwsvpcConfiguration == nil || len(network.AwsvpcConfiguration.Subnets) == 0 {
+		return nil, nil
+	}
+
+	output, err := sh.ec2Session.DescribeSubnetsWithContext(sh.ctx, &ec2.DescribeSubnetsInput{
+		SubnetIds: network.AwsvpcConfiguration.Subnets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	zones := []string{}
+	seen := map[string]bool{}
+	for _, subnet := range output.Subnets {
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if !seen[zone] {
+			seen[zone] = true
+			zones = append(zones, zone)
+		}
+	}
+	return zones, nil
+}
+
+// printEfsMountFailures prints the stopped tasks of the PRIMARY deployment that failed to mount an EFS volume.
+func (sh *serviceHandler) printEfsMountFailures() error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+	if len(efsFileSystemIds(td)) == 0 {
+		return nil
+	}
+
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return nil
+	}
+	tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusStopped)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if efsMountFailurePattern.MatchString(aws.StringValue(task.StoppedReason)) {
+			fmt.Printf("Task %s in %s failed to mount EFS: %s\n", aws.StringValue(task.TaskArn), aws.StringValue(task.AvailabilityZone), aws.StringValue(task.StoppedReason))
+		}
+	}
+	return nil
+}
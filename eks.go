@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// eksTokenPrefix is the prefix of the bearer tokens that EKS accepts from aws-iam-authenticator.
+const eksTokenPrefix = "k8s-aws-v1."
+
+// eksWorkloadHandler waits for a Kubernetes Deployment or StatefulSet in an EKS cluster to finish rolling out.
+// It talks to the Kubernetes API directly and authenticates with a presigned STS request like aws eks get-token.
+type eksWorkloadHandler struct {
+	ctx           context.Context
+	stsSession    *sts.STS
+	httpClient    *http.Client
+	endpoint      string
+	clusterName   string
+	kind          string
+	name          string
+	namespace     string
+	checkInterval int
+	checkTimeout  int
+}
+
+// kubernetesWorkload is the part of a Deployment or StatefulSet that the rollout status needs.
+type kubernetesWorkload struct {
+	Metadata struct {
+		Generation int64 `json:"generation"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas       *int64 `json:"replicas"`
+		Paused         bool   `json:"paused"`
+		UpdateStrategy struct {
+			Type          string `json:"type"`
+			RollingUpdate *struct {
+				Partition *int64 `json:"partition"`
+			} `json:"rollingUpdate"`
+		} `json:"updateStrategy"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration int64  `json:"observedGeneration"`
+		Replicas           int64  `json:"replicas"`
+		UpdatedReplicas    int64  `json:"updatedReplicas"`
+		ReadyReplicas      int64  `json:"readyReplicas"`
+		AvailableReplicas  int64  `json:"availableReplicas"`
+		CurrentRevision    string `json:"currentRevision"`
+		UpdateRevision     string `json:"updateRevision"`
+		Conditions         []struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// parseWorkload splits kind/name, like deployment/web or statefulset/db.
+func parseWorkload(workload string) (string, string, error) {
+	parts := strings.SplitN(workload, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("expected deployment/name or statefulset/name, got %q", workload)
+	}
+	switch strings.ToLower(parts[0]) {
+	case "deployment", "deployments", "deploy":
+		return "deployments", parts[1], nil
+	case "statefulset", "statefulsets", "sts":
+		return "statefulsets", parts[1], nil
+	}
+	return "", "", fmt.Errorf("unsupported kind %q, use deployment or statefulset", parts[0])
+}
+
+func newEksWorkloadHandler(ctx context.Context, awsSession *session.Session, clusterName, workload, namespace string, checkInterval, checkTimeout int) (*eksWorkloadHandler, error) {
+	kind, name, err := parseWorkload(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := eks.New(awsSession).DescribeClusterWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return nil, err
+	}
+	caData, err := base64.StdEncoding.DecodeString(aws.StringValue(cluster.Cluster.CertificateAuthority.Data))
+	if err != nil {
+		return nil, fmt.Errorf("bad certificate authority for cluster %s. Error: %s", clusterName, err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificates found in the certificate authority of cluster %s", clusterName)
+	}
+
+	return &eksWorkloadHandler{
+		ctx:        ctx,
+		stsSession: sts.New(awsSession),
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		},
+		endpoint:      aws.StringValue(cluster.Cluster.Endpoint),
+		clusterName:   clusterName,
+		kind:          kind,
+		name:          name,
+		namespace:     namespace,
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+	}, nil
+}
+
+// token creates a bearer token for the cluster. Tokens only last 15 minutes so a new one is made for every request.
+func (eh *eksWorkloadHandler) token() (string, error) {
+	request, _ := eh.stsSession.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	request.HTTPRequest.Header.Add("x-k8s-aws-id", eh.clusterName)
+	presigned, err := request.Presign(60 * time.Second)
+	if err != nil {
+		return "", err
+	}
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned)), nil
+}
+
+func (eh *eksWorkloadHandler) getWorkload() (*kubernetesWorkload, error) {
+	token, err := eh.token()
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/apis/apps/v1/namespaces/%s/%s/%s", eh.endpoint, eh.namespace, eh.kind, eh.name)
+	request, err := http.NewRequestWithContext(eh.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := eh.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting %s/%s returned %s", eh.kind, eh.name, response.Status)
+	}
+	workload := &kubernetesWorkload{}
+	if err := json.NewDecoder(response.Body).Decode(workload); err != nil {
+		return nil, err
+	}
+	return workload, nil
+}
+
+// rolloutStatus works out if the rollout has finished the same way as kubectl rollout status.
+// An error is returned when the rollout will not finish on its own.
+func (eh *eksWorkloadHandler) rolloutStatus(workload *kubernetesWorkload) (string, bool, error) {
+	status := workload.Status
+	replicas := int64(1)
+	if workload.Spec.Replicas != nil {
+		replicas = *workload.Spec.Replicas
+	}
+	if workload.Metadata.Generation > status.ObservedGeneration {
+		return "waiting for the rollout to be observed", false, nil
+	}
+
+	if eh.kind == "statefulsets" {
+		if workload.Spec.UpdateStrategy.Type != "" && workload.Spec.UpdateStrategy.Type != "RollingUpdate" {
+			return fmt.Sprintf("update strategy %s can't be checked", workload.Spec.UpdateStrategy.Type), true, nil
+		}
+		if status.ReadyReplicas < replicas {
+			return fmt.Sprintf("%d of %d pods are ready", status.ReadyReplicas, replicas), false, nil
+		}
+		if rolling := workload.Spec.UpdateStrategy.RollingUpdate; rolling != nil && rolling.Partition != nil {
+			if status.UpdatedReplicas < replicas-*rolling.Partition {
+				return fmt.Sprintf("%d of %d pods are updated", status.UpdatedReplicas, replicas-*rolling.Partition), false, nil
+			}
+			return fmt.Sprintf("partitioned rollout has %d updated pods", status.UpdatedReplicas), true, nil
+		}
+		if status.UpdateRevision != status.CurrentRevision {
+			return fmt.Sprintf("%d of %d pods are updated", status.UpdatedReplicas, replicas), false, nil
+		}
+		return fmt.Sprintf("%d pods at revision %s", replicas, status.CurrentRevision), true, nil
+	}
+
+	for _, condition := range status.Conditions {
+		if condition.Type == "Progressing" && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %s exceeded its progress deadline", eh.name)
+		}
+	}
+	// A paused deployment does not roll out any further until it is resumed.
+	waiting := func(message string) (string, bool, error) {
+		if workload.Spec.Paused {
+			return "", false, fmt.Errorf("deployment %s is paused with %s, resume it with kubectl rollout resume", eh.name, message)
+		}
+		return message, false, nil
+	}
+	if status.UpdatedReplicas < replicas {
+		return waiting(fmt.Sprintf("%d of %d new replicas have been updated", status.UpdatedReplicas, replicas))
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return waiting(fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas))
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return waiting(fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas))
+	}
+	return fmt.Sprintf("%d replicas are available", status.AvailableReplicas), true, nil
+}
+
+// waitForRollout polls the workload until the rollout is finished or the timeout is reached.
+func (eh *eksWorkloadHandler) waitForRollout() error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(eh.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(eh.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	var progress progressLine
+	for {
+		workload, err := eh.getWorkload()
+		if err != nil {
+			return err
+		}
+		message, done, err := eh.rolloutStatus(workload)
+		if err != nil {
+			return err
+		}
+		if done {
+			logger.infof("Rollout of %s/%s is complete, %s.", eh.kind, eh.name, message)
+			return nil
+		}
+		progress.logf(logger, message, "Waiting another %d seconds for %s/%s, %s.", eh.checkInterval, eh.kind, eh.name, message)
+
+		select {
+		case <-checkTimer.C:
+		case <-eh.ctx.Done():
+			return eh.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for the rollout of %s/%s", eh.kind, eh.name)
+		}
+	}
+}
+
+// verifyEksWorkload is -platform eks. It waits for the rollout and runs the result hooks.
+func verifyEksWorkload(ctx context.Context, awsSession *session.Session) {
+	started := time.Now()
+	workload, err := newEksWorkloadHandler(ctx, awsSession, *flagClusterName, *flagWorkload, *flagNamespace, *flagCheckInterval, *flagTimeout)
+	if err != nil {
+		logger.errorf("There was an error connecting to the EKS cluster. Error: %s", err)
+		os.Exit(1)
+	}
+
+	logger.infof("Waiting for the rollout of %s in namespace %s.", *flagWorkload, *flagNamespace)
+	if err := workload.waitForRollout(); err != nil {
+		logger.errorf("The rollout did not complete. Error: %s", err)
+		exitWithResult(*flagWorkload, started, "failed", 1)
+	}
+	logger.infof("Workload looks good.")
+	exitWithResult(*flagWorkload, started, "success", 0)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRolloutStatus(t *testing.T) {
+	tests := map[string]struct {
+		kind     string
+		workload string
+		done     bool
+		fails    bool
+	}{
+		"observed generation lags": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 3}, "spec": {"replicas": 2}, "status": {"observedGeneration": 2, "replicas": 2, "updatedReplicas": 2, "availableReplicas": 2}}`,
+		},
+		"updated replicas missing": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 4, "updatedReplicas": 1, "availableReplicas": 3}}`,
+		},
+		"old replicas pending termination": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 4, "updatedReplicas": 3, "availableReplicas": 3}}`,
+		},
+		"updated replicas not available": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 3, "availableReplicas": 2, "unavailableReplicas": 1}}`,
+		},
+		"complete": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 3, "availableReplicas": 3}}`,
+			done:     true,
+		},
+		"replicas default to 1": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 1}, "status": {"observedGeneration": 1, "replicas": 1, "updatedReplicas": 1, "availableReplicas": 1}}`,
+			done:     true,
+		},
+		"scaled to zero": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 4}, "spec": {"replicas": 0}, "status": {"observedGeneration": 4}}`,
+			done:     true,
+		},
+		"progress deadline exceeded": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 1, "availableReplicas": 2, "conditions": [{"type": "Progressing", "reason": "ProgressDeadlineExceeded"}]}}`,
+			fails:    true,
+		},
+		"paused mid rollout": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3, "paused": true}, "status": {"observedGeneration": 2, "replicas": 4, "updatedReplicas": 1, "availableReplicas": 3}}`,
+			fails:    true,
+		},
+		"paused after the rollout": {
+			kind:     "deployments",
+			workload: `{"metadata": {"generation": 3}, "spec": {"replicas": 3, "paused": true}, "status": {"observedGeneration": 3, "replicas": 3, "updatedReplicas": 3, "availableReplicas": 3}}`,
+			done:     true,
+		},
+		"statefulset pods not ready": {
+			kind:     "statefulsets",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "readyReplicas": 2, "updatedReplicas": 3, "currentRevision": "db-1", "updateRevision": "db-2"}}`,
+		},
+		"statefulset revision not rolled out": {
+			kind:     "statefulsets",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "readyReplicas": 3, "updatedReplicas": 1, "currentRevision": "db-1", "updateRevision": "db-2"}}`,
+		},
+		"statefulset complete": {
+			kind:     "statefulsets",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "readyReplicas": 3, "updatedReplicas": 3, "currentRevision": "db-2", "updateRevision": "db-2"}}`,
+			done:     true,
+		},
+		"statefulset partition": {
+			kind:     "statefulsets",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3, "updateStrategy": {"type": "RollingUpdate", "rollingUpdate": {"partition": 2}}}, "status": {"observedGeneration": 2, "readyReplicas": 3, "updatedReplicas": 1, "currentRevision": "db-1", "updateRevision": "db-2"}}`,
+			done:     true,
+		},
+		"statefulset on delete": {
+			kind:     "statefulsets",
+			workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 3, "updateStrategy": {"type": "OnDelete"}}, "status": {"observedGeneration": 2}}`,
+			done:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			workload := &kubernetesWorkload{}
+			if err := json.Unmarshal([]byte(test.workload), workload); err != nil {
+				t.Fatal(err)
+			}
+			eh := &eksWorkloadHandler{kind: test.kind, name: "web"}
+			message, done, err := eh.rolloutStatus(workload)
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got %q", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != test.done {
+				t.Errorf("expected done to be %t, got %t with %q", test.done, done, message)
+			}
+		})
+	}
+}
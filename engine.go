@@ -0,0 +1,116 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// waiter returns the ecswait.Waiter that runs the checks of the wait with the settings of the
+// handler. The wait itself is the one of the package, the hooks keep the state of the handler up
+// to date and add the output that only the binary has.
+func (sh *serviceHandler) waiter() *ecswait.Waiter {
+	ignored := []string{}
+	for id := range sh.ignoredTargets {
+		ignored = append(ignored, id)
+	}
+	options := []ecswait.Option{
+		ecswait.WithClients(sh.session, sh.elbv2Session),
+		ecswait.WithInterval(time.Second * time.Duration(sh.checkInterval)),
+		// Every check has its own timeout instead, see phaseTimeout.
+		ecswait.WithTimeout(0),
+		ecswait.WithCheckTimeout(ecswait.CheckDeployment, sh.phaseTimeout(sh.deploymentTimeout)),
+		ecswait.WithCheckTimeout(ecswait.CheckRunningCount, sh.phaseTimeout(sh.countTimeout)),
+		ecswait.WithCheckTimeout(ecswait.CheckTargetHealth, sh.phaseTimeout(sh.healthTimeout)),
+		ecswait.WithCheckTimeout(ecswait.CheckMinRunning, sh.phaseTimeout(sh.healthTimeout)),
+		ecswait.WithStabilityWindow(sh.stabilityWindow),
+		ecswait.WithMaxFailedTasks(sh.maxFailedTasks),
+		ecswait.WithMinRunning(sh.minRunning),
+		ecswait.WithIgnoredTargets(ignored...),
+		ecswait.WithWakeUp(sh.wake),
+		ecswait.WithLeveledLogger(waitLogger{sh.log}),
+		ecswait.WithStateFormat(colorState),
+		ecswait.WithHooks(sh.waitHooks()),
+	}
+	for _, c := range sh.checkers {
+		options = append(options,
+			ecswait.WithCheckers(c),
+			ecswait.WithCheckTimeout(c.Name(), sh.phaseTimeout(sh.healthTimeout)),
+		)
+	}
+	if sh.waitState != nil && sh.waitState.DeploymentId != "" {
+		options = append(options, ecswait.WithDeployment(sh.waitState.DeploymentId))
+	}
+	return ecswait.New(sh.awsSession, aws.StringValue(sh.clusterName), aws.StringValue(sh.serviceName), options...)
+}
+
+// wait waits for the deployment and runs every check until the service is ready.
+func (sh *serviceHandler) wait() error {
+	_, err := sh.waiter().Wait(sh.ctx)
+	return err
+}
+
+// waitHooks keep the handler up to date with the wait, for the status, metrics, reports and the
+// state file, and print the trouble shooting information as the wait goes.
+func (sh *serviceHandler) waitHooks() ecswait.Hooks {
+	waitStarted := time.Now()
+	reportedActivities := map[string]bool{}
+	unhealthyChecks := 0
+	return ecswait.Hooks{
+		Described: func(service *ecs.Service) error {
+			sh.observe(service)
+			return sh.checkFailFast()
+		},
+		Deployment: sh.trackDeployment,
+		Phase:      sh.recordPhase,
+		DesiredCountChanged: func(from, to int64) {
+			if err := sh.printScalingActivitiesSince(waitStarted, reportedActivities); err != nil {
+				sh.log.errorf("There was an error listing the scaling activities. Error: %s", err)
+			}
+		},
+		TargetHealth: func(health ecswait.TargetHealth, active bool) {
+			sh.recordTargetHealth(health)
+			// Targets in the health check grace period are not a sign that something is wrong yet.
+			if !active || health.Healthy() || (len(health.Unhealthy) == 0 && len(health.InGracePeriod) > 0) {
+				return
+			}
+			unhealthyChecks++
+			// Only print the health check configuration once, when it looks like the targets are not going to recover on their own.
+			if unhealthyChecks == unhealthyChecksBeforeReport {
+				sh.log.infof("Targets are still unhealthy, here is the health check configuration.")
+				if err := sh.printHealthCheckReport(); err != nil {
+					sh.log.errorf("There was an error describing the health check configuration. Error: %s", err)
+				}
+			}
+		},
+		Waiting: func(state *ecswait.State) {
+			sh.whileWaiting(state)
+			sh.printEstimate()
+		},
+	}
+}
+
+// trackDeployment remembers the deployment the wait is for, in the state file too so an
+// interrupted wait carries on with the same deployment.
+func (sh *serviceHandler) trackDeployment(deploymentId string) {
+	if sh.waitState != nil {
+		if primary := sh.getActiveDeploymentId(); primary != deploymentId {
+			sh.log.infof("Resuming the wait for deployment %s, the current Primary deployment is %s.", deploymentId, primary)
+		}
+		sh.waitState.DeploymentId = deploymentId
+	}
+	sh.update(func() { sh.trackedDeployment = deploymentId })
+}
+
+// waitLogger logs the progress of the wait with the logger of the handler.
+type waitLogger struct {
+	log logPrinter
+}
+
+func (l waitLogger) Logf(format string, args ...interface{}) { l.log.infof(format, args...) }
+
+func (l waitLogger) Progressf(format string, args ...interface{}) { l.log.progressf(format, args...) }
+
+func (l waitLogger) Debugf(format string, args ...interface{}) { l.log.debugf(format, args...) }
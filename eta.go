@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// startRateWindow is how far back the task start rate is measured. Older samples are dropped so
+// the estimate follows the current pace rather than a slow start.
+const startRateWindow = 5 * time.Minute
+
+// rateSample is the running count of the deployment at a point in time.
+type rateSample struct {
+	at      time.Time
+	running int64
+}
+
+// watchedDeployment returns the deployment being waited for, see failingDeploymentId.
+func (sh *serviceHandler) watchedDeployment() *ecs.Deployment {
+	id := sh.failingDeploymentId()
+	for _, deployment := range sh.currentOutput.Deployments {
+		if aws.StringValue(deployment.Id) == id {
+			return deployment
+		}
+	}
+	return nil
+}
+
+// observeStartRate samples the running count of the watched deployment.
+func (sh *serviceHandler) observeStartRate() {
+	deployment := sh.watchedDeployment()
+	if deployment == nil {
+		return
+	}
+	now := time.Now()
+	sh.startRate = append(sh.startRate, rateSample{at: now, running: aws.Int64Value(deployment.RunningCount)})
+	for len(sh.startRate) > 2 && now.Sub(sh.startRate[0].at) > startRateWindow {
+		sh.startRate = sh.startRate[1:]
+	}
+}
+
+// estimateCompletion estimates how long the remaining tasks of the watched deployment take to be
+// running at the rate tasks went from PENDING to RUNNING recently. ok is false when there
+// is nothing left to start or no task started within the window.
+func (sh *serviceHandler) estimateCompletion() (remaining int64, eta time.Duration, ok bool) {
+	deployment := sh.watchedDeployment()
+	if deployment == nil || len(sh.startRate) < 2 {
+		return 0, 0, false
+	}
+	remaining = aws.Int64Value(deployment.DesiredCount) - aws.Int64Value(deployment.RunningCount)
+	first, last := sh.startRate[0], sh.startRate[len(sh.startRate)-1]
+	started := last.running - first.running
+	if remaining <= 0 || started <= 0 {
+		return remaining, 0, false
+	}
+	perTask := last.at.Sub(first.at) / time.Duration(started)
+	return remaining, perTask * time.Duration(remaining), true
+}
+
+// printEstimate prints when the remaining tasks are expected to be running.
+func (sh *serviceHandler) printEstimate() {
+	remaining, eta, ok := sh.estimateCompletion()
+	if !ok {
+		if remaining > 0 {
+			sh.log.debugf("No tasks started in the last %s, can't estimate when the %d remaining tasks will be running.", startRateWindow, remaining)
+		}
+		return
+	}
+	sh.log.progressf("At the current rate, %d remaining tasks will be running in ~%s.", remaining, roundEstimate(eta))
+}
+
+// roundEstimate rounds to a precision that doesn't pretend the estimate is exact.
+func roundEstimate(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(10 * time.Second)
+	}
+	return d.Round(time.Minute)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const (
+	eventActionFail   = "fail"
+	eventActionWarn   = "warn"
+	eventActionNotify = "notify"
+)
+
+// eventTrigger is an action to take when a service event matches the pattern.
+type eventTrigger struct {
+	pattern *regexp.Regexp
+	action  string
+}
+
+// builtinEventTriggers match service events that mean the deployment is not going to converge
+// on its own, so waiting until the timeout is pointless.
+var builtinEventTriggers = []eventTrigger{
+	{regexp.MustCompile(`was unable to place a task`), eventActionFail},
+	{regexp.MustCompile(`is unable to consistently start tasks successfully`), eventActionFail},
+	{regexp.MustCompile(`(?i)CannotPullContainerError.*(pull access denied|no basic auth credentials|unauthorized|authorization)`), eventActionFail},
+}
+
+// setNotifyWebhook sets where notify event triggers send their messages.
+func (sh *serviceHandler) setNotifyWebhook(url string) {
+	sh.notifyWebhook = url
+}
+
+// setEventTriggers sets the triggers that are checked against new service events while waiting.
+func (sh *serviceHandler) setEventTriggers(triggers []eventTrigger) {
+	sh.eventTriggers = triggers
+}
+
+// checkEventTriggers runs the event triggers against service events created since the PRIMARY
+// deployment started. Each event is only looked at once. An error is returned for the first
+// event that matches a fail trigger.
+func (sh *serviceHandler) checkEventTriggers() error {
+	if len(sh.eventTriggers) == 0 {
+		return nil
+	}
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return nil
+	}
+	if sh.seenEvents == nil {
+		sh.update(func() { sh.seenEvents = map[string]bool{} })
+	}
+
+	// Events are newest first, walk them oldest first so they are reported in order.
+	events := sh.currentOutput.Events
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if sh.seenEvents[aws.StringValue(event.Id)] || aws.TimeValue(event.CreatedAt).Before(aws.TimeValue(deployment.CreatedAt)) {
+			continue
+		}
+		sh.update(func() { sh.seenEvents[aws.StringValue(event.Id)] = true })
+
+		message := aws.StringValue(event.Message)
+		for _, trigger := range sh.eventTriggers {
+			if !trigger.pattern.MatchString(message) {
+				continue
+			}
+			switch trigger.action {
+			case eventActionFail:
+				return fmt.Errorf("fatal service event: %s", message)
+			case eventActionWarn:
+				sh.log.warnf("service event: %s", message)
+			case eventActionNotify:
+				sh.log.infof("Sending notification for service event: %s", message)
+				if err := sendNotification(sh.notifyWebhook, fmt.Sprintf("%s: %s", aws.StringValue(sh.serviceName), message)); err != nil {
+					sh.log.errorf("There was an error sending the notification. Error: %s", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// eventSummary is a service event message with when it was first and last seen.
+type eventSummary struct {
+	message string
+	count   int
+	first   time.Time
+	last    time.Time
+}
+
+// summarizeEvents collapses repeated identical messages into one summary each. ECS repeats some
+// events, like tasks that can't be placed, every few minutes. The events and the summaries are
+// newest first.
+func summarizeEvents(events []*ecs.ServiceEvent) []*eventSummary {
+	summaries := []*eventSummary{}
+	byMessage := map[string]*eventSummary{}
+	for _, event := range events {
+		message := aws.StringValue(event.Message)
+		created := aws.TimeValue(event.CreatedAt)
+		summary, ok := byMessage[message]
+		if !ok {
+			summary = &eventSummary{message: message, last: created}
+			byMessage[message] = summary
+			summaries = append(summaries, summary)
+		}
+		summary.count++
+		summary.first = created
+	}
+	return summaries
+}
+
+// sendNotification posts the message to a webhook as {"text": message}, which is understood
+// by Slack and Microsoft Teams incoming webhooks.
+func sendNotification(url, message string) error {
+	body, err := json.Marshal(map[string]string{"text": message})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -1,7 +1,14 @@
 module github.com/morfien101/are-we-there-yet
 
-go 1.17
+go 1.21
 
-require github.com/aws/aws-sdk-go v1.43.13
+require (
+	github.com/aws/aws-sdk-go v1.44.200
+	go.etcd.io/bbolt v1.3.7
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+)
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// credentialRetryInterval is how long to wait before validating the AWS credentials again.
+const credentialRetryInterval = 10 * time.Second
+
+// validateCredentials keeps calling STS until the AWS credentials work, then marks the server ready.
+func (srv *server) validateCredentials(ctx context.Context, awsSession *session.Session) {
+	client := sts.New(awsSession)
+	for {
+		_, err := client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		srv.lock.Lock()
+		srv.ready = err == nil
+		srv.notReadyReason = ""
+		if err != nil {
+			srv.notReadyReason = fmt.Sprintf("AWS credentials are not valid: %s", err)
+		}
+		srv.lock.Unlock()
+		if err == nil {
+			return
+		}
+		logger.debugf("The AWS credentials are not valid yet, trying again in %s. Error: %s", credentialRetryInterval, err)
+		if sleepContext(ctx, credentialRetryInterval) != nil {
+			return
+		}
+	}
+}
+
+// handleHealthz is the liveness check. If we can answer, we are alive.
+func (srv *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz is the readiness check. We are ready once the AWS credentials have been validated.
+func (srv *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	ready, reason := srv.ready, srv.notReadyReason
+	srv.lock.Unlock()
+	if !ready {
+		if reason == "" {
+			reason = "AWS credentials have not been validated yet"
+		}
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	historyBucket    = "runs"
+	historyKeyLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// historyRecord is what is kept in the history database about a run.
+type historyRecord struct {
+	Cluster      string        `json:"cluster"`
+	Service      string        `json:"service"`
+	DeploymentId string        `json:"deployment_id"`
+	Result       string        `json:"result"`
+	Started      time.Time     `json:"started"`
+	Duration     time.Duration `json:"duration"`
+	Phases       []phaseTiming `json:"phases"`
+	// Transitions are the task startup percentiles, to spot startup regressions across deploys.
+	Transitions []transitionStats `json:"transitions,omitempty"`
+}
+
+func openHistory(path string) (*bolt.DB, error) {
+	// Don't hang forever when another run has the database open.
+	return bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+}
+
+// historyKey sorts the runs of a service by the time they started.
+func historyKey(record historyRecord) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s", record.Cluster, record.Service, record.Started.UTC().Format(historyKeyLayout)))
+}
+
+// saveHistory adds a run to the history database.
+func saveHistory(path string, record historyRecord) error {
+	db, err := openHistory(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(historyBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(historyKey(record), content)
+	})
+}
+
+// loadHistory returns the runs in the history database, oldest first. Empty cluster or service
+// names match every cluster or service.
+func loadHistory(path, cluster, service string) ([]historyRecord, error) {
+	db, err := openHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	records := []historyRecord{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(historyBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			record := historyRecord{}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("bad history record %s. Error: %s", key, err)
+			}
+			if (cluster == "" || record.Cluster == cluster) && (service == "" || record.Service == service) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].Started.Before(records[j].Started) })
+	return records, err
+}
+
+// recordHistory saves the result of this run to the -history-db, if there is one.
+func recordHistory(ecsService *serviceHandler, result string) {
+	if *flagHistoryDb == "" {
+		return
+	}
+	ecsService.finishPhase()
+	record := historyRecord{
+		Cluster:      *flagClusterName,
+		Service:      *flagServiceName,
+		DeploymentId: ecsService.trackedDeployment,
+		Result:       result,
+		Started:      ecsService.started,
+		Duration:     time.Since(ecsService.started),
+		Phases:       ecsService.phaseTimings,
+		Transitions:  ecsService.transitionSummary(),
+	}
+	if err := saveHistory(*flagHistoryDb, record); err != nil {
+		ecsService.log.errorf("There was an error saving the run to the history. Error: %s", err)
+	}
+}
+
+// runHistory is the history subcommand. It prints the recorded runs as a table.
+func runHistory(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	dbPath := flags.String("history-db", "", "Path to the history database")
+	cluster := flags.String("cluster", "", "Only show runs for this cluster")
+	service := flags.String("service", "", "Only show runs for this service")
+	limit := flags.Int("n", 20, "Show this many of the most recent runs. 0 shows all of them")
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+
+	if *dbPath == "" {
+		logger.errorf("-history-db is required.")
+		os.Exit(1)
+	}
+	records, err := loadHistory(*dbPath, *cluster, *service)
+	if err != nil {
+		logger.errorf("There was an error reading the history. Error: %s", err)
+		os.Exit(1)
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+	if len(records) == 0 {
+		fmt.Println("No runs found.")
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "STARTED\tCLUSTER\tSERVICE\tDEPLOYMENT\tRESULT\tDURATION\tPHASES")
+	for _, record := range records {
+		phases := []string{}
+		for _, phase := range record.Phases {
+			phases = append(phases, fmt.Sprintf("%s=%s", phase.Name, phase.Duration.Round(time.Second)))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Started.Format(time.RFC3339),
+			record.Cluster,
+			record.Service,
+			record.DeploymentId,
+			record.Result,
+			record.Duration.Round(time.Second),
+			strings.Join(phases, ", "),
+		)
+	}
+	table.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// runHook runs a user provided command through the shell with extra environment variables.
+// The output of the command goes straight to ours. The command is killed when the context is done.
+func runHook(ctx context.Context, command string, env map[string]string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for name, value := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, value))
+	}
+	return cmd.Run()
+}
+
+// runSuccessHook runs the -on-success-cmd within the -smoke-timeout, if there is one.
+func runSuccessHook(ctx context.Context, command string, env map[string]string) error {
+	if *flagSmokeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *flagSmokeTimeout)
+		defer cancel()
+	}
+	err := runHook(ctx, command, env)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("stopped after %s. Error: %s", *flagSmokeTimeout, err)
+	}
+	return err
+}
+
+// resultEnv is the environment given to the -on-success-cmd and -on-failure-cmd hooks.
+func (sh *serviceHandler) resultEnv(result string) map[string]string {
+	return map[string]string{
+		"AWTY_RESULT":        result,
+		"AWTY_CLUSTER":       aws.StringValue(sh.clusterName),
+		"AWTY_SERVICE":       aws.StringValue(sh.serviceName),
+		"AWTY_DEPLOYMENT_ID": sh.trackedDeployment,
+		"AWTY_DURATION":      strconv.Itoa(int(time.Since(sh.started).Seconds())),
+	}
+}
+
+// deploymentEnv is the environment given to the -pre-cmd hook, it describes the deployment we are about to wait for.
+func (sh *serviceHandler) deploymentEnv() map[string]string {
+	env := map[string]string{
+		"AWTY_CLUSTER":         aws.StringValue(sh.clusterName),
+		"AWTY_SERVICE":         aws.StringValue(sh.serviceName),
+		"AWTY_DESIRED_COUNT":   strconv.FormatInt(aws.Int64Value(sh.currentOutput.DesiredCount), 10),
+		"AWTY_TASK_DEFINITION": aws.StringValue(sh.currentOutput.TaskDefinition),
+	}
+	if deployment := sh.primaryDeployment(); deployment != nil {
+		env["AWTY_DEPLOYMENT_ID"] = aws.StringValue(deployment.Id)
+		env["AWTY_TASK_DEFINITION"] = aws.StringValue(deployment.TaskDefinition)
+	}
+	return env
+}
+
+// exitWithResult runs the -on-success-cmd or -on-failure-cmd hook for platforms other than ECS services and exits.
+func exitWithResult(name string, started time.Time, result string, code int) {
+	command, run := *flagOnSuccessCmd, runSuccessHook
+	if result != "success" {
+		command, run = *flagOnFailureCmd, runHook
+	}
+	if command != "" {
+		env := map[string]string{
+			"AWTY_RESULT":   result,
+			"AWTY_CLUSTER":  *flagClusterName,
+			"AWTY_SERVICE":  name,
+			"AWTY_DURATION": strconv.Itoa(int(time.Since(started).Seconds())),
+		}
+		if err := run(context.Background(), command, env); err != nil {
+			logger.errorf("The on %s command failed. Error: %s", result, err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+var ecrRegistryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?(?::\d+)?$`)
+
+// ecrImage is a container image reference that points at an ECR repository.
+type ecrImage struct {
+	image      string
+	registryId string
+	region     string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseEcrImage splits an image reference into its ECR parts.
+// Images hosted anywhere else return false.
+func parseEcrImage(image string) (ecrImage, bool) {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) != 2 {
+		return ecrImage{}, false
+	}
+	match := ecrRegistryPattern.FindStringSubmatch(parts[0])
+	if match == nil {
+		return ecrImage{}, false
+	}
+
+	ref := ecrImage{image: image, registryId: match[1], region: match[2]}
+	repository := parts[1]
+	if at := strings.Index(repository, "@"); at >= 0 {
+		ref.digest = repository[at+1:]
+		repository = repository[:at]
+	}
+	if colon := strings.LastIndex(repository, ":"); colon >= 0 {
+		ref.tag = repository[colon+1:]
+		repository = repository[:colon]
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+	ref.repository = repository
+	return ref, true
+}
+
+// resolvedImage is a container image with the digest that ECR resolved it to.
+type resolvedImage struct {
+	container string
+	image     string
+	digest    string
+	ref       ecrImage
+}
+
+// checkImages makes sure that every ECR image in the task definition exists and resolves
+// the digest that it currently points to. Images outside of ECR are not checked.
+func (sh *serviceHandler) checkImages() ([]resolvedImage, error) {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []resolvedImage{}
+	problems := []string{}
+	for _, container := range td.ContainerDefinitions {
+		image := aws.StringValue(container.Image)
+		ref, ok := parseEcrImage(image)
+		if !ok {
+			sh.log.infof("Image %s for container %s is not in ECR and is not checked.", image, aws.StringValue(container.Name))
+			continue
+		}
+
+		imageId := &ecr.ImageIdentifier{}
+		if ref.digest != "" {
+			imageId.ImageDigest = aws.String(ref.digest)
+		} else {
+			imageId.ImageTag = aws.String(ref.tag)
+		}
+		output, err := sh.ecrClient(ref.region).DescribeImagesWithContext(sh.ctx, &ecr.DescribeImagesInput{
+			RegistryId:     aws.String(ref.registryId),
+			RepositoryName: aws.String(ref.repository),
+			ImageIds:       []*ecr.ImageIdentifier{imageId},
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s image %s: %s", aws.StringValue(container.Name), image, err))
+			continue
+		}
+		if len(output.ImageDetails) == 0 {
+			problems = append(problems, fmt.Sprintf("%s image %s: image not found", aws.StringValue(container.Name), image))
+			continue
+		}
+
+		digest := aws.StringValue(output.ImageDetails[0].ImageDigest)
+		sh.log.infof("Image %s for container %s resolves to %s.", image, aws.StringValue(container.Name), digest)
+		resolved = append(resolved, resolvedImage{
+			container: aws.StringValue(container.Name),
+			image:     image,
+			digest:    digest,
+			ref:       ref,
+		})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("images can't be pulled:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return resolved, nil
+}
+
+// checkRunningDigests makes sure the RUNNING tasks of the PRIMARY deployment are using the
+// digests that were resolved before the wait. A tag that is moved during the deployment
+// would otherwise leave tasks running different code.
+func (sh *serviceHandler) checkRunningDigests(pinned []resolvedImage) error {
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+	tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	expected := map[string]string{}
+	for _, image := range pinned {
+		expected[image.container] = image.digest
+	}
+
+	for _, task := range tasks {
+		for _, container := range task.Containers {
+			digest, ok := expected[aws.StringValue(container.Name)]
+			if !ok || container.ImageDigest == nil {
+				continue
+			}
+			if aws.StringValue(container.ImageDigest) != digest {
+				return fmt.Errorf(
+					"container %s in task %s is running %s, expected %s",
+					aws.StringValue(container.Name),
+					aws.StringValue(task.TaskArn),
+					aws.StringValue(container.ImageDigest),
+					digest,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// ecrClient returns an ECR client for the region that the registry lives in.
+func (sh *serviceHandler) ecrClient(region string) *ecr.ECR {
+	return ecr.New(sh.awsSession, aws.NewConfig().WithRegion(region))
+}
+
+// checkScanFindings fails if any of the images has more CRITICAL scan findings than allowed.
+// Scans that are still running are waited on. Images in repositories without scanning fail too.
+func (sh *serviceHandler) checkScanFindings(images []resolvedImage, maxCritical int64) error {
+	problems := []string{}
+	for _, image := range images {
+		client := sh.ecrClient(image.ref.region)
+		input := &ecr.DescribeImageScanFindingsInput{
+			RegistryId:     aws.String(image.ref.registryId),
+			RepositoryName: aws.String(image.ref.repository),
+			ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String(image.digest)},
+		}
+
+		// Without scanning there is no scan to wait for, the waiter would retry until it gives up.
+		output, err := client.DescribeImageScanFindingsWithContext(sh.ctx, input)
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == ecr.ErrCodeScanNotFoundException {
+			problems = append(problems, fmt.Sprintf("%s image %s: scanning not enabled on repository %s", image.container, image.image, image.ref.repository))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if output.ImageScanStatus == nil || aws.StringValue(output.ImageScanStatus.Status) != ecr.ScanStatusComplete {
+			if err := client.WaitUntilImageScanCompleteWithContext(sh.ctx, input); err != nil {
+				problems = append(problems, fmt.Sprintf("%s image %s: scan did not complete. Error: %s", image.container, image.image, err))
+				continue
+			}
+			if output, err = client.DescribeImageScanFindingsWithContext(sh.ctx, input); err != nil {
+				return err
+			}
+		}
+
+		critical := int64(0)
+		if output.ImageScanFindings != nil {
+			critical = aws.Int64Value(output.ImageScanFindings.FindingSeverityCounts[ecr.FindingSeverityCritical])
+		}
+		if critical > maxCritical {
+			problems = append(problems, fmt.Sprintf("%s image %s has %d CRITICAL findings, the maximum allowed is %d", image.container, image.image, critical, maxCritical))
+			continue
+		}
+		sh.log.infof("Image %s for container %s has %d CRITICAL findings.", image.image, image.container, critical)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("image scan gate failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
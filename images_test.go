@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func TestParseEcrImage(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := map[string]struct {
+		image    string
+		expected ecrImage
+		ok       bool
+	}{
+		"tag": {
+			image:    "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web:1.2.3",
+			expected: ecrImage{registryId: "123456789012", region: "eu-west-1", repository: "web", tag: "1.2.3"},
+			ok:       true,
+		},
+		"no tag is latest": {
+			image:    "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web",
+			expected: ecrImage{registryId: "123456789012", region: "eu-west-1", repository: "web", tag: "latest"},
+			ok:       true,
+		},
+		"digest": {
+			image:    "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web@" + digest,
+			expected: ecrImage{registryId: "123456789012", region: "eu-west-1", repository: "web", digest: digest},
+			ok:       true,
+		},
+		"tag and digest": {
+			image:    "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web:1.2.3@" + digest,
+			expected: ecrImage{registryId: "123456789012", region: "eu-west-1", repository: "web", tag: "1.2.3", digest: digest},
+			ok:       true,
+		},
+		"nested repository": {
+			image:    "123456789012.dkr.ecr.us-east-1.amazonaws.com/team/web:main",
+			expected: ecrImage{registryId: "123456789012", region: "us-east-1", repository: "team/web", tag: "main"},
+			ok:       true,
+		},
+		"registry port": {
+			image:    "123456789012.dkr.ecr.us-east-1.amazonaws.com:443/web:main",
+			expected: ecrImage{registryId: "123456789012", region: "us-east-1", repository: "web", tag: "main"},
+			ok:       true,
+		},
+		"registry port without a tag": {
+			image:    "123456789012.dkr.ecr.us-east-1.amazonaws.com:443/web",
+			expected: ecrImage{registryId: "123456789012", region: "us-east-1", repository: "web", tag: "latest"},
+			ok:       true,
+		},
+		"fips endpoint": {
+			image:    "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com/web:main",
+			expected: ecrImage{registryId: "123456789012", region: "us-gov-west-1", repository: "web", tag: "main"},
+			ok:       true,
+		},
+		"china": {
+			image:    "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn/web:main",
+			expected: ecrImage{registryId: "123456789012", region: "cn-north-1", repository: "web", tag: "main"},
+			ok:       true,
+		},
+		"docker hub": {
+			image: "nginx:1.25",
+		},
+		"docker hub organisation": {
+			image: "library/nginx:1.25",
+		},
+		"other registry": {
+			image: "ghcr.io/org/web:main",
+		},
+		"other registry with a port": {
+			image: "registry.example.com:5000/web:main",
+		},
+		"public ecr": {
+			image: "public.ecr.aws/nginx/nginx:1.25",
+		},
+		"short account": {
+			image: "12345.dkr.ecr.eu-west-1.amazonaws.com/web:main",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := parseEcrImage(test.image)
+			if ok != test.ok {
+				t.Fatalf("expected ok %t, got %t", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			test.expected.image = test.image
+			if got != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
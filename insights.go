@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+const containerInsightsNamespace = "ECS/ContainerInsights"
+
+// checkResourceHeadroom watches the service CPU and memory utilization from Container Insights
+// for the window and fails if either goes over its threshold. A threshold of 0 is not checked.
+// Services that are healthy but immediately starved of resources are caught by this.
+func (sh *serviceHandler) checkResourceHeadroom(window time.Duration, maxCpu, maxMemory float64) error {
+	clusterArn := aws.StringValue(sh.currentOutput.ClusterArn)
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("ClusterName"), Value: aws.String(clusterArn[strings.LastIndex(clusterArn, "/")+1:])},
+		{Name: aws.String("ServiceName"), Value: sh.currentOutput.ServiceName},
+	}
+	metric := func(id, name string) *cloudwatch.MetricDataQuery {
+		return &cloudwatch.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String(containerInsightsNamespace),
+					MetricName: aws.String(name),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int64(60),
+				Stat:   aws.String(cloudwatch.StatisticAverage),
+			},
+			ReturnData: aws.Bool(false),
+		}
+	}
+	expression := func(id, expr string) *cloudwatch.MetricDataQuery {
+		return &cloudwatch.MetricDataQuery{
+			Id:         aws.String(id),
+			Expression: aws.String(expr),
+			ReturnData: aws.Bool(true),
+		}
+	}
+
+	start := time.Now()
+	sh.log.infof("Watching CPU and memory utilization for %s.", window)
+	if err := sleepContext(sh.ctx, window); err != nil {
+		return err
+	}
+
+	output, err := sh.cloudwatchSession.GetMetricDataWithContext(sh.ctx, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(start),
+		EndTime:   aws.Time(time.Now()),
+		MetricDataQueries: []*cloudwatch.MetricDataQuery{
+			metric("cpuUtilized", "CpuUtilized"),
+			metric("cpuReserved", "CpuReserved"),
+			metric("memoryUtilized", "MemoryUtilized"),
+			metric("memoryReserved", "MemoryReserved"),
+			expression("cpu", "100 * cpuUtilized / cpuReserved"),
+			expression("memory", "100 * memoryUtilized / memoryReserved"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	thresholds := map[string]float64{"cpu": maxCpu, "memory": maxMemory}
+	problems := []string{}
+	for _, result := range output.MetricDataResults {
+		id := aws.StringValue(result.Id)
+		if len(result.Values) == 0 {
+			sh.log.warnf("no %s utilization data found, is Container Insights enabled on the cluster?", id)
+			continue
+		}
+		peak := 0.0
+		for _, value := range aws.Float64ValueSlice(result.Values) {
+			if value > peak {
+				peak = value
+			}
+		}
+		sh.log.infof("Peak %s utilization was %.1f%%.", id, peak)
+		if thresholds[id] > 0 && peak > thresholds[id] {
+			problems = append(problems, fmt.Sprintf("%s utilization peaked at %.1f%%, the maximum is %.1f%%", id, peak, thresholds[id]))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("not enough headroom: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
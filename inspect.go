@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// inspectCommand is a subcommand that looks at a service once instead of waiting for it.
+type inspectCommand struct {
+	flags    *flag.FlagSet
+	cluster  *string
+	service  *string
+	region   *string
+	debugAws *bool
+	logFlags logOptions
+}
+
+func newInspectCommand(name, example string) *inspectCommand {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	ic := &inspectCommand{
+		flags:    flags,
+		cluster:  flags.String("cluster", "", "Cluster of the service"),
+		service:  flags.String("service", "", "Service to look at"),
+		region:   flags.String("region", "", regionUsage),
+		debugAws: flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID"),
+		logFlags: addLogFlags(flags),
+	}
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s\n", example)
+		flags.PrintDefaults()
+	}
+	return ic
+}
+
+// handler parses the arguments and describes the service. It exits when that does not work.
+func (ic *inspectCommand) handler(ctx context.Context, args []string) *serviceHandler {
+	ic.flags.Parse(args)
+	setupLogging(ic.logFlags, false)
+	if *ic.service == "" {
+		ic.flags.Usage()
+		os.Exit(1)
+	}
+	awsSession, err := newAwsSession(*ic.region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *ic.debugAws {
+		debugAwsRequests(awsSession)
+	}
+	sh := newServiceHandler(ctx, awsSession, *ic.service, *ic.cluster, *flagCheckInterval, *flagTimeout)
+	if err := sh.refresh(); err != nil {
+		logger.errorf("There was an error describing the service. Error: %s", err)
+		os.Exit(1)
+	}
+	return sh
+}
+
+// runStatus is the status subcommand. It exits 1 when the service is not stable or its targets
+// are not healthy, so it can be used as a check on its own.
+func runStatus(ctx context.Context, args []string) {
+	ic := newInspectCommand("status", "are-we-there-yet status -cluster production -service web")
+	checkTargets := ic.flags.Bool("targets", true, "Check the health of the targets of the first target group")
+	sh := ic.handler(ctx, args)
+	service := sh.currentOutput
+
+	fmt.Printf("Service %s in cluster %s is %s. Desired: %d, running: %d and pending: %d.\n",
+		aws.StringValue(service.ServiceName),
+		*ic.cluster,
+		colorState(rolloutSummary(service)),
+		aws.Int64Value(service.DesiredCount),
+		aws.Int64Value(service.RunningCount),
+		aws.Int64Value(service.PendingCount),
+	)
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "DEPLOYMENT\tSTATUS\t%s\tTASK DEFINITION\tDESIRED\tRUNNING\tPENDING\tFAILED\tCREATED\n", colorCell("ROLLOUT", ""))
+	for _, deployment := range service.Deployments {
+		taskDefinition := aws.StringValue(deployment.TaskDefinition)
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			aws.StringValue(deployment.Id),
+			aws.StringValue(deployment.Status),
+			colorStateCell(aws.StringValue(deployment.RolloutState)),
+			taskDefinition[strings.LastIndex(taskDefinition, "/")+1:],
+			aws.Int64Value(deployment.DesiredCount),
+			aws.Int64Value(deployment.RunningCount),
+			aws.Int64Value(deployment.PendingCount),
+			aws.Int64Value(deployment.FailedTasks),
+			aws.TimeValue(deployment.CreatedAt).Local().Format(eventTimeFormat),
+		)
+	}
+	table.Flush()
+
+	healthy := true
+	if *checkTargets && len(service.LoadBalancers) > 0 {
+		var err error
+		healthy, err = sh.checkTargetGroup()
+		if err != nil {
+			logger.errorf("The target health check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		if healthy {
+			fmt.Println("Every target is healthy.")
+		} else {
+			fmt.Printf("%d targets are unhealthy and %d are in their health check grace period.\n", sh.unhealthyTargets, sh.targetsInGrace)
+		}
+	}
+	if !healthy || !ecswait.Stable(service) {
+		os.Exit(1)
+	}
+}
+
+// runEvents is the events subcommand.
+func runEvents(ctx context.Context, args []string) {
+	ic := newInspectCommand("events", "are-we-there-yet events -cluster production -service web -n 20")
+	count := ic.flags.Int("n", 10, "Maximum number of events to show")
+	sinceDeployment := ic.flags.Bool("since-deployment", false, "Only show the events created after the PRIMARY deployment started")
+	sh := ic.handler(ctx, args)
+	if err := sh.printLastNEvents(*count, *sinceDeployment); err != nil {
+		logger.errorf("There was an error listing the events. Error: %s", err)
+		os.Exit(1)
+	}
+}
+
+// runTasks is the tasks subcommand.
+func runTasks(ctx context.Context, args []string) {
+	ic := newInspectCommand("tasks", "are-we-there-yet tasks -cluster production -service web -logs")
+	count := ic.flags.Int("n", 5, "Maximum number of STOPPED tasks to show")
+	withLogs := ic.flags.Bool("logs", false, "Also show the last log lines of the containers of the STOPPED tasks")
+	running := ic.flags.Bool("running", false, "Also show the RUNNING and PENDING tasks of the PRIMARY deployment")
+	sh := ic.handler(ctx, args)
+	if *running {
+		fmt.Println("RUNNING and PENDING tasks of the deployment:")
+		if err := sh.printDeploymentTasks(); err != nil {
+			logger.errorf("There was an error listing the RUNNING tasks. Error: %s", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("STOPPED tasks, showing maximum %d:\n", *count)
+	if err := sh.printLastNTasks(*count, *withLogs); err != nil {
+		logger.errorf("There was an error listing the STOPPED tasks. Error: %s", err)
+		os.Exit(1)
+	}
+}
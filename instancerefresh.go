@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+)
+
+// instanceRefreshHandler waits for the latest instance refresh of an EC2 Auto Scaling group to finish.
+type instanceRefreshHandler struct {
+	ctx           context.Context
+	session       *autoscaling.AutoScaling
+	groupName     *string
+	checkInterval int
+	checkTimeout  int
+	instanceState map[string]string
+}
+
+func newInstanceRefreshHandler(ctx context.Context, awsSession *session.Session, groupName string, checkInterval, checkTimeout int) *instanceRefreshHandler {
+	return &instanceRefreshHandler{
+		ctx:           ctx,
+		session:       autoscaling.New(awsSession),
+		groupName:     aws.String(groupName),
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+		instanceState: map[string]string{},
+	}
+}
+
+// latestRefresh returns the most recent instance refresh of the group. They are listed newest first.
+func (ih *instanceRefreshHandler) latestRefresh() (*autoscaling.InstanceRefresh, error) {
+	output, err := ih.session.DescribeInstanceRefreshesWithContext(ih.ctx, &autoscaling.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: ih.groupName,
+		MaxRecords:           aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.InstanceRefreshes) == 0 {
+		return nil, fmt.Errorf("no instance refreshes found for %s", aws.StringValue(ih.groupName))
+	}
+	return output.InstanceRefreshes[0], nil
+}
+
+// printInstanceChanges prints the instances of the group whose state changed since the last check.
+func (ih *instanceRefreshHandler) printInstanceChanges() error {
+	output, err := ih.session.DescribeAutoScalingGroupsWithContext(ih.ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{ih.groupName},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.AutoScalingGroups) == 0 {
+		return fmt.Errorf("auto scaling group %s not found", aws.StringValue(ih.groupName))
+	}
+
+	current := map[string]string{}
+	for _, instance := range output.AutoScalingGroups[0].Instances {
+		id := aws.StringValue(instance.InstanceId)
+		version := ""
+		if instance.LaunchTemplate != nil {
+			version = fmt.Sprintf(", launch template version %s", aws.StringValue(instance.LaunchTemplate.Version))
+		}
+		state := fmt.Sprintf("%s and %s%s", aws.StringValue(instance.LifecycleState), aws.StringValue(instance.HealthStatus), version)
+		current[id] = state
+		if ih.instanceState[id] != state {
+			logger.infof("Instance %s is %s.", id, state)
+		}
+	}
+	for id := range ih.instanceState {
+		if _, ok := current[id]; !ok {
+			logger.infof("Instance %s has left the group.", id)
+		}
+	}
+	ih.instanceState = current
+	return nil
+}
+
+// waitForRefresh waits for the latest instance refresh to be Successful.
+func (ih *instanceRefreshHandler) waitForRefresh() error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(ih.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(ih.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	var progress progressLine
+	for {
+		refresh, err := ih.latestRefresh()
+		if err != nil {
+			return err
+		}
+		if err := ih.printInstanceChanges(); err != nil {
+			return err
+		}
+
+		id := aws.StringValue(refresh.InstanceRefreshId)
+		status := aws.StringValue(refresh.Status)
+		switch {
+		case status == autoscaling.InstanceRefreshStatusSuccessful:
+			logger.infof("Instance refresh %s is %s.", id, status)
+			return nil
+		case status == autoscaling.InstanceRefreshStatusFailed, status == autoscaling.InstanceRefreshStatusCancelling, status == autoscaling.InstanceRefreshStatusCancelled, strings.HasPrefix(status, "Rollback"):
+			return fmt.Errorf("instance refresh %s is %s. Reason: %s", id, status, aws.StringValue(refresh.StatusReason))
+		}
+		progress.logf(logger, status, "Waiting another %d seconds for instance refresh %s, %s and %d%% complete with %d instances to update.",
+			ih.checkInterval, id, status, aws.Int64Value(refresh.PercentageComplete), aws.Int64Value(refresh.InstancesToUpdate))
+
+		select {
+		case <-checkTimer.C:
+		case <-ih.ctx.Done():
+			return ih.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for instance refresh %s", id)
+		}
+	}
+}
+
+// verifyInstanceRefresh is -platform asg.
+func verifyInstanceRefresh(ctx context.Context, awsSession *session.Session) {
+	started := time.Now()
+	refresh := newInstanceRefreshHandler(ctx, awsSession, *flagAsgName, *flagCheckInterval, *flagTimeout)
+
+	logger.infof("Waiting for the instance refresh of %s.", *flagAsgName)
+	if err := refresh.waitForRefresh(); err != nil {
+		logger.errorf("The instance refresh did not complete. Error: %s", err)
+		exitWithResult(*flagAsgName, started, "failed", 1)
+	}
+	logger.infof("Auto scaling group looks good.")
+	exitWithResult(*flagAsgName, started, "success", 0)
+}
@@ -0,0 +1,307 @@
+//go:build integration
+// +build integration
+
+package main
+
+// The integration tests run the wait loops against an emulated ECS and ELBv2, like LocalStack or
+// moto in server mode. Set AWTY_INTEGRATION_ENDPOINT to the endpoint of the emulator to run them:
+//
+//	AWTY_INTEGRATION_ENDPOINT=http://localhost:4566 go test -tags integration ./...
+//
+// Emulators don't start containers or health check targets, so the scenarios set the rollout
+// state, task counts and target health the emulator returns on the way back to the wait loops.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// integrationSession returns a session for the emulator, or skips the test when there is none.
+func integrationSession(t *testing.T) *session.Session {
+	t.Helper()
+	endpoint := os.Getenv("AWTY_INTEGRATION_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AWTY_INTEGRATION_ENDPOINT is not set")
+	}
+	awsSession, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(endpoint),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})
+	if err != nil {
+		t.Fatalf("session: %s", err)
+	}
+	return awsSession
+}
+
+// integrationService creates a cluster with a service in the emulator and returns a handler for it
+// without a stability window. With a target group the service is behind a load balancer.
+func integrationService(t *testing.T, awsSession *session.Session, withTargetGroup bool) *serviceHandler {
+	t.Helper()
+	name := strings.ToLower(fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))
+	client := ecs.New(awsSession)
+
+	if _, err := client.CreateCluster(&ecs.CreateClusterInput{ClusterName: aws.String(name)}); err != nil {
+		t.Fatalf("create cluster: %s", err)
+	}
+	td, err := client.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:      aws.String(name),
+		NetworkMode: aws.String(ecs.NetworkModeAwsvpc),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:         aws.String("app"),
+			Image:        aws.String("nginx:latest"),
+			Memory:       aws.Int64(128),
+			Essential:    aws.Bool(true),
+			PortMappings: []*ecs.PortMapping{{ContainerPort: aws.Int64(80)}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("register task definition: %s", err)
+	}
+
+	vpcId, subnets := integrationNetwork(t, awsSession)
+	input := &ecs.CreateServiceInput{
+		Cluster:        aws.String(name),
+		ServiceName:    aws.String(name),
+		TaskDefinition: td.TaskDefinition.TaskDefinitionArn,
+		DesiredCount:   aws.Int64(2),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{Subnets: subnets},
+		},
+	}
+	if withTargetGroup {
+		input.LoadBalancers = []*ecs.LoadBalancer{{
+			TargetGroupArn: aws.String(integrationTargetGroup(t, awsSession, name, vpcId, subnets)),
+			ContainerName:  aws.String("app"),
+			ContainerPort:  aws.Int64(80),
+		}}
+	}
+	if _, err := client.CreateService(input); err != nil {
+		t.Fatalf("create service: %s", err)
+	}
+
+	sh := newServiceHandler(context.Background(), awsSession, name, name, 1, 1)
+	sh.setStabilityWindow(0)
+	return sh
+}
+
+// integrationNetwork creates a VPC with a subnet in two availability zones.
+func integrationNetwork(t *testing.T, awsSession *session.Session) (*string, []*string) {
+	t.Helper()
+	ec2Client := ec2.New(awsSession)
+	vpc, err := ec2Client.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("10.0.0.0/16")})
+	if err != nil {
+		t.Fatalf("create vpc: %s", err)
+	}
+	subnets := []*string{}
+	for i, zone := range []string{"us-east-1a", "us-east-1b"} {
+		subnet, err := ec2Client.CreateSubnet(&ec2.CreateSubnetInput{
+			VpcId:            vpc.Vpc.VpcId,
+			CidrBlock:        aws.String(fmt.Sprintf("10.0.%d.0/24", i)),
+			AvailabilityZone: aws.String(zone),
+		})
+		if err != nil {
+			t.Fatalf("create subnet: %s", err)
+		}
+		subnets = append(subnets, subnet.Subnet.SubnetId)
+	}
+	return vpc.Vpc.VpcId, subnets
+}
+
+// integrationTargetGroup creates a load balancer forwarding to an IP target group with two
+// registered targets and returns the ARN of the target group.
+func integrationTargetGroup(t *testing.T, awsSession *session.Session, name string, vpcId *string, subnets []*string) string {
+	t.Helper()
+	elbClient := elbv2.New(awsSession)
+
+	// Load balancer names are limited to 32 characters, the end of the name is the unique timestamp.
+	shortName := "awty-" + name[len(name)-16:]
+	lb, err := elbClient.CreateLoadBalancer(&elbv2.CreateLoadBalancerInput{
+		Name:    aws.String(shortName),
+		Subnets: subnets,
+	})
+	if err != nil {
+		t.Fatalf("create load balancer: %s", err)
+	}
+	tg, err := elbClient.CreateTargetGroup(&elbv2.CreateTargetGroupInput{
+		Name:       aws.String(shortName),
+		Protocol:   aws.String(elbv2.ProtocolEnumHttp),
+		Port:       aws.Int64(80),
+		VpcId:      vpcId,
+		TargetType: aws.String(elbv2.TargetTypeEnumIp),
+	})
+	if err != nil {
+		t.Fatalf("create target group: %s", err)
+	}
+	targetGroupArn := tg.TargetGroups[0].TargetGroupArn
+	_, err = elbClient.CreateListener(&elbv2.CreateListenerInput{
+		LoadBalancerArn: lb.LoadBalancers[0].LoadBalancerArn,
+		Protocol:        aws.String(elbv2.ProtocolEnumHttp),
+		Port:            aws.Int64(80),
+		DefaultActions: []*elbv2.Action{{
+			Type:           aws.String(elbv2.ActionTypeEnumForward),
+			TargetGroupArn: targetGroupArn,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("create listener: %s", err)
+	}
+	_, err = elbClient.RegisterTargets(&elbv2.RegisterTargetsInput{
+		TargetGroupArn: targetGroupArn,
+		Targets: []*elbv2.TargetDescription{
+			{Id: aws.String("10.0.0.10"), Port: aws.Int64(80)},
+			{Id: aws.String("10.0.1.10"), Port: aws.Int64(80)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register targets: %s", err)
+	}
+	return aws.StringValue(targetGroupArn)
+}
+
+// simulateService changes every DescribeServices response of the handler before the wait loops see it.
+func simulateService(sh *serviceHandler, change func(service *ecs.Service)) {
+	sh.session.Handlers.Unmarshal.PushBack(func(r *request.Request) {
+		if output, ok := r.Data.(*ecs.DescribeServicesOutput); ok {
+			for _, service := range output.Services {
+				change(service)
+			}
+		}
+	})
+}
+
+// simulateTargetHealth sets the state of every target the handler sees.
+func simulateTargetHealth(sh *serviceHandler, state string) {
+	sh.elbv2Session.Handlers.Unmarshal.PushBack(func(r *request.Request) {
+		if output, ok := r.Data.(*elbv2.DescribeTargetHealthOutput); ok {
+			for _, target := range output.TargetHealthDescriptions {
+				target.TargetHealth = &elbv2.TargetHealth{
+					State:       aws.String(state),
+					Reason:      aws.String("Target.ResponseCodeMismatch"),
+					Description: aws.String("Health checks failed"),
+				}
+			}
+		}
+	})
+}
+
+// rollout sets the rollout state of the PRIMARY deployment and the running count.
+func rollout(state string, running int64) func(service *ecs.Service) {
+	return func(service *ecs.Service) {
+		service.RunningCount = aws.Int64(running)
+		for _, deployment := range service.Deployments {
+			if aws.StringValue(deployment.Status) == "PRIMARY" {
+				deployment.RolloutState = aws.String(state)
+				deployment.RolloutStateReason = aws.String("ECS deployment circuit breaker: tasks failed to start.")
+				deployment.RunningCount = aws.Int64(running)
+			}
+		}
+	}
+}
+
+func TestIntegrationDeploymentCompletes(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), false)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateCompleted, 2))
+
+	if err := sh.wait(); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+}
+
+func TestIntegrationCircuitBreaker(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), false)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateFailed, 0))
+
+	err := sh.wait()
+	if err == nil || !strings.Contains(err.Error(), "FAILED") {
+		t.Fatalf("run returned %v, want the deployment to have FAILED", err)
+	}
+}
+
+func TestIntegrationFailedTasks(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), false)
+	simulateService(sh, func(service *ecs.Service) {
+		rollout(ecs.DeploymentRolloutStateInProgress, 1)(service)
+		for _, deployment := range service.Deployments {
+			deployment.FailedTasks = aws.Int64(3)
+		}
+	})
+	sh.setMaxFailedTasks(2)
+
+	err := sh.wait()
+	if err == nil || !strings.Contains(err.Error(), "failed tasks") {
+		t.Fatalf("run returned %v, want too many failed tasks", err)
+	}
+}
+
+func TestIntegrationDeploymentTimeout(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), false)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateInProgress, 1))
+	sh.setPhaseTimeouts(time.Second*2, time.Second*2, time.Second*2)
+
+	err := sh.wait()
+	if err == nil || !strings.Contains(err.Error(), "deployment") {
+		t.Fatalf("run returned %v, want a deployment timeout", err)
+	}
+}
+
+func TestIntegrationRunningCountTimeout(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), false)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateCompleted, 1))
+	sh.setPhaseTimeouts(time.Second*2, time.Second*2, time.Second*2)
+
+	err := sh.wait()
+	if !errors.Is(err, ecswait.ErrTimeout) || !strings.Contains(err.Error(), ecswait.CheckRunningCount) {
+		t.Fatalf("run returned %v, want a running count timeout", err)
+	}
+}
+
+func TestIntegrationHealthyTargets(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), true)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateCompleted, 2))
+	simulateTargetHealth(sh, elbv2.TargetHealthStateEnumHealthy)
+
+	if err := sh.wait(); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+}
+
+func TestIntegrationUnhealthyTargets(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), true)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateCompleted, 2))
+	simulateTargetHealth(sh, elbv2.TargetHealthStateEnumUnhealthy)
+	sh.setPhaseTimeouts(time.Second*2, time.Second*2, time.Second*2)
+
+	err := sh.wait()
+	if err == nil || !strings.Contains(err.Error(), "targets") {
+		t.Fatalf("run returned %v, want a target health timeout", err)
+	}
+	if sh.unhealthyTargets != 2 {
+		t.Fatalf("counted %d unhealthy targets, want 2", sh.unhealthyTargets)
+	}
+}
+
+func TestIntegrationIgnoredTargets(t *testing.T) {
+	sh := integrationService(t, integrationSession(t), true)
+	simulateService(sh, rollout(ecs.DeploymentRolloutStateCompleted, 2))
+	simulateTargetHealth(sh, elbv2.TargetHealthStateEnumUnhealthy)
+	sh.ignoreTargets([]string{"10.0.0.10", "10.0.1.10"})
+
+	if err := sh.wait(); err != nil {
+		t.Fatalf("run waited for ignored targets: %s", err)
+	}
+}
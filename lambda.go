@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// lambdaAliasHandler waits for a CodeDeploy canary or linear deployment to shift the traffic of a Lambda alias.
+type lambdaAliasHandler struct {
+	ctx               context.Context
+	codedeploySession *codedeploy.CodeDeploy
+	lambdaSession     *lambda.Lambda
+	cloudwatchSession *cloudwatch.CloudWatch
+	application       *string
+	deploymentGroup   *string
+	function          *string
+	alias             *string
+	checkInterval     int
+	checkTimeout      int
+}
+
+func newLambdaAliasHandler(ctx context.Context, awsSession *session.Session, application, deploymentGroup, function, alias string, checkInterval, checkTimeout int) *lambdaAliasHandler {
+	return &lambdaAliasHandler{
+		ctx:               ctx,
+		codedeploySession: codedeploy.New(awsSession),
+		lambdaSession:     lambda.New(awsSession),
+		cloudwatchSession: cloudwatch.New(awsSession),
+		application:       aws.String(application),
+		deploymentGroup:   aws.String(deploymentGroup),
+		function:          aws.String(function),
+		alias:             aws.String(alias),
+		checkInterval:     checkInterval,
+		checkTimeout:      checkTimeout,
+	}
+}
+
+// latestDeployment finds the most recently created deployment of the deployment group.
+func (lh *lambdaAliasHandler) latestDeployment() (*codedeploy.DeploymentInfo, error) {
+	list, err := lh.codedeploySession.ListDeploymentsWithContext(lh.ctx, &codedeploy.ListDeploymentsInput{
+		ApplicationName:     lh.application,
+		DeploymentGroupName: lh.deploymentGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Deployments) == 0 {
+		return nil, fmt.Errorf("no deployments found for %s/%s", aws.StringValue(lh.application), aws.StringValue(lh.deploymentGroup))
+	}
+	// BatchGetDeployments takes at most 25 IDs, more than enough to find the latest one.
+	ids := list.Deployments
+	if len(ids) > 25 {
+		ids = ids[:25]
+	}
+	output, err := lh.codedeploySession.BatchGetDeploymentsWithContext(lh.ctx, &codedeploy.BatchGetDeploymentsInput{DeploymentIds: ids})
+	if err != nil {
+		return nil, err
+	}
+	var latest *codedeploy.DeploymentInfo
+	for _, deployment := range output.DeploymentsInfo {
+		if latest == nil || aws.TimeValue(deployment.CreateTime).After(aws.TimeValue(latest.CreateTime)) {
+			latest = deployment
+		}
+	}
+	return latest, nil
+}
+
+// aliasWeights describes where the alias sends traffic.
+func (lh *lambdaAliasHandler) aliasWeights() (string, bool, error) {
+	alias, err := lh.lambdaSession.GetAliasWithContext(lh.ctx, &lambda.GetAliasInput{FunctionName: lh.function, Name: lh.alias})
+	if err != nil {
+		return "", false, err
+	}
+	if alias.RoutingConfig == nil || len(alias.RoutingConfig.AdditionalVersionWeights) == 0 {
+		return fmt.Sprintf("all traffic to version %s", aws.StringValue(alias.FunctionVersion)), true, nil
+	}
+	weights := []string{}
+	remaining := 100.0
+	for version, weight := range alias.RoutingConfig.AdditionalVersionWeights {
+		weights = append(weights, fmt.Sprintf("version %s at %.0f%%", version, aws.Float64Value(weight)*100))
+		remaining -= aws.Float64Value(weight) * 100
+	}
+	weights = append([]string{fmt.Sprintf("version %s at %.0f%%", aws.StringValue(alias.FunctionVersion), remaining)}, weights...)
+	return strings.Join(weights, ", "), false, nil
+}
+
+// waitForDeployment waits for the deployment to succeed, printing the alias weights as the traffic shifts.
+func (lh *lambdaAliasHandler) waitForDeployment(deploymentId string) error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(lh.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(lh.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	var progress progressLine
+	for {
+		output, err := lh.codedeploySession.GetDeploymentWithContext(lh.ctx, &codedeploy.GetDeploymentInput{DeploymentId: aws.String(deploymentId)})
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(output.DeploymentInfo.Status)
+		switch status {
+		case codedeploy.DeploymentStatusSucceeded:
+			logger.infof("Deployment %s is %s.", deploymentId, status)
+			return nil
+		case codedeploy.DeploymentStatusFailed, codedeploy.DeploymentStatusStopped:
+			reason := ""
+			if output.DeploymentInfo.ErrorInformation != nil {
+				reason = aws.StringValue(output.DeploymentInfo.ErrorInformation.Message)
+			}
+			return fmt.Errorf("deployment %s is %s. Reason: %s", deploymentId, status, reason)
+		}
+
+		weights, _, err := lh.aliasWeights()
+		if err != nil {
+			return err
+		}
+		progress.logf(logger, fmt.Sprint(status, weights), "Waiting another %d seconds for deployment %s, currently %s with %s.", lh.checkInterval, deploymentId, status, weights)
+
+		select {
+		case <-checkTimer.C:
+		case <-lh.ctx.Done():
+			return lh.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for deployment %s", deploymentId)
+		}
+	}
+}
+
+// bake watches the CloudWatch alarms of the deployment group for the period after the traffic has shifted.
+func (lh *lambdaAliasHandler) bake(period time.Duration) error {
+	group, err := lh.codedeploySession.GetDeploymentGroupWithContext(lh.ctx, &codedeploy.GetDeploymentGroupInput{
+		ApplicationName:     lh.application,
+		DeploymentGroupName: lh.deploymentGroup,
+	})
+	if err != nil {
+		return err
+	}
+	alarms := []*string{}
+	if config := group.DeploymentGroupInfo.AlarmConfiguration; config != nil && aws.BoolValue(config.Enabled) {
+		for _, alarm := range config.Alarms {
+			alarms = append(alarms, alarm.Name)
+		}
+	}
+	if len(alarms) == 0 {
+		logger.warnf("the deployment group has no alarms, the bake can't check anything.")
+		return sleepContext(lh.ctx, period)
+	}
+
+	if err := warnShortBake(lh.ctx, lh.cloudwatchSession, alarms, period); err != nil {
+		logger.errorf("There was an error reading the alarm evaluation periods. Error: %s", err)
+	}
+
+	checkTimer := time.NewTicker(time.Second * time.Duration(lh.checkInterval))
+	bakeTimer := time.NewTimer(period)
+	defer checkTimer.Stop()
+	defer bakeTimer.Stop()
+
+	for {
+		select {
+		case <-checkTimer.C:
+			output, err := lh.cloudwatchSession.DescribeAlarmsWithContext(lh.ctx, &cloudwatch.DescribeAlarmsInput{AlarmNames: alarms})
+			if err != nil {
+				return err
+			}
+			for _, alarm := range output.MetricAlarms {
+				if aws.StringValue(alarm.StateValue) == cloudwatch.StateValueAlarm {
+					return fmt.Errorf("alarm %s is in ALARM. Reason: %s", aws.StringValue(alarm.AlarmName), aws.StringValue(alarm.StateReason))
+				}
+			}
+			logger.debugf("No alarms are firing.")
+		case <-lh.ctx.Done():
+			return lh.ctx.Err()
+		case <-bakeTimer.C:
+			return nil
+		}
+	}
+}
+
+// verifyLambdaAlias is -platform lambda. It waits for the latest deployment of the deployment group,
+// checks all the traffic has moved and bakes for the -soak period.
+func verifyLambdaAlias(ctx context.Context, awsSession *session.Session) {
+	started := time.Now()
+	name := fmt.Sprintf("%s:%s", *flagFunction, *flagAlias)
+	notifyWebhook := ""
+	if *flagConfig != "" {
+		cfg, err := loadConfig(*flagConfig)
+		if err != nil {
+			logger.errorf("There was an error loading the config. Error: %s", err)
+			os.Exit(1)
+		}
+		notifyWebhook = cfg.NotifyWebhook
+	}
+	fail := func(format string, err error) {
+		logger.errorf(format, err)
+		if notifyWebhook != "" {
+			if err := sendNotification(notifyWebhook, fmt.Sprintf("%s: traffic shift failed: %s", name, err)); err != nil {
+				logger.errorf("There was an error sending the notification. Error: %s", err)
+			}
+		}
+		exitWithResult(name, started, "failed", 1)
+	}
+
+	handler := newLambdaAliasHandler(ctx, awsSession, *flagCodeDeployApp, *flagCodeDeployGroup, *flagFunction, *flagAlias, *flagCheckInterval, *flagTimeout)
+	deployment, err := handler.latestDeployment()
+	if err != nil {
+		fail("There was an error finding the deployment. Error: %s", err)
+	}
+	logger.infof("Waiting for deployment %s to shift the traffic of %s.", aws.StringValue(deployment.DeploymentId), name)
+	if err := handler.waitForDeployment(aws.StringValue(deployment.DeploymentId)); err != nil {
+		fail("The traffic shift did not complete. Error: %s", err)
+	}
+
+	weights, shifted, err := handler.aliasWeights()
+	if err != nil {
+		fail("There was an error describing the alias. Error: %s", err)
+	}
+	if !shifted {
+		fail("The traffic shift did not complete. Error: %s", fmt.Errorf("alias still has %s", weights))
+	}
+	logger.infof("Alias %s sends %s.", name, weights)
+
+	if *flagSoak > 0 {
+		logger.infof("Baking for %s.", *flagSoak)
+		if err := handler.bake(*flagSoak); err != nil {
+			fail("The function failed during the bake. Error: %s", err)
+		}
+	}
+
+	if notifyWebhook != "" {
+		if err := sendNotification(notifyWebhook, fmt.Sprintf("%s: traffic shift succeeded, %s", name, weights)); err != nil {
+			logger.errorf("There was an error sending the notification. Error: %s", err)
+		}
+	}
+	logger.infof("Function looks good.")
+	exitWithResult(name, started, "success", 0)
+}
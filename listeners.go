@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// checkListenerRules makes sure that every target group attached to the service is
+// referenced by at least one listener rule. A target group that is not referenced
+// can be perfectly healthy and still never receive any traffic.
+// If host or path are set, the rule that would serve that request must also forward
+// to the target group.
+func (sh *serviceHandler) checkListenerRules(host, path string) error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+
+	if len(sh.currentOutput.LoadBalancers) == 0 {
+		sh.log.infof("No load balancer to check listener rules for.")
+		return nil
+	}
+
+	for _, lb := range sh.currentOutput.LoadBalancers {
+		targetGroupArn := aws.StringValue(lb.TargetGroupArn)
+		if targetGroupArn == "" {
+			// Classic load balancers don't have target groups or listener rules.
+			continue
+		}
+
+		listeners, err := sh.listenerRulesForTargetGroup(targetGroupArn)
+		if err != nil {
+			return err
+		}
+		if err := checkRouting(listeners, targetGroupArn, host, path); err != nil {
+			return err
+		}
+		sh.log.debugf("Listener rules route to target group %s.", targetGroupArn)
+	}
+
+	return nil
+}
+
+// checkRouting checks that a listener rule forwards to the target group and, if host or path are
+// set, that the listeners the target group is attached to send that request to it. Every listener
+// has its own rules and priorities, so a listener that only redirects to HTTPS is left out.
+func checkRouting(listeners []listenerRules, targetGroupArn, host, path string) error {
+	attached := []listenerRules{}
+	for _, listener := range listeners {
+		if listener.forwardsTo(targetGroupArn) {
+			attached = append(attached, listener)
+		}
+	}
+	if len(attached) == 0 {
+		return fmt.Errorf("target group %s is not referenced by any listener rule", targetGroupArn)
+	}
+	if host == "" && path == "" {
+		return nil
+	}
+
+	for _, listener := range attached {
+		matched := listener.match(host, path)
+		if matched == nil {
+			return fmt.Errorf("no rule of listener %s matches host %q and path %q", listener.listenerArn, host, path)
+		}
+		if !matched.forwardsTo(targetGroupArn) {
+			return fmt.Errorf("requests for host %q and path %q are served by rule %s of listener %s which does not forward to target group %s", host, path, aws.StringValue(matched.rule.RuleArn), listener.listenerArn, targetGroupArn)
+		}
+	}
+	return nil
+}
+
+// listenerRulesForTargetGroup collects the rules of every listener on the load balancers
+// that the target group is attached to, listener by listener.
+func (sh *serviceHandler) listenerRulesForTargetGroup(targetGroupArn string) ([]listenerRules, error) {
+	tg, err := sh.describeTargetGroup(targetGroupArn)
+	if err != nil {
+		return nil, err
+	}
+
+	all := []listenerRules{}
+	for _, lbArn := range tg.LoadBalancerArns {
+		listeners := []*elbv2.Listener{}
+		err := sh.elbv2Session.DescribeListenersPagesWithContext(sh.ctx,
+			&elbv2.DescribeListenersInput{LoadBalancerArn: lbArn},
+			func(page *elbv2.DescribeListenersOutput, lastPage bool) bool {
+				listeners = append(listeners, page.Listeners...)
+				return true
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, listener := range listeners {
+			rules := []*elbv2.Rule{}
+			input := &elbv2.DescribeRulesInput{ListenerArn: listener.ListenerArn}
+			for {
+				rulesOutput, err := sh.elbv2Session.DescribeRulesWithContext(sh.ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				rules = append(rules, rulesOutput.Rules...)
+				if aws.StringValue(rulesOutput.NextMarker) == "" {
+					break
+				}
+				input.Marker = rulesOutput.NextMarker
+			}
+			all = append(all, newListenerRules(aws.StringValue(listener.ListenerArn), rules))
+		}
+	}
+
+	return all, nil
+}
+
+// listenerRules are the rules of one listener in priority order, with their conditions compiled.
+type listenerRules struct {
+	listenerArn string
+	rules       []*listenerRule
+}
+
+// listenerRule is a listener rule with its host-header and path-pattern conditions compiled once.
+type listenerRule struct {
+	rule       *elbv2.Rule
+	priority   int
+	conditions []ruleCondition
+}
+
+// ruleCondition is a condition of a rule. The request has to match one of the patterns.
+type ruleCondition struct {
+	field    string
+	patterns []*regexp.Regexp
+}
+
+func newListenerRules(listenerArn string, rules []*elbv2.Rule) listenerRules {
+	lr := listenerRules{listenerArn: listenerArn}
+	for _, rule := range rules {
+		lr.rules = append(lr.rules, newListenerRule(rule))
+	}
+	sort.SliceStable(lr.rules, func(i, j int) bool {
+		return lr.rules[i].priority < lr.rules[j].priority
+	})
+	return lr
+}
+
+func newListenerRule(rule *elbv2.Rule) *listenerRule {
+	lr := &listenerRule{rule: rule, priority: rulePriority(rule)}
+	for _, condition := range rule.Conditions {
+		field := aws.StringValue(condition.Field)
+		values := aws.StringValueSlice(condition.Values)
+		if condition.HostHeaderConfig != nil {
+			values = append(values, aws.StringValueSlice(condition.HostHeaderConfig.Values)...)
+		}
+		if condition.PathPatternConfig != nil {
+			values = append(values, aws.StringValueSlice(condition.PathPatternConfig.Values)...)
+		}
+		patterns := []*regexp.Regexp{}
+		for _, value := range values {
+			patterns = append(patterns, wildcardPattern(value, field == "host-header"))
+		}
+		lr.conditions = append(lr.conditions, ruleCondition{field: field, patterns: patterns})
+	}
+	return lr
+}
+
+// forwardsTo reports if any rule of the listener forwards traffic to the target group.
+func (lr listenerRules) forwardsTo(targetGroupArn string) bool {
+	for _, rule := range lr.rules {
+		if rule.forwardsTo(targetGroupArn) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the rule that would serve a request for the host and path, following the
+// priority order of the listener. Rules with conditions other than host-header and path-pattern
+// are skipped as we can't know if the request would satisfy them.
+func (lr listenerRules) match(host, path string) *listenerRule {
+	for _, rule := range lr.rules {
+		if rule.matches(host, path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// forwardsTo reports if any of the rule's actions forward traffic to the target group.
+func (lr *listenerRule) forwardsTo(targetGroupArn string) bool {
+	for _, action := range lr.rule.Actions {
+		if aws.StringValue(action.TargetGroupArn) == targetGroupArn {
+			return true
+		}
+		if action.ForwardConfig == nil {
+			continue
+		}
+		for _, tg := range action.ForwardConfig.TargetGroups {
+			if aws.StringValue(tg.TargetGroupArn) == targetGroupArn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rulePriority(rule *elbv2.Rule) int {
+	if aws.BoolValue(rule.IsDefault) {
+		return int(^uint(0) >> 1)
+	}
+	priority, err := strconv.Atoi(aws.StringValue(rule.Priority))
+	if err != nil {
+		return int(^uint(0) >> 1)
+	}
+	return priority
+}
+
+func (lr *listenerRule) matches(host, path string) bool {
+	for _, condition := range lr.conditions {
+		value := path
+		switch condition.field {
+		case "host-header":
+			value = strings.ToLower(host)
+		case "path-pattern":
+		default:
+			return false
+		}
+		if !anyMatch(condition.patterns, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyMatch(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardPattern compiles a load balancer style pattern where * matches any number of
+// characters and ? matches exactly one.
+func wildcardPattern(pattern string, ignoreCase bool) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, `.*`)
+	expr = strings.ReplaceAll(expr, `\?`, `.`)
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile("^" + expr + "$")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// testRule is a listener rule that forwards to the target group, or redirects when it is empty.
+func testRule(arn, priority, targetGroupArn string, conditions ...*elbv2.RuleCondition) *elbv2.Rule {
+	rule := &elbv2.Rule{
+		RuleArn:    aws.String(arn),
+		Priority:   aws.String(priority),
+		IsDefault:  aws.Bool(priority == "default"),
+		Conditions: conditions,
+	}
+	if targetGroupArn == "" {
+		rule.Actions = []*elbv2.Action{{Type: aws.String(elbv2.ActionTypeEnumRedirect)}}
+	} else {
+		rule.Actions = []*elbv2.Action{{Type: aws.String(elbv2.ActionTypeEnumForward), TargetGroupArn: aws.String(targetGroupArn)}}
+	}
+	return rule
+}
+
+func hostCondition(values ...string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{Field: aws.String("host-header"), HostHeaderConfig: &elbv2.HostHeaderConditionConfig{Values: aws.StringSlice(values)}}
+}
+
+func pathCondition(values ...string) *elbv2.RuleCondition {
+	return &elbv2.RuleCondition{Field: aws.String("path-pattern"), Values: aws.StringSlice(values)}
+}
+
+func TestListenerRuleMatch(t *testing.T) {
+	rules := newListenerRules("https", []*elbv2.Rule{
+		testRule("default", "default", "other"),
+		testRule("api", "20", "api", pathCondition("/api/*")),
+		testRule("api-v2", "10", "v2", pathCondition("/api/v2/*")),
+		testRule("web", "30", "web", hostCondition("*.example.com")),
+		testRule("single", "40", "single", hostCondition("app?.test")),
+		testRule("both", "5", "both", hostCondition("admin.example.com"), pathCondition("/admin*")),
+		testRule("header", "1", "header", &elbv2.RuleCondition{Field: aws.String("http-header")}),
+	})
+	tests := map[string]struct {
+		host, path string
+		expected   string
+	}{
+		"path wildcard":                {path: "/api/users", expected: "api"},
+		"lower priority number wins":   {path: "/api/v2/users", expected: "api-v2"},
+		"host wildcard":                {host: "www.example.com", path: "/", expected: "web"},
+		"host ignores case":            {host: "WWW.Example.COM", path: "/", expected: "web"},
+		"host wildcard needs a prefix": {host: "example.com", path: "/", expected: "default"},
+		"single character":             {host: "app1.test", path: "/", expected: "single"},
+		"single character only one":    {host: "app12.test", path: "/", expected: "default"},
+		"every condition must match":   {host: "admin.example.com", path: "/admin/users", expected: "both"},
+		"one condition is not enough":  {host: "admin.example.com", path: "/", expected: "web"},
+		"path is case sensitive":       {path: "/API/users", expected: "default"},
+		"default rule":                 {host: "other.test", path: "/", expected: "default"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			matched := rules.match(test.host, test.path)
+			if matched == nil {
+				t.Fatalf("expected rule %s, got none", test.expected)
+			}
+			if got := aws.StringValue(matched.rule.RuleArn); got != test.expected {
+				t.Errorf("expected rule %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckRouting(t *testing.T) {
+	// A listener on port 80 that only redirects to HTTPS, its default rule ties with the one of HTTPS.
+	redirect := newListenerRules("http", []*elbv2.Rule{testRule("redirect", "default", "")})
+	tests := map[string]struct {
+		listeners  []listenerRules
+		host, path string
+		fails      bool
+	}{
+		"default rule": {
+			listeners: []listenerRules{redirect, newListenerRules("https", []*elbv2.Rule{testRule("default", "default", "tg")})},
+			host:      "example.com",
+		},
+		"host rule": {
+			listeners: []listenerRules{newListenerRules("https", []*elbv2.Rule{
+				testRule("default", "default", "other"),
+				testRule("web", "10", "tg", hostCondition("www.example.com")),
+			}), redirect},
+			host: "www.example.com",
+		},
+		"higher priority rule to another target group": {
+			listeners: []listenerRules{newListenerRules("https", []*elbv2.Rule{
+				testRule("web", "10", "tg", pathCondition("/*")),
+				testRule("api", "5", "other", pathCondition("/api/*")),
+			})},
+			path:  "/api/users",
+			fails: true,
+		},
+		"not referenced": {
+			listeners: []listenerRules{redirect, newListenerRules("https", []*elbv2.Rule{testRule("default", "default", "other")})},
+			fails:     true,
+		},
+		"referenced without host or path": {
+			listeners: []listenerRules{newListenerRules("https", []*elbv2.Rule{
+				testRule("default", "default", "other"),
+				testRule("web", "10", "tg", hostCondition("www.example.com")),
+			})},
+		},
+		"every listener it is attached to": {
+			listeners: []listenerRules{
+				newListenerRules("https", []*elbv2.Rule{testRule("default", "default", "tg")}),
+				newListenerRules("internal", []*elbv2.Rule{
+					testRule("default", "default", "other"),
+					testRule("web", "10", "tg", hostCondition("internal.example.com")),
+				}),
+			},
+			host:  "www.example.com",
+			fails: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkRouting(test.listeners, "tg", test.host, test.path)
+			if test.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.fails && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+		})
+	}
+}
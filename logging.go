@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logLevel is the level of the logger, set by -log-level and -V.
+var logLevel = new(slog.LevelVar)
+
+// logger is where a run says what it is doing: what it waits for, warnings and errors. What a
+// command shows, like tables, events and the trouble shooting information, is printed as it is.
+var logger = logPrinter{Logger: slog.New(newPlainHandler(os.Stdout, logLevel))}
+
+// logPrinter adds printf style methods to a slog logger, the messages of this tool are sentences
+// about the service more than key value pairs.
+type logPrinter struct {
+	*slog.Logger
+	// quiet leaves out the lines that repeat every check, see progressf.
+	quiet bool
+}
+
+func (l logPrinter) with(args ...interface{}) logPrinter {
+	return logPrinter{l.Logger.With(args...), l.quiet}
+}
+
+// verbose tells if debug messages are logged, for output that is too expensive to build otherwise.
+func (l logPrinter) verbose() bool {
+	return l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func (l logPrinter) logf(level slog.Level, format string, args ...interface{}) {
+	if l.Enabled(context.Background(), level) {
+		l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l logPrinter) debugf(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+func (l logPrinter) infof(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+// progressf logs a line that repeats every check, like how long until the next one. -quiet
+// leaves them out so long waits don't drown the build log.
+func (l logPrinter) progressf(format string, args ...interface{}) {
+	if !l.quiet {
+		l.infof(format, args...)
+	}
+}
+
+func (l logPrinter) warnf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+func (l logPrinter) errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+// logOptions are the -log-level, -log-format, -quiet and -no-color flags. Every subcommand has them.
+type logOptions struct {
+	level   *string
+	format  *string
+	quiet   *bool
+	noColor *bool
+}
+
+func addLogFlags(flags *flag.FlagSet) logOptions {
+	return logOptions{
+		level:   flags.String("log-level", "info", "Lowest level to log: debug, info, warn or error. -V is the same as debug"),
+		format:  flags.String("log-format", "text", "Format of the log: text, or json with one object per line for log pipelines"),
+		noColor: flags.Bool("no-color", false, "Don't color the rollout and health states. Setting the NO_COLOR environment variable does the same"),
+		quiet:   flags.Bool("quiet", false, "Only log when something changes and the result, instead of every check. For CI logs of long deployments"),
+	}
+}
+
+// setup points the logger at the level and format of the flags.
+func (lo logOptions) setup(verbose bool) error {
+	level := slog.LevelDebug
+	if !verbose {
+		if err := level.UnmarshalText([]byte(*lo.level)); err != nil {
+			return fmt.Errorf("bad value for -log-level %q, use debug, info, warn or error", *lo.level)
+		}
+	}
+	logLevel.Set(level)
+
+	switch *lo.format {
+	case "text":
+		logger = logPrinter{slog.New(newPlainHandler(os.Stdout, logLevel)), *lo.quiet}
+	case "json":
+		logger = logPrinter{slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})), *lo.quiet}
+	default:
+		return fmt.Errorf("bad value for -log-format %q, use text or json", *lo.format)
+	}
+	setupColor(*lo.noColor)
+	return nil
+}
+
+// setupLogging sets up the logger from the flags of a subcommand and exits when they are wrong.
+func setupLogging(lo logOptions, verbose bool) {
+	if err := lo.setup(verbose); err != nil {
+		fmt.Printf("There was an error setting up the log. Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// progressLine is a line logged every check that says what the wait is up to. With -quiet it is
+// only logged when the state in it changes.
+type progressLine struct {
+	state string
+}
+
+func (p *progressLine) logf(l logPrinter, state string, format string, args ...interface{}) {
+	if state != p.state {
+		p.state = state
+		l.infof(format, args...)
+		return
+	}
+	l.progressf(format, args...)
+}
+
+// jsonLogs tells if the log is in the json format.
+func jsonLogs() bool {
+	_, ok := logger.Handler().(*slog.JSONHandler)
+	return ok
+}
+
+// plainHandler is the text format. It prints the message on its own like the output has always
+// looked, warnings start with WARNING. The attributes are left out, they are for the json format.
+type plainHandler struct {
+	output io.Writer
+	level  slog.Leveler
+	lock   *sync.Mutex
+}
+
+func newPlainHandler(output io.Writer, level slog.Leveler) *plainHandler {
+	return &plainHandler{output: output, level: level, lock: &sync.Mutex{}}
+}
+
+func (h *plainHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(ctx context.Context, record slog.Record) error {
+	prefix := ""
+	if record.Level == slog.LevelWarn {
+		prefix = "WARNING: "
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, err := fmt.Fprintf(h.output, "%s%s\n", prefix, record.Message)
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler { return h }
+func (h *plainHandler) WithGroup(name string) slog.Handler       { return h }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// checkLogConfiguration makes sure that the log configuration of every container can work.
+// awslogs groups must exist unless ECS is allowed to create them, and the awsfirelens driver
+// needs a FireLens log router container in the task.
+func (sh *serviceHandler) checkLogConfiguration() error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+
+	hasLogRouter := false
+	for _, container := range td.ContainerDefinitions {
+		if container.FirelensConfiguration != nil {
+			hasLogRouter = true
+		}
+	}
+
+	problems := []string{}
+	for _, container := range td.ContainerDefinitions {
+		name := aws.StringValue(container.Name)
+		if container.LogConfiguration == nil {
+			sh.log.warnf("container %s has no log configuration.", name)
+			continue
+		}
+
+		options := aws.StringValueMap(container.LogConfiguration.Options)
+		switch aws.StringValue(container.LogConfiguration.LogDriver) {
+		case ecs.LogDriverAwslogs:
+			group := options["awslogs-group"]
+			if options["awslogs-create-group"] == "true" {
+				sh.log.debugf("Log group %s for container %s is created by ECS.", group, name)
+				continue
+			}
+			exists, err := sh.logGroupExists(group, options["awslogs-region"])
+			if err != nil {
+				return err
+			}
+			if !exists {
+				problems = append(problems, fmt.Sprintf("log group %s for container %s does not exist and awslogs-create-group is not enabled", group, name))
+			}
+		case ecs.LogDriverAwsfirelens:
+			if !hasLogRouter {
+				problems = append(problems, fmt.Sprintf("container %s uses awsfirelens but the task has no FireLens log router container", name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("log configuration will not work:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func (sh *serviceHandler) logGroupExists(group, region string) (bool, error) {
+	exists := false
+	err := sh.logsClient(region).DescribeLogGroupsPagesWithContext(sh.ctx,
+		&cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(group)},
+		func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+			for _, logGroup := range page.LogGroups {
+				if aws.StringValue(logGroup.LogGroupName) == group {
+					exists = true
+					return false
+				}
+			}
+			return true
+		},
+	)
+	return exists, err
+}
+
+// checkTasksEmitLogs warns about containers in the RUNNING tasks of the PRIMARY deployment that
+// have not written a single log event. Only awslogs containers with a stream prefix can be checked
+// as we need to know the name of the log stream.
+func (sh *serviceHandler) checkTasksEmitLogs() error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+	tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range td.ContainerDefinitions {
+		if container.LogConfiguration == nil || aws.StringValue(container.LogConfiguration.LogDriver) != ecs.LogDriverAwslogs {
+			continue
+		}
+		options := aws.StringValueMap(container.LogConfiguration.Options)
+		if options["awslogs-stream-prefix"] == "" {
+			sh.log.debugf("Container %s has no awslogs-stream-prefix, its log streams can't be checked.", aws.StringValue(container.Name))
+			continue
+		}
+
+		for _, task := range tasks {
+			stream := awslogsStreamName(options["awslogs-stream-prefix"], aws.StringValue(container.Name), aws.StringValue(task.TaskArn))
+			output, err := sh.logsClient(options["awslogs-region"]).GetLogEventsWithContext(sh.ctx, &cloudwatchlogs.GetLogEventsInput{
+				LogGroupName:  aws.String(options["awslogs-group"]),
+				LogStreamName: aws.String(stream),
+				Limit:         aws.Int64(1),
+				StartFromHead: aws.Bool(true),
+			})
+			if err != nil || len(output.Events) == 0 {
+				sh.log.warnf("container %s in task %s has not written any logs to %s.", aws.StringValue(container.Name), taskId(aws.StringValue(task.TaskArn)), stream)
+				continue
+			}
+			sh.log.debugf("Container %s in task %s is writing logs.", aws.StringValue(container.Name), taskId(aws.StringValue(task.TaskArn)))
+		}
+	}
+	return nil
+}
+
+// awslogsStreamName is the log stream that the awslogs driver writes to for a container in a task.
+func awslogsStreamName(prefix, container, taskArn string) string {
+	return fmt.Sprintf("%s/%s/%s", prefix, container, taskId(taskArn))
+}
+
+// taskId is the last part of a task ARN.
+func taskId(taskArn string) string {
+	return taskArn[strings.LastIndex(taskArn, "/")+1:]
+}
+
+// logExcerpt is the end of the log stream of one container in a task.
+type logExcerpt struct {
+	Container string   `json:"container"`
+	LogGroup  string   `json:"log_group"`
+	LogStream string   `json:"log_stream"`
+	Lines     []string `json:"lines"`
+}
+
+// taskLogExcerpts fetches the last lines that each awslogs container of the task wrote. Containers
+// without an awslogs stream prefix are skipped because the name of their log stream is not known.
+func (sh *serviceHandler) taskLogExcerpts(task *ecs.Task, lines int64) ([]logExcerpt, error) {
+	td, err := sh.describeTaskDefinition(aws.StringValue(task.TaskDefinitionArn))
+	if err != nil {
+		return nil, err
+	}
+
+	excerpts := []logExcerpt{}
+	for _, container := range td.ContainerDefinitions {
+		if container.LogConfiguration == nil || aws.StringValue(container.LogConfiguration.LogDriver) != ecs.LogDriverAwslogs {
+			continue
+		}
+		options := aws.StringValueMap(container.LogConfiguration.Options)
+		if options["awslogs-stream-prefix"] == "" {
+			continue
+		}
+		excerpt := logExcerpt{
+			Container: aws.StringValue(container.Name),
+			LogGroup:  options["awslogs-group"],
+			LogStream: awslogsStreamName(options["awslogs-stream-prefix"], aws.StringValue(container.Name), aws.StringValue(task.TaskArn)),
+			Lines:     []string{},
+		}
+		// Without StartFromHead the newest events are returned.
+		output, err := sh.logsClient(options["awslogs-region"]).GetLogEventsWithContext(sh.ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(excerpt.LogGroup),
+			LogStreamName: aws.String(excerpt.LogStream),
+			Limit:         aws.Int64(lines),
+			StartFromHead: aws.Bool(false),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s. Error: %s", excerpt.LogStream, err)
+		}
+		for _, event := range output.Events {
+			excerpt.Lines = append(excerpt.Lines, strings.TrimRight(aws.StringValue(event.Message), "\n"))
+		}
+		excerpts = append(excerpts, excerpt)
+	}
+	return excerpts, nil
+}
+
+// printTaskLogExcerpts prints the last log lines of each container in the task.
+func (sh *serviceHandler) printTaskLogExcerpts(task *ecs.Task, lines int64) {
+	excerpts, err := sh.taskLogExcerpts(task, lines)
+	if err != nil {
+		sh.log.errorf("There was an error reading the logs of task %s. Error: %s", taskId(aws.StringValue(task.TaskArn)), err)
+		return
+	}
+	for _, excerpt := range excerpts {
+		if len(excerpt.Lines) == 0 {
+			fmt.Printf("Container %s in task %s wrote no logs to %s.\n", excerpt.Container, taskId(aws.StringValue(task.TaskArn)), excerpt.LogStream)
+			continue
+		}
+		fmt.Printf("Last %d log lines of container %s in task %s:\n", len(excerpt.Lines), excerpt.Container, taskId(aws.StringValue(task.TaskArn)))
+		for _, line := range excerpt.Lines {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// logsClient returns a CloudWatch Logs client for the region, or the default region when it is empty.
+func (sh *serviceHandler) logsClient(region string) *cloudwatchlogs.CloudWatchLogs {
+	if region == "" {
+		return cloudwatchlogs.New(sh.awsSession)
+	}
+	return cloudwatchlogs.New(sh.awsSession, aws.NewConfig().WithRegion(region))
+}
@@ -1,46 +1,242 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/efs"
 	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
 )
 
+// unhealthyChecksBeforeReport is the number of consecutive unhealthy target group checks
+// before the health check configuration is printed to help diagnose the problem.
+const unhealthyChecksBeforeReport = 3
+
 var (
 	version = "development"
 
-	flagServiceName   = flag.String("service", "", "Service Name to track")
-	flagClusterName   = flag.String("cluster", "", "Cluster to find service")
+	flagConfig        = flag.String("config", "", "Path to a JSON or YAML config file. It can list the services to wait for and the flags for each, flags on the command line win")
+	flagServiceName   = flag.String("service", "", "Service Name to track. Comma separated names wait for several services at the same time. Can be the service ARN, or the ARN of one of its tasks, which also sets the -cluster and the region")
+	flagClusterName   = flag.String("cluster", "", "Cluster to find service. Can be the cluster ARN")
 	flagCheckInterval = flag.Int("check", 10, "Seconds between checks. Consider the ECS API rate limits heavily")
 	flagTimeout       = flag.Int("timeout", 10, "Timeout in minutes. If the deployment is still happening after the timeout, it will be considered a failure.")
-	flagVerbose       = flag.Bool("V", false, "Verbose logging")
+	flagFatalEvents   = flag.Bool("fail-on-fatal-events", true, "Fail straight away on service events that mean the deployment will not complete, like tasks that can't be placed")
+	flagEventsSince   = flag.Bool("events-since-deployment", false, "Only show the service events created after the deployment started in the trouble shooting information")
+	flagExpectRunning = flag.Int64("expect-running", -1, "Running count to expect. Fails if the desired count is different, like after a console edit or autoscaling. -1 trusts the desired count")
+	flagMinRunning    = flag.Int64("min-running", 0, "Wait for at least this many healthy tasks in the new deployment, for services where autoscaling changes the exact count")
+	flagMaxFailed     = flag.Int64("max-failed-tasks", -1, "Fail once the new deployment has more failed task launches than this. -1 disables the limit")
+	flagStability     = flag.Duration("stability-window", 15*time.Second, "How long the running count and target health must stay good before they are trusted")
+	flagIgnoreTargets = flag.String("ignore-targets", "", "Comma separated target IPs or instance IDs to ignore in the target group health check")
+	flagCheckListener = flag.Bool("check-listeners", false, "Check that the service target groups are referenced by at least one listener rule")
+	flagExpectHost    = flag.String("expect-host", "", "Host that the listener rules should route to the service target group. Implies -check-listeners")
+	flagExpectPath    = flag.String("expect-path", "", "Path that the listener rules should route to the service target group. Implies -check-listeners")
+	flagTrafficShare  = flag.Float64("traffic-share", 0, "Wait until the listener rules forward at least this percentage of their traffic to -traffic-target-group, for weighted blue/green target groups")
+	flagTrafficGroup  = flag.String("traffic-target-group", "", "Target group ARN for -traffic-share. Defaults to the first target group of the service")
+	flagCheckSecGroup = flag.Bool("check-security-groups", false, "Check that the task security groups allow the load balancer to reach the health check port")
+	flagVerbose       = flag.Bool("V", false, "Verbose logging, the same as -log-level debug")
+	flagLogging       = addLogFlags(flag.CommandLine)
+	flagRegion        = flag.String("region", "", regionUsage)
+	flagDebugAws      = flag.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID. For support cases with AWS and looking into throttling")
+	flagRedact        = flag.String("redact", `(?i)(password|passwd|secret|token|api[_-]?key|credential)`, "Regular expression for command arguments to redact from the printed details. Environment variable values and secrets are always redacted")
 	flagVersion       = flag.Bool("v", false, "Show version")
 	flagHelp          = flag.Bool("h", false, "Help menu")
+
+	flagExpectTaskDefinition = flag.String("expect-task-definition", "", "Task definition family:revision or ARN to wait to be ACTIVE before watching the service. For pipelines that register it straight before deploying")
+	flagExpectSubnets        = flag.String("expect-subnets", "", "Comma separated subnet IDs that the new deployment is expected to use")
+	flagExpectSecurityGroups = flag.String("expect-security-groups", "", "Comma separated security group IDs that the new deployment is expected to use")
+	flagExpectAssignPublicIp = flag.String("expect-assign-public-ip", "", "Expected public IP assignment of the new deployment, ENABLED or DISABLED")
+
+	flagExpectWebAcl = flag.String("expect-web-acl", "", "WAF web ACL ARN or name that the load balancers in front of the service must still be associated with after the deployment")
+
+	flagCheckSecrets = flag.Bool("check-secrets", false, "Check that the task definition secrets exist and the execution role can read them")
+
+	flagTaskRoleActions = flag.String("task-role-actions", "", "Comma separated IAM actions the task role must be allowed, optionally on a resource. Example: s3:GetObject=arn:aws:s3:::bucket/*,sqs:SendMessage")
+
+	flagCheckAutoscaling = flag.String("check-autoscaling", "", "Compare the desired count with the Application Auto Scaling bounds and target tracking policies. Set to warn or fail")
+
+	flagCheckCertificates = flag.String("check-certificates", "", "Check the ACM certificates of the HTTPS and TLS listeners in front of the service expire after -certificate-expiry-days. Set to warn or fail")
+	flagCertificateDays   = flag.Int("certificate-expiry-days", 30, "How many days the listener certificates must stay valid for -check-certificates")
+
+	flagCheckResources = flag.Bool("check-resources", false, "Warn when the task definition needs more CPU, memory or GPU than Fargate or the container instances provide")
+	flagExpectCpu      = flag.Int64("expect-cpu", 0, "Expected CPU units of the new task definition. Implies -check-resources")
+	flagExpectMemory   = flag.Int64("expect-memory", 0, "Expected memory in MiB of the new task definition. Implies -check-resources")
+
+	flagCheckEfs = flag.Bool("check-efs", false, "Check that EFS volumes have an available mount target in every availability zone of the service")
+
+	flagCheckLogs = flag.Bool("check-logs", false, "Check the log configuration of the task definition and that the new tasks are writing logs")
+
+	flagCheckImages = flag.Bool("check-images", false, "Check that the ECR images in the task definition exist and report their digests")
+	flagPinDigests  = flag.Bool("pin-image-digests", false, "Check that the new tasks run the image digests resolved before the wait. Implies -check-images")
+	flagMaxCritical = flag.Int64("max-critical-findings", -1, "Fail if an ECR image has more CRITICAL scan findings than this. -1 disables the gate. Implies -check-images")
+
+	flagImages = flag.String("image", "", "Comma separated container=image pairs to deploy with the deploy subcommand. Example: app=repo:tag")
+
+	flagScheduledRule = flag.String("scheduled-rule", "", "Verify an ECS scheduled task instead of a service. Waits until the next invocation of the EventBridge rule plus -timeout for it to run the task to completion")
+	flagEventBus      = flag.String("event-bus", "", "Event bus of the -scheduled-rule. Defaults to the default event bus")
+
+	flagPlatform        = flag.String("platform", "ecs", "Platform of the workload to wait for, ecs, eks, apprunner, lambda, beanstalk or asg. With apprunner -service is the App Runner service ARN")
+	flagWorkload        = flag.String("workload", "", "Kubernetes workload to wait for with -platform eks, like deployment/web or statefulset/db")
+	flagNamespace       = flag.String("namespace", "default", "Kubernetes namespace of the -workload")
+	flagFunction        = flag.String("function", "", "Lambda function to wait for with -platform lambda")
+	flagAlias           = flag.String("alias", "", "Lambda alias that CodeDeploy shifts traffic on with -platform lambda")
+	flagCodeDeployApp   = flag.String("codedeploy-app", "", "CodeDeploy application that deploys the -function")
+	flagCodeDeployGroup = flag.String("codedeploy-group", "", "CodeDeploy deployment group that deploys the -function. Its alarms are watched during the -soak")
+	flagEnvironment     = flag.String("environment", "", "Elastic Beanstalk environment to wait for with -platform beanstalk")
+	flagExpectVersion   = flag.String("expect-version", "", "Application version label the -environment is expected to run")
+	flagAsgName         = flag.String("asg", "", "EC2 Auto Scaling group whose instance refresh to wait for with -platform asg")
+
+	flagAllServices = flag.Bool("all-services", false, "Wait for every service in the -cluster at the same time, like after changing many of them at once")
+
+	flagDiscoverTag  = flag.String("discover-tag", "", "Check every service with this key=value tag in every account of the AWS organization is stable, instead of waiting for one service")
+	flagDiscoverRole = flag.String("discover-role", "OrganizationAccountAccessRole", "Role to assume in each account of the organization for -discover-tag")
+
+	flagMaxCpuUtilization    = flag.Float64("max-cpu-utilization", 0, "Fail if the service CPU utilization from Container Insights goes over this percentage after the deployment")
+	flagMaxMemoryUtilization = flag.Float64("max-memory-utilization", 0, "Fail if the service memory utilization from Container Insights goes over this percentage after the deployment")
+	flagHeadroomWindow       = flag.Duration("headroom-window", 3*time.Minute, "How long to watch utilization for -max-cpu-utilization and -max-memory-utilization")
+
+	flagCanaryWindow    = flag.Duration("canary-window", 0, "Compare the Container Insights task metrics of the new and old tasks for this long during the deployment")
+	flagCanaryThreshold = flag.Float64("canary-threshold", 20, "Fail the canary analysis if a metric of the new tasks is this many percent higher than the old tasks")
+	flagCanaryMetrics   = flag.String("canary-metrics", "CpuUtilized,MemoryUtilized", "Comma separated Container Insights task metrics to compare in the canary analysis")
+
+	flagAttempts     = flag.Int("attempts", 1, "Run the whole verification up to this many times before declaring a failure")
+	flagAttemptDelay = flag.Duration("attempt-delay", 30*time.Second, "Time to wait between verification attempts")
+
+	flagDeploymentTimeout = flag.Duration("deployment-timeout", 0, "How long to wait for the deployment to be COMPLETED. Defaults to -timeout")
+	flagCountTimeout      = flag.Duration("count-timeout", 0, "How long to wait for the running count to match the desired count. Defaults to -timeout")
+	flagHealthTimeout     = flag.Duration("health-timeout", 0, "How long to wait for the targets to become healthy. Defaults to -timeout")
+	flagSmokeTimeout      = flag.Duration("smoke-timeout", 0, "How long the -on-success-cmd, like smoke tests, can run before it is stopped and the run fails. 0 lets it run until the -deadline")
+
+	flagDeadline   = flag.String("deadline", "", "Wall clock time to give up at across every phase and attempt, in RFC3339 format. Example: 2024-05-01T14:30:00Z")
+	flagDeadlineIn = flag.Duration("deadline-in", 0, "Give up this long after starting across every phase and attempt. Alternative to -deadline")
+
+	flagStateFile = flag.String("state-file", "", "File to keep the tracked deployment and progress in. Running again with the same file resumes watching the same deployment")
+
+	flagHistoryDb  = flag.String("history-db", "", "Record the result and phase timings of every run in this database. Read it with the history subcommand")
+	flagSlowFactor = flag.Float64("slow-phase-factor", 2, "Warn when a phase takes this many times longer than the median of the successful runs in -history-db. 0 disables the warning")
+
+	flagCheckPlugins = flag.String("check-plugin", "", "Comma separated executables run every verification cycle with the service state as JSON on stdin. Exit 0 for healthy, 1 for unhealthy and 2 for fatal")
+	flagPreCmd       = flag.String("pre-cmd", "", "Shell command to run before waiting for the deployment. AWTY_DEPLOYMENT_ID and AWTY_TASK_DEFINITION are set in its environment")
+	flagOnSuccessCmd = flag.String("on-success-cmd", "", "Shell command to run when the service looks good. AWTY_RESULT, AWTY_DEPLOYMENT_ID and AWTY_DURATION are set in its environment")
+	flagOnFailureCmd = flag.String("on-failure-cmd", "", "Shell command to run when the service does not look good. AWTY_RESULT, AWTY_DEPLOYMENT_ID and AWTY_DURATION are set in its environment")
+
+	flagListen       = flag.String("listen", "", "Address to serve HTTP on while waiting, like :8080. Accepts ECS state change events from EventBridge API destinations on /events")
+	flagListenApiKey = flag.String("listen-api-key", "", "Value that requests to -listen must send in the X-Api-Key header")
+	flagListenDebug  = flag.Bool("listen-debug", false, "Serve pprof on /debug/pprof/ and the internal state of the watches on /debug/state with -listen")
+
+	flagRestartUnhealthy = flag.Int("restart-unhealthy", 0, "Stop up to this many tasks of the new deployment that become UNHEALTHY while waiting, so ECS replaces them. 0 disables restarts")
+
+	flagReapOldTasks = flag.Bool("reap-old-tasks", false, "Stop tasks still running an old task definition once the new deployment is COMPLETED and healthy")
+	flagProtectTasks = flag.Bool("protect-tasks", false, "Protect the new tasks from scale in and other deployments while the checks after the deployment run")
+
+	flagJsonOutput = flag.String("json-output", "", "Write the result, phase timings and the startup times of the new tasks as JSON to this file")
+	flagReport     = flag.String("report", "", "Write the result, phase timings and the startup times of the new tasks to this file in the -report-format")
+	flagReportAs   = flag.String("report-format", "json", "Format of the -report file: "+reportFormatNames())
+
+	flagTroubleshoot   = flag.String("troubleshoot", troubleshootFull, "How much trouble shooting information to print on failure, off, basic or full. basic leaves out the tasks that are still running, log excerpts and health check configuration")
+	flagTroubleEvents  = flag.Int("troubleshoot-events", 10, "Maximum number of service events in the trouble shooting information")
+	flagTroubleTasks   = flag.Int("troubleshoot-tasks", 5, "Maximum number of STOPPED tasks in the trouble shooting information")
+	flagTroubleSuccess = flag.Bool("troubleshoot-on-success", false, "Also print the trouble shooting information when the service looks good, for audit purposes")
+	flagBundle         = flag.String("bundle", "", "Write the service description, deployments, events, stopped tasks, target health and log excerpts as JSON files to this zip file on failure")
+
+	flagSoak = flag.Duration("soak", 0, "Keep watching the service for this long after all checks pass and fail if it becomes unhealthy")
+
+	flagCheckDns = flag.Bool("check-dns", false, "Check that the service discovery DNS name resolves to the new tasks")
+	flagDnsName  = flag.String("dns-name", "", "DNS name to resolve for -check-dns. Defaults to the name registered in Cloud Map")
 )
 
 type serviceHandler struct {
-	session        *ecs.ECS
-	elbv2Session   *elbv2.ELBV2
-	serviceName    *string
-	clusterName    *string
-	checkInterval  int
-	checkTimeout   int
-	versboseOutput bool
+	ctx           context.Context
+	session       *ecs.ECS
+	elbv2Session  *elbv2.ELBV2
+	ec2Session    *ec2.EC2
+	serviceName   *string
+	clusterName   *string
+	checkInterval int
+	checkTimeout  int
+	// log carries the cluster and service, so the json log says which service a line is about.
+	log logPrinter
+
+	awsSession              *session.Session
+	serviceDiscoverySession *servicediscovery.ServiceDiscovery
+	secretsManagerSession   *secretsmanager.SecretsManager
+	ssmSession              *ssm.SSM
+	iamSession              *iam.IAM
+	autoscalingSession      *applicationautoscaling.ApplicationAutoScaling
+	efsSession              *efs.EFS
+	cloudwatchSession       *cloudwatch.CloudWatch
 
 	describeServiceInput *ecs.DescribeServicesInput
 	currentOutput        *ecs.Service
+	taskDefinitionCache  map[string]*ecs.TaskDefinition
+	ignoredTargets       map[string]bool
+	stabilityWindow      time.Duration
+	eventTriggers        []eventTrigger
+	seenEvents           map[string]bool
+	notifyWebhook        string
+	maxFailedTasks       int64
+	deploymentTimeout    time.Duration
+	countTimeout         time.Duration
+	healthTimeout        time.Duration
+	waitState            *waitState
+	trackedDeployment    string
+	started              time.Time
+	currentPhase         string
+	phaseStarted         time.Time
+	phaseTimings         []phaseTiming
+	baselines            map[string]time.Duration
+	baselineFactor       float64
+	baselineWarnings     map[string]int
+	anomalies            anomalyObservations
+	checkers             []ecswait.Checker
+	wake                 chan struct{}
+	progress             progressStreams
+	unhealthyTargets     int
+	checks               int
+	maxRestarts          int
+	restarts             int
+	throttlingReported   bool
+	targetsInGrace       int
+	expectRunning        int64
+	minRunning           int64
+	redactor             *redactor
+	initialState         *serviceSnapshot
+	startRate            []rateSample
+	transitions          map[string]*taskTransition
+	trackTransitions     bool
+	// protectedTasks are protected from scale in until the on success command has run.
+	protectedTasks []*string
+
+	// lock guards the state of the wait that other goroutines read, see view.
+	lock sync.RWMutex
+	// cacheLock guards the task definition cache, which parallel checks share.
+	cacheLock sync.Mutex
 }
 
-func newServiceHandler(awsSession *session.Session, serviceName, clusterName string, checkInternval, checktimeout int) *serviceHandler {
+func newServiceHandler(ctx context.Context, awsSession *session.Session, serviceName, clusterName string, checkInternval, checktimeout int) *serviceHandler {
 	return &serviceHandler{
+		ctx:           ctx,
 		session:       ecs.New(awsSession),
 		elbv2Session:  elbv2.New(awsSession),
+		ec2Session:    ec2.New(awsSession),
 		serviceName:   aws.String(serviceName),
 		clusterName:   aws.String(clusterName),
 		checkInterval: checkInternval,
@@ -49,20 +245,55 @@ func newServiceHandler(awsSession *session.Session, serviceName, clusterName str
 			Cluster:  aws.String(clusterName),
 			Services: []*string{aws.String(serviceName)},
 		},
-		versboseOutput: false,
+		log:             logger.with("cluster", clusterName, "service", serviceName),
+		stabilityWindow: time.Second * 15,
+		started:         time.Now(),
+		wake:            make(chan struct{}, 1),
+		expectRunning:   -1,
+
+		awsSession:              awsSession,
+		serviceDiscoverySession: servicediscovery.New(awsSession),
+		secretsManagerSession:   secretsmanager.New(awsSession),
+		ssmSession:              ssm.New(awsSession),
+		iamSession:              iam.New(awsSession),
+		autoscalingSession:      applicationautoscaling.New(awsSession),
+		efsSession:              efs.New(awsSession),
+		cloudwatchSession:       cloudwatch.New(awsSession),
 	}
 }
 
-func (sh *serviceHandler) enableVerbosePrinting(trigger bool) {
-	sh.versboseOutput = trigger
+// ignoreTargets excludes targets from the target group health check by their IP address or instance ID.
+// Shared target groups can have targets that are draining or managed elsewhere that never become healthy.
+func (sh *serviceHandler) ignoreTargets(ids []string) {
+	sh.ignoredTargets = map[string]bool{}
+	for _, id := range ids {
+		sh.ignoredTargets[id] = true
+	}
+}
+
+// setStabilityWindow sets how long the running count and target health must stay good before we trust them.
+func (sh *serviceHandler) setStabilityWindow(window time.Duration) {
+	sh.stabilityWindow = window
+}
+
+// setPhaseTimeouts sets the timeouts of the deployment, running count and target health waits.
+// A timeout of 0 uses the -timeout minutes.
+func (sh *serviceHandler) setPhaseTimeouts(deployment, count, health time.Duration) {
+	sh.deploymentTimeout = deployment
+	sh.countTimeout = count
+	sh.healthTimeout = health
 }
 
-func (sh *serviceHandler) deploymentState(deployment *ecs.Deployment, desiredState string) bool {
-	return aws.StringValue(deployment.RolloutState) == desiredState
+// phaseTimeout returns the timeout of a phase, falling back to the overall timeout.
+func (sh *serviceHandler) phaseTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return time.Minute * time.Duration(sh.checkTimeout)
 }
 
 func (sh *serviceHandler) getActiveDeploymentId() string {
-	fmt.Println(sh.currentOutput.Deployments)
+	sh.log.debugf("Deployments: %s", sh.currentOutput.Deployments)
 	for _, deployment := range sh.currentOutput.Deployments {
 		if aws.StringValue(deployment.Status) == "PRIMARY" {
 			return aws.StringValue(deployment.Id)
@@ -71,227 +302,279 @@ func (sh *serviceHandler) getActiveDeploymentId() string {
 	return ""
 }
 
-func (sh *serviceHandler) describeServiceRaw() (*ecs.DescribeServicesOutput, error) {
-	return sh.session.DescribeServices(sh.describeServiceInput)
+func (sh *serviceHandler) primaryDeployment() *ecs.Deployment {
+	return ecswait.PrimaryDeployment(sh.currentOutput)
 }
 
-func (sh *serviceHandler) refresh() error {
-	output, err := sh.session.DescribeServices(sh.describeServiceInput)
-	if err != nil {
-		return err
-	}
-	if len(output.Services) == 0 {
-		return fmt.Errorf("service not found")
+// setMaxFailedTasks sets how many failed task launches the PRIMARY deployment can have before we give up.
+// A negative value disables the limit.
+func (sh *serviceHandler) setMaxFailedTasks(max int64) {
+	sh.maxFailedTasks = max
+}
+
+// setExpectedRunning sets the running count to expect instead of trusting the desired count.
+// A negative value trusts the desired count.
+func (sh *serviceHandler) setExpectedRunning(count int64) {
+	sh.expectRunning = count
+}
+
+// checkExpectedRunning fails when the desired count is not the running count the caller expects,
+// which happens when the count was changed in the console or by autoscaling.
+func (sh *serviceHandler) checkExpectedRunning() error {
+	desired := aws.Int64Value(sh.currentOutput.DesiredCount)
+	if sh.expectRunning >= 0 && desired != sh.expectRunning {
+		return fmt.Errorf("desired count is %d but %d running tasks are expected, it was changed outside of the deployment", desired, sh.expectRunning)
 	}
-	sh.currentOutput = output.Services[0]
 	return nil
 }
 
-func (sh *serviceHandler) printDetails() {
-	events := []*ecs.ServiceEvent{}
-	details := sh.currentOutput
-	details.Events = events
-	fmt.Println(details)
+// setMinRunning sets how many healthy tasks the PRIMARY deployment needs before it is good.
+// 0 turns the check off.
+func (sh *serviceHandler) setMinRunning(count int64) {
+	sh.minRunning = count
 }
 
-func (sh *serviceHandler) checkDeployments() error {
-	if err := sh.refresh(); err != nil {
+// checkFailFast looks for signs that the deployment will never converge so we can stop
+// waiting instead of running out the clock. Too many failed tasks are caught by the wait itself.
+func (sh *serviceHandler) checkFailFast() error {
+	if err := sh.checkEventTriggers(); err != nil {
 		return err
 	}
-
-	deploymentToCheck := sh.getActiveDeploymentId()
-	fmt.Printf("Current Primary deployment is: %s.\n", deploymentToCheck)
-	return sh.waitForDeployment(deploymentToCheck)
+	return sh.checkExpectedRunning()
 }
 
-func (sh *serviceHandler) waitForDeployment(deploymentId string) error {
-	isComplete := func() (string, bool) {
-		for _, deployment := range sh.currentOutput.Deployments {
-			if aws.StringValue(deployment.Id) == deploymentId {
-				if sh.deploymentState(deployment, "COMPLETED") {
-					fmt.Printf("Deployment %s is in state %s.\n", aws.StringValue(deployment.Id), aws.StringValue(deployment.RolloutState))
-					return aws.StringValue(deployment.RolloutState), true
-				} else {
-					return aws.StringValue(deployment.RolloutState), false
-				}
-			}
-		}
-		return "NOT_FOUND", false
+// whileWaiting runs on every check while we wait for the deployment, running count or targets.
+// The tasks are the ones the checks of the interval described, they are only described here when
+// no check needed them and something here does.
+func (sh *serviceHandler) whileWaiting(state *ecswait.State) {
+	sh.compareWithBaseline()
+	sh.reportThrottling()
+	if !sh.trackTransitions && sh.restarts >= sh.maxRestarts {
+		return
 	}
-
-	// Check the deployment is already finished. No need to wait the first check interval
-	if _, ok := isComplete(); ok {
-		return nil
+	tasks, err := state.Tasks(sh.ctx)
+	if err != nil {
+		sh.log.errorf("There was an error listing the tasks of the deployment. Error: %s", err)
+		return
 	}
-
-	checkTimer := time.NewTicker(time.Second * 10)
-	timeout := time.NewTicker(time.Minute * 10)
-	defer checkTimer.Stop()
-	defer timeout.Stop()
-
-	for {
-		select {
-		case <-checkTimer.C:
-			fmt.Printf("Checking if %s is now COMPLETED.\n", deploymentId)
-			if err := sh.refresh(); err != nil {
-				return err
-			}
-			status, ok := isComplete()
-			if ok {
-				return nil
-			}
-			if status == "NOT_FOUND" {
-				return fmt.Errorf("deployment disappeared")
-			}
-			fmt.Printf("Waiting another %d seconds for deployment %s to change to COMPLETED, currently %s.\n", sh.checkInterval, deploymentId, status)
-		case <-timeout.C:
-			return fmt.Errorf("timeouted out waiting for deployment to happen")
-		}
+	if sh.trackTransitions {
+		sh.observeTransitions(tasks)
 	}
+	sh.restartUnhealthyTasks(tasks)
 }
 
-func (sh *serviceHandler) checkPendingCount() error {
-	if err := sh.refresh(); err != nil {
+func (sh *serviceHandler) describeServiceRaw() (*ecs.DescribeServicesOutput, error) {
+	return sh.session.DescribeServicesWithContext(sh.ctx, sh.describeServiceInput)
+}
+
+func (sh *serviceHandler) refresh() error {
+	output, err := sh.session.DescribeServicesWithContext(sh.ctx, sh.describeServiceInput)
+	if err != nil {
 		return err
 	}
-
-	if aws.Int64Value(sh.currentOutput.DesiredCount) != aws.Int64Value(sh.currentOutput.RunningCount) {
-		err := sh.waitForRunningToMatchDesired()
-		if err != nil {
-			return err
-		}
+	if len(output.Services) == 0 {
+		return fmt.Errorf("service not found")
 	}
-
+	sh.observe(output.Services[0])
 	return nil
 }
 
-func (sh *serviceHandler) waitForRunningToMatchDesired() error {
-	isComplete := func() bool {
-		return aws.Int64Value(sh.currentOutput.DesiredCount) == aws.Int64Value(sh.currentOutput.RunningCount)
-	}
+// observe takes in a new description of the service.
+func (sh *serviceHandler) observe(service *ecs.Service) {
+	sh.update(func() {
+		sh.currentOutput = service
+		sh.checks++
+		sh.observeAnomalies()
+	})
+	sh.observeStartRate()
+	sh.publishProgress("status")
+}
 
-	if isComplete() {
-		return nil
+// printDetails prints the service without its events and the task definition it is configured
+// with. Credentials in the task definition are redacted as this ends up in CI logs.
+func (sh *serviceHandler) printDetails() {
+	details := *sh.currentOutput
+	details.Events = []*ecs.ServiceEvent{}
+	fmt.Println(&details)
+
+	td, err := sh.taskDefinition()
+	if err != nil {
+		sh.log.errorf("There was an error describing the task definition. Error: %s", err)
+		return
 	}
+	redactedTd, err := sh.redactor.taskDefinition(td)
+	if err != nil {
+		sh.log.errorf("There was an error redacting the task definition. Error: %s", err)
+		return
+	}
+	fmt.Println(redactedTd)
+}
 
-	checkTimer := time.NewTicker(time.Second * 10)
-	timeout := time.NewTicker(time.Minute * 10)
-	defer checkTimer.Stop()
-	defer timeout.Stop()
-
-	for {
-		select {
-		case <-checkTimer.C:
-			fmt.Println("Checking to see if RUNNING count matches DESIRED count.")
-			sh.refresh()
-			if isComplete() {
-				fmt.Println("Running count is currently correct, waiting 15 seconds to see it stays online.")
-				time.Sleep(time.Second * 15)
-				if isComplete() {
-					return nil
-				}
-			}
-			fmt.Printf("Waiting another %d seconds for running to match desired, currently desired: %d and running: %d.\n", sh.checkInterval, *sh.currentOutput.DesiredCount, *sh.currentOutput.RunningCount)
-		case <-timeout.C:
-			return fmt.Errorf("timeouted out waiting for desired to match running")
+// trackedDeploymentStart returns when the tracked deployment was created, falling back to the
+// PRIMARY deployment. The zero time is returned when neither is known.
+func (sh *serviceHandler) trackedDeploymentStart() time.Time {
+	for _, deployment := range sh.currentOutput.Deployments {
+		if aws.StringValue(deployment.Id) == sh.trackedDeployment {
+			return aws.TimeValue(deployment.CreatedAt)
 		}
 	}
+	if deployment := sh.primaryDeployment(); deployment != nil {
+		return aws.TimeValue(deployment.CreatedAt)
+	}
+	return time.Time{}
 }
 
-func (sh *serviceHandler) printLastNEvents(n int) error {
+// eventTimeFormat is how event times are shown in the trouble shooting information.
+const eventTimeFormat = "2006-01-02 15:04:05 MST"
+
+// printLastNEvents prints up to n distinct service events, newest first. Repeats of a message are
+// collapsed into one line with the count and when it was first seen. With sinceDeployment only
+// the events created after the tracked deployment started are printed.
+func (sh *serviceHandler) printLastNEvents(n int, sinceDeployment bool) error {
 	if err := sh.refresh(); err != nil {
 		return err
 	}
 
-	if len(sh.currentOutput.Events) == 0 {
-		fmt.Println("No events found")
-		return nil
+	since := time.Time{}
+	if sinceDeployment {
+		since = sh.trackedDeploymentStart()
 	}
-
-	if len(sh.currentOutput.Events) < n {
-		n = len(sh.currentOutput.Events) - 1
-		if n == 0 {
-			n = 1
+	events := []*ecs.ServiceEvent{}
+	for _, event := range sh.currentOutput.Events {
+		if aws.TimeValue(event.CreatedAt).Before(since) {
+			// Events are returned newest first.
+			break
 		}
+		events = append(events, event)
 	}
 
-	fmt.Println(sh.currentOutput.Events[0:n])
+	printed := 0
+	for _, summary := range summarizeEvents(events) {
+		if printed == n {
+			break
+		}
+		repeats := ""
+		if summary.count > 1 {
+			repeats = fmt.Sprintf(" (seen %d times, first at %s)", summary.count, summary.first.Local().Format(eventTimeFormat))
+		}
+		fmt.Printf("  %s (%s ago) %s%s\n", summary.last.Local().Format(eventTimeFormat), time.Since(summary.last).Round(time.Second), summary.message, repeats)
+		printed++
+	}
+	if printed == 0 {
+		fmt.Println("No events found")
+	}
 
 	return nil
 }
 
-func (sh *serviceHandler) printLastNTasks(n int) error {
-	tasksList, err := sh.session.ListTasks(&ecs.ListTasksInput{
-		Cluster:       sh.clusterName,
-		ServiceName:   sh.serviceName,
-		DesiredStatus: aws.String("STOPPED"),
-	})
+// logExcerptLines is how many of the last log lines of each container in a stopped task are shown.
+const logExcerptLines = 50
 
+// recentStoppedTasks returns up to n tasks of the service that stopped after the tracked
+// deployment started, most recently stopped first.
+func (sh *serviceHandler) recentStoppedTasks(n int) ([]*ecs.Task, error) {
+	tasks, err := sh.serviceTasks(ecs.DesiredStatusStopped)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(tasksList.TaskArns) == 0 {
-		fmt.Printf("AWS API returned no STOPPED tasks to show.")
-		return nil
+	since := sh.trackedDeploymentStart()
+	stopped := []*ecs.Task{}
+	for _, task := range tasks {
+		// Tasks that are still stopping have no stop time yet, they are the most recent.
+		if task.StoppedAt == nil || !aws.TimeValue(task.StoppedAt).Before(since) {
+			stopped = append(stopped, task)
+		}
 	}
 
-	if len(tasksList.TaskArns) < n {
-		n = len(tasksList.TaskArns) - 1
-		if n == 0 {
-			n = 1
+	sort.SliceStable(stopped, func(i, j int) bool {
+		if stopped[i].StoppedAt == nil || stopped[j].StoppedAt == nil {
+			return stopped[j].StoppedAt != nil
 		}
+		return aws.TimeValue(stopped[i].StoppedAt).After(aws.TimeValue(stopped[j].StoppedAt))
+	})
+	if len(stopped) > n {
+		stopped = stopped[:n]
 	}
+	return stopped, nil
+}
 
-	out, err := sh.session.DescribeTasks(&ecs.DescribeTasksInput{
-		Tasks:   tasksList.TaskArns[0:n],
-		Cluster: sh.clusterName,
-	})
+// printLastNTasks prints up to n tasks of the service that stopped after the tracked deployment
+// started, most recently stopped first, optionally followed by the end of their container logs.
+func (sh *serviceHandler) printLastNTasks(n int, withLogs bool) error {
+	stopped, err := sh.recentStoppedTasks(n)
 	if err != nil {
 		return err
 	}
+	if len(stopped) == 0 {
+		fmt.Println("AWS API returned no STOPPED tasks since the deployment started.")
+		return nil
+	}
 
-	fmt.Println(out)
+	printStoppedTaskTable(stopped)
+	if !withLogs {
+		return nil
+	}
+	for _, task := range stopped {
+		sh.printTaskLogExcerpts(task, logExcerptLines)
+	}
 
 	return nil
 }
 
+// checkTargetGroup checks the targets of the first target group of the service are healthy.
+// The caller refreshes the service first.
 func (sh *serviceHandler) checkTargetGroup() (bool, error) {
-	if err := sh.refresh(); err != nil {
+	health, err := sh.waiter().TargetHealth(sh.ctx, sh.currentOutput)
+	if err != nil {
 		return false, err
 	}
+	sh.recordTargetHealth(health)
+	return health.Healthy(), nil
+}
 
-	if len(sh.currentOutput.LoadBalancers) == 0 {
-		fmt.Println("No load balancer to check.")
-		return true, nil
-	}
-
-	healthOutput, err := sh.elbv2Session.DescribeTargetHealth(
-		&elbv2.DescribeTargetHealthInput{
-			TargetGroupArn: sh.currentOutput.LoadBalancers[0].TargetGroupArn,
-		},
-	)
-	if err != nil {
-		return false, err
+// recordTargetHealth logs the targets that are not healthy and keeps the counts for the status,
+// the metrics and the soak.
+func (sh *serviceHandler) recordTargetHealth(health ecswait.TargetHealth) {
+	for _, target := range health.InGracePeriod {
+		sh.log.debugf("Target %s:%d is %s but its task is in the %s health check grace period.",
+			aws.StringValue(target.Target.Id), aws.Int64Value(target.Target.Port), aws.StringValue(target.TargetHealth.State), ecswait.HealthCheckGracePeriod(sh.currentOutput))
 	}
-	allHealthy := true
-	for _, target := range healthOutput.TargetHealthDescriptions {
-		if aws.StringValue(target.TargetHealth.State) != "healthy" {
-			allHealthy = false
-		}
+	for _, target := range health.Unhealthy {
+		sh.log.progressf("Target %s:%d is %s. Reason: %s, Description: %s",
+			aws.StringValue(target.Target.Id),
+			aws.Int64Value(target.Target.Port),
+			colorState(aws.StringValue(target.TargetHealth.State)),
+			aws.StringValue(target.TargetHealth.Reason),
+			aws.StringValue(target.TargetHealth.Description),
+		)
 	}
+	sh.update(func() {
+		sh.unhealthyTargets = len(health.Unhealthy)
+		sh.targetsInGrace = len(health.InGracePeriod)
+	})
+}
 
-	if !allHealthy {
-		return false, nil
-	}
+func main() {
+	// Interrupting the run cancels the wait and any AWS requests in flight.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	return true, nil
+	if len(os.Args) > 1 {
+		if command, ok := findSubcommand(os.Args[1]); ok {
+			command.run(ctx, os.Args[2:])
+			return
+		}
+	}
+	runWait(ctx, os.Args[1:], false)
 }
 
-func main() {
-	flag.Parse()
+// runWait is the wait subcommand, and what runs without a subcommand. With deploy the service is
+// updated with the -image first.
+func runWait(ctx context.Context, args []string, deploy bool) {
+	flag.CommandLine.Parse(args)
 	if *flagHelp {
-		flag.PrintDefaults()
+		printUsage()
 		return
 	}
 
@@ -300,90 +583,651 @@ func main() {
 		return
 	}
 
-	awsSession, err := session.NewSession()
+	var runs []serviceRun
+	if *flagConfig != "" {
+		var err error
+		runs, err = applyConfig(*flagConfig)
+		if err != nil {
+			logger.errorf("There was an error loading the config. Error: %s", err)
+			os.Exit(1)
+		}
+	}
+	// The config file can set the log flags too.
+	setupLogging(flagLogging, *flagVerbose)
+	deadline, err := parseDeadline(*flagDeadline, *flagDeadlineIn, time.Now())
+	if err != nil {
+		logger.errorf("Bad value for -deadline. Error: %s", err)
+		os.Exit(1)
+	}
+	// The deadline covers everything from here on, the deploy and every phase and attempt.
+	ctx, cancel := withDeadline(ctx, deadline)
+	defer cancel()
+	if len(runs) > 0 {
+		runMultipleServices(ctx, runs, deploy)
+		return
+	}
+
+	switch *flagTroubleshoot {
+	case troubleshootOff, troubleshootBasic, troubleshootFull:
+	default:
+		logger.errorf("Bad value for -troubleshoot %q, use off, basic or full.", *flagTroubleshoot)
+		os.Exit(1)
+	}
+	if _, ok := reportFormats[*flagReportAs]; !ok {
+		logger.errorf("Bad value for -report-format %q, use %s.", *flagReportAs, reportFormatNames())
+		os.Exit(1)
+	}
+
+	if *flagAllServices && (*flagServiceName != "" || *flagClusterName == "") {
+		logger.errorf("-all-services needs a -cluster and no -service.")
+		os.Exit(1)
+	}
+	if services := splitList(*flagServiceName); len(services) > 1 && *flagPlatform == "ecs" {
+		runMultipleServices(ctx, serviceRuns(services), deploy)
+		return
+	}
+
+	// With -platform apprunner -service is an App Runner ARN.
+	target := ecsResource{}
+	if *flagPlatform == "ecs" {
+		target, err = applyArnFlags()
+		if err != nil {
+			logger.errorf("There was an error with the ARN. Error: %s", err)
+			os.Exit(1)
+		}
+	}
+	// The service is in the region of its ARN, whatever the AWS configuration says.
+	region, err := arnRegion(*flagRegion, target)
+	if err != nil {
+		logger.errorf("There was an error with the ARN. Error: %s", err)
+		os.Exit(1)
+	}
+	awsSession, err := newAwsSession(region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if aws.StringValue(awsSession.Config.Region) == "" {
+		logger.errorf("No AWS region is configured. Use -region or set AWS_REGION.")
+		os.Exit(1)
+	}
+	if *flagDebugAws {
+		debugAwsRequests(awsSession)
+	}
+	switch *flagPlatform {
+	case "ecs":
+	case "eks":
+		verifyEksWorkload(ctx, awsSession)
+		return
+	case "apprunner":
+		verifyAppRunnerService(ctx, awsSession)
+		return
+	case "lambda":
+		verifyLambdaAlias(ctx, awsSession)
+		return
+	case "beanstalk":
+		verifyBeanstalkEnvironment(ctx, awsSession)
+		return
+	case "asg":
+		verifyInstanceRefresh(ctx, awsSession)
+		return
+	default:
+		logger.errorf("Bad value for -platform %q, use ecs, eks, apprunner, lambda, beanstalk or asg.", *flagPlatform)
+		os.Exit(1)
+	}
+	if *flagScheduledRule != "" {
+		verifyScheduledTask(ctx, awsSession)
+		return
+	}
+	if *flagDiscoverTag != "" {
+		sweepOrganization(ctx, awsSession, *flagDiscoverRole, *flagDiscoverTag)
+		return
+	}
+	if *flagAllServices {
+		services, err := clusterServiceArns(ctx, ecs.New(awsSession), *flagClusterName)
+		if err != nil {
+			logger.errorf("There was an error listing the services of the cluster. Error: %s", err)
+			os.Exit(1)
+		}
+		if len(services) == 0 {
+			logger.infof("There are no services in cluster %s.", *flagClusterName)
+			return
+		}
+		runMultipleServices(ctx, serviceRuns(services), deploy)
+		return
+	}
+
+	if target.account != "" {
+		checkArnAccount(ctx, awsSession, target.account)
+	}
+	if target.kind == "task" {
+		service, err := taskService(ctx, ecs.New(awsSession), *flagClusterName, target.arn)
+		if err != nil {
+			logger.errorf("There was an error finding the service of the task. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Task %s belongs to service %s.", target.name, service)
+		*flagServiceName = service
+	}
+
+	ecsService := newServiceHandler(ctx, awsSession, *flagServiceName, *flagClusterName, *flagCheckInterval, *flagTimeout)
+	redact, err := newRedactor(*flagRedact)
 	if err != nil {
-		fmt.Println("There was an error starting the AWS Session. Error:", err)
+		logger.errorf("Bad value for -redact. Error: %s", err)
 		os.Exit(1)
 	}
-	ecsService := newServiceHandler(awsSession, *flagServiceName, *flagClusterName, *flagCheckInterval, *flagTimeout)
-	ecsService.enableVerbosePrinting(*flagVerbose)
+	ecsService.setRedactor(redact)
+	ecsService.ignoreTargets(splitList(*flagIgnoreTargets))
+	ecsService.setStabilityWindow(*flagStability)
+	ecsService.setMaxFailedTasks(*flagMaxFailed)
+	ecsService.setExpectedRunning(*flagExpectRunning)
+	ecsService.setMinRunning(*flagMinRunning)
+	ecsService.setMaxRestarts(*flagRestartUnhealthy)
+	ecsService.setCheckPlugins(splitList(*flagCheckPlugins))
+	ecsService.setPhaseTimeouts(*flagDeploymentTimeout, *flagCountTimeout, *flagHealthTimeout)
+	ecsService.setTrackTransitions(*flagJsonOutput != "" || *flagReport != "" || *flagHistoryDb != "")
+	triggers := []eventTrigger{}
+	if *flagFatalEvents {
+		triggers = append(triggers, builtinEventTriggers...)
+	}
+	if *flagConfig != "" {
+		cfg, err := loadConfig(*flagConfig)
+		if err != nil {
+			logger.errorf("There was an error loading the config. Error: %s", err)
+			os.Exit(1)
+		}
+		configTriggers, err := cfg.eventTriggers()
+		if err != nil {
+			logger.errorf("There was an error in the config. Error: %s", err)
+			os.Exit(1)
+		}
+		triggers = append(triggers, configTriggers...)
+		ecsService.setNotifyWebhook(cfg.NotifyWebhook)
+	}
+	ecsService.setEventTriggers(triggers)
+
+	if *flagHistoryDb != "" {
+		records, err := loadHistory(*flagHistoryDb, *flagClusterName, *flagServiceName)
+		if err != nil {
+			logger.errorf("There was an error reading the history, not comparing with previous runs. Error: %s", err)
+		}
+		ecsService.setBaselines(phaseBaselines(records), *flagSlowFactor)
+	}
+
+	if deploy {
+		images, err := parseImages(*flagImages)
+		if err != nil {
+			logger.errorf("Bad value for -image. Error: %s", err)
+			os.Exit(1)
+		}
+		if _, err := ecsService.deployImages(images); err != nil {
+			logger.errorf("The deploy failed. Error: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if *flagExpectTaskDefinition != "" {
+		logger.infof("Waiting for task definition %s to be visible.", *flagExpectTaskDefinition)
+		if err := ecsService.waitForTaskDefinition(*flagExpectTaskDefinition); err != nil {
+			logger.errorf("The task definition check failed. Error: %s", err)
+			os.Exit(1)
+		}
+	}
 
 	// check that we can lookup the service in AWS ECS
 	serviceDetails, err := ecsService.describeServiceRaw()
 	if err != nil {
-		fmt.Printf("Error describing service. Error: %s", err)
+		logger.errorf("Error describing service. Error: %s", err)
 		os.Exit(1)
 	}
 	if len(serviceDetails.Services) == 0 {
-		fmt.Println("Service not found")
-		verbosePrint("%s\n", serviceDetails)
+		logger.infof("Service not found")
+		logger.debugf("%s", serviceDetails)
 		os.Exit(1)
 	}
 
 	err = ecsService.refresh()
 	if err != nil {
-		fmt.Printf("Failed to refresh service details. Error: %s\n", err)
+		logger.errorf("Failed to refresh service details. Error: %s", err)
 		os.Exit(1)
 	}
+	ecsService.captureInitialState()
 
-	if *flagVerbose {
+	if ecsService.log.verbose() {
 		ecsService.printDetails()
 	}
+	ecsService.printDeploymentConfigurationWarnings()
+
+	if *flagListen != "" {
+		srv := newServer(*flagListenApiKey)
+		srv.addWatch(*flagServiceName, ecsService)
+		if *flagListenDebug {
+			srv.enableDebug()
+		}
+		srv.start(*flagListen)
+		go srv.validateCredentials(ctx, awsSession)
+	}
+
+	if *flagCheckListener || *flagExpectHost != "" || *flagExpectPath != "" {
+		logger.infof("Checking the listener rules route to the service target groups.")
+		if err := ecsService.checkListenerRules(*flagExpectHost, *flagExpectPath); err != nil {
+			logger.errorf("The listener rules check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Listener rules checked.")
+	}
+
+	switch *flagCheckCertificates {
+	case "":
+	case "warn", "fail":
+		logger.infof("Checking the listener certificates expiry.")
+		if err := ecsService.checkCertificateExpiry(*flagCertificateDays); err != nil {
+			if *flagCheckCertificates == "fail" {
+				logger.errorf("The certificate check failed. Error: %s", err)
+				os.Exit(1)
+			}
+			logger.warnf("%s", err)
+		}
+		logger.infof("Listener certificates checked.")
+	default:
+		logger.errorf("Bad value for -check-certificates %q, use warn or fail.", *flagCheckCertificates)
+		os.Exit(1)
+	}
+
+	if *flagCheckSecGroup {
+		logger.infof("Checking the load balancer can reach the tasks.")
+		if err := ecsService.checkSecurityGroupReachability(); err != nil {
+			logger.errorf("The security group check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Security groups checked.")
+	}
+
+	assignPublicIp, err := parseAssignPublicIp(*flagExpectAssignPublicIp)
+	if err != nil {
+		logger.errorf("Bad value for -expect-assign-public-ip. Error: %s", err)
+		os.Exit(1)
+	}
+	expectedNetwork := networkExpectations{
+		subnets:        splitList(*flagExpectSubnets),
+		securityGroups: splitList(*flagExpectSecurityGroups),
+		assignPublicIp: assignPublicIp,
+	}
+	if !expectedNetwork.empty() {
+		logger.infof("Checking the network configuration of the new deployment.")
+		if err := ecsService.checkNetworkConfiguration(expectedNetwork); err != nil {
+			logger.errorf("The network configuration check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Network configuration checked.")
+	}
+
+	if *flagCheckSecrets {
+		logger.infof("Checking the task definition secrets can be resolved.")
+		if err := ecsService.checkSecrets(); err != nil {
+			logger.errorf("The secrets check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Secrets checked.")
+	}
 
-	// Is there a deployment on going?
-	fmt.Println("Looking at deployments status.")
-	err = ecsService.checkDeployments()
+	requiredPermissions, err := parseRequiredPermissions(*flagTaskRoleActions)
 	if err != nil {
-		fmt.Printf("there was an error while checking the state of deployments. Error: %s\n", err)
-		exitOut(ecsService, 1)
+		logger.errorf("Bad value for -task-role-actions. Error: %s", err)
+		os.Exit(1)
+	}
+	if len(requiredPermissions) > 0 {
+		logger.infof("Checking the task role permissions.")
+		if err := ecsService.checkTaskRolePermissions(requiredPermissions); err != nil {
+			logger.errorf("The task role check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Task role permissions checked.")
 	}
-	fmt.Println("Deployments checked.")
 
-	serviceOk := false
-	for !serviceOk {
-		// Is the desired count the same as the running count.
-		fmt.Println("Checking that running matches desired tasks.")
-		err = ecsService.checkPendingCount()
+	if *flagCheckResources || *flagExpectCpu > 0 || *flagExpectMemory > 0 {
+		logger.infof("Checking the task definition resource requirements.")
+		if err := ecsService.checkResources(*flagExpectCpu, *flagExpectMemory); err != nil {
+			logger.errorf("The resource requirements check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Resource requirements checked.")
+	}
+
+	if *flagCheckEfs {
+		logger.infof("Checking the EFS mount targets.")
+		if err := ecsService.checkEfsMountTargets(); err != nil {
+			logger.errorf("The EFS check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("EFS mount targets checked.")
+	}
+
+	if *flagCheckLogs {
+		logger.infof("Checking the log configuration.")
+		if err := ecsService.checkLogConfiguration(); err != nil {
+			logger.errorf("The log configuration check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Log configuration checked.")
+	}
+
+	pinnedImages := []resolvedImage{}
+	if *flagCheckImages || *flagPinDigests || *flagMaxCritical >= 0 {
+		logger.infof("Checking the task definition images exist.")
+		pinnedImages, err = ecsService.checkImages()
 		if err != nil {
-			fmt.Printf("There was an error checking the pending count. Error: %s\n", err)
-			exitOut(ecsService, 1)
+			logger.errorf("The image check failed. Error: %s", err)
+			os.Exit(1)
 		}
-		fmt.Println("Checking the target group is in a good state.")
-		ok, err := ecsService.checkTargetGroup()
+		logger.infof("Images checked.")
+	}
+	if *flagMaxCritical >= 0 {
+		logger.infof("Checking the image scan findings.")
+		if err := ecsService.checkScanFindings(pinnedImages, *flagMaxCritical); err != nil {
+			logger.errorf("The image scan check failed. Error: %s", err)
+			os.Exit(1)
+		}
+		logger.infof("Image scan findings checked.")
+	}
+
+	switch *flagCheckAutoscaling {
+	case "":
+	case "warn", "fail":
+		logger.infof("Checking the desired count against the autoscaling bounds and targets.")
+		if err := ecsService.checkAutoscalingBounds(); err != nil {
+			if *flagCheckAutoscaling == "fail" {
+				logger.errorf("The autoscaling check failed. Error: %s", err)
+				os.Exit(1)
+			}
+			logger.warnf("%s", err)
+		}
+		logger.infof("Autoscaling bounds and targets checked.")
+	default:
+		logger.errorf("Bad value for -check-autoscaling %q, use warn or fail.", *flagCheckAutoscaling)
+		os.Exit(1)
+	}
+
+	if *flagPreCmd != "" {
+		logger.infof("Running the pre command.")
+		if err := runHook(ctx, *flagPreCmd, ecsService.deploymentEnv()); err != nil {
+			logger.errorf("The pre command failed. Error: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	firstAttempt := 1
+	if *flagStateFile != "" {
+		state, err := loadWaitState(*flagStateFile, *flagClusterName, *flagServiceName)
 		if err != nil {
-			fmt.Printf("There was an error checking the service target group. Error: %s\n", err)
+			logger.errorf("There was an error loading the state file. Error: %s", err)
+			os.Exit(1)
+		}
+		if state.DeploymentId != "" {
+			logger.infof("Resuming attempt %d for deployment %s from the %s phase, started at %s.", state.Attempt, state.DeploymentId, state.Phase, state.Started.Format(time.RFC3339))
+		}
+		firstAttempt = state.Attempt
+		ecsService.setWaitState(state)
+	}
+
+	attempts := *flagAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := firstAttempt; ; attempt++ {
+		if ecsService.waitState != nil {
+			ecsService.waitState.Attempt = attempt
+		}
+		err := verifyService(ecsService, pinnedImages)
+		if err == nil {
+			break
+		}
+		ecsService.releaseTaskProtection()
+		if deadlineReached(ctx) {
+			logger.infof("Reached the deadline %s before the service looked good.", deadline.Format(time.RFC3339))
 			exitOut(ecsService, 1)
 		}
-		if ok {
-			serviceOk = true
+		if attempt >= attempts {
+			if ecsService.waitState != nil {
+				ecsService.waitState.remove()
+			}
+			exitOut(ecsService, 1)
+		}
+		logger.infof("Verification attempt %d of %d failed, trying again in %s.", attempt, attempts, *flagAttemptDelay)
+		if sleepContext(ctx, *flagAttemptDelay) != nil {
+			exitOut(ecsService, 1)
+		}
+	}
+
+	if ecsService.log.verbose() {
+		if err := ecsService.printTaskEndpoints(); err != nil {
+			logger.errorf("There was an error looking up the task endpoints. Error: %s", err)
+		}
+	}
+
+	if *flagTroubleSuccess {
+		ecsService.printTroubleshooting(*flagTroubleshoot, *flagTroubleEvents, *flagTroubleTasks)
+	}
+	if ecsService.waitState != nil {
+		ecsService.waitState.remove()
+	}
+	ecsService.printAnomalies()
+	ecsService.printStateDiff()
+	ecsService.sampleTransitions()
+	ecsService.printTransitionSummary()
+	writeReports(ecsService, "success")
+	recordHistory(ecsService, "success")
+	ecsService.publishResult("success")
+	var hookErr error
+	if *flagOnSuccessCmd != "" {
+		logger.infof("Running the on success command.")
+		hookErr = runSuccessHook(ctx, *flagOnSuccessCmd, ecsService.resultEnv("success"))
+	}
+	// The protection covers the on success command, like smoke tests against the new tasks.
+	ecsService.releaseTaskProtection()
+	if hookErr != nil {
+		logger.errorf("The on success command failed. Error: %s", hookErr)
+		os.Exit(1)
+	}
+	logger.infof("Service looks good.")
+}
+
+// verifyService waits for the deployment to finish and runs every check against the service.
+// Failures are printed as they happen and the error is returned so the caller can retry.
+func verifyService(ecsService *serviceHandler, pinnedImages []resolvedImage) error {
+	if *flagCanaryWindow > 0 {
+		ecsService.recordPhase("canary")
+		ecsService.log.infof("Comparing the new tasks with the old tasks.")
+		if err := ecsService.canaryAnalysis(*flagCanaryWindow, *flagCanaryThreshold, splitList(*flagCanaryMetrics)); err != nil {
+			ecsService.log.errorf("The canary analysis failed. Error: %s", err)
+			return err
+		}
+	}
+
+	waiter := ecsService.waiter()
+	ecsService.log.infof("Running the %s checks.", strings.Join(waiter.CheckNames(), ", "))
+	if _, err := waiter.Wait(ecsService.ctx); err != nil {
+		ecsService.log.errorf("There was an error checking the service. Error: %s", err)
+		return err
+	}
+
+	if len(ecsService.currentOutput.LoadBalancers) > 1 || *flagTrafficShare > 0 {
+		if err := ecsService.printTargetGroupWeights(); err != nil {
+			ecsService.log.errorf("There was an error describing the target group weights. Error: %s", err)
+		}
+	}
+	if *flagTrafficShare > 0 {
+		targetGroupArn := *flagTrafficGroup
+		if targetGroupArn == "" && len(ecsService.currentOutput.LoadBalancers) > 0 {
+			targetGroupArn = aws.StringValue(ecsService.currentOutput.LoadBalancers[0].TargetGroupArn)
+		}
+		ecsService.log.infof("Waiting for target group %s to get %.0f%% of the traffic.", targetGroupArn, *flagTrafficShare)
+		if err := ecsService.waitForTrafficShare(targetGroupArn, *flagTrafficShare, ecsService.phaseTimeout(ecsService.healthTimeout)); err != nil {
+			ecsService.log.errorf("The traffic share check failed. Error: %s", err)
+			return err
+		}
+	}
+
+	if *flagReapOldTasks {
+		ecsService.log.infof("Looking for tasks still running an old task definition.")
+		if err := ecsService.reapOldTasks(); err != nil {
+			ecsService.log.errorf("There was an error stopping the old tasks. Error: %s", err)
+			return err
+		}
+	}
+
+	ecsService.recordPhase("post deployment checks")
+	if *flagProtectTasks {
+		// Cover everything that runs after this point.
+		period := *flagSoak + *flagSmokeTimeout
+		if *flagMaxCpuUtilization > 0 || *flagMaxMemoryUtilization > 0 {
+			period += *flagHeadroomWindow
+		}
+		// The protection is released once the on success command has run, see releaseTaskProtection.
+		protected, err := ecsService.protectDeploymentTasks(period)
+		if err != nil {
+			ecsService.log.warnf("the new tasks could not be protected. Error: %s", err)
 		} else {
-			fmt.Printf("Waiting %d seconds before checking tasks again.\n", *flagCheckInterval)
-			time.Sleep(time.Second * time.Duration(*flagCheckInterval))
+			ecsService.protectedTasks = protected
+		}
+	}
+	if *flagPinDigests {
+		ecsService.log.infof("Checking the new tasks run the resolved image digests.")
+		if err := ecsService.checkRunningDigests(pinnedImages); err != nil {
+			ecsService.log.errorf("The image digest check failed. Error: %s", err)
+			return err
+		}
+	}
+
+	if *flagExpectWebAcl != "" {
+		ecsService.log.infof("Checking the load balancer web ACL association.")
+		if err := ecsService.checkWebAcl(*flagExpectWebAcl); err != nil {
+			ecsService.log.errorf("The web ACL check failed. Error: %s", err)
+			return err
+		}
+	}
+
+	if *flagCheckLogs {
+		ecsService.log.infof("Checking the new tasks are writing logs.")
+		if err := ecsService.checkTasksEmitLogs(); err != nil {
+			ecsService.log.errorf("There was an error checking the task logs. Error: %s", err)
+		}
+	}
+
+	if *flagCheckDns {
+		dnsName := *flagDnsName
+		if dnsName == "" {
+			var err error
+			dnsName, err = ecsService.serviceDnsName()
+			if err != nil {
+				ecsService.log.errorf("There was an error finding the service DNS name. Error: %s", err)
+				return err
+			}
+		}
+		ecsService.log.infof("Checking %s resolves to the new tasks.", dnsName)
+		if err := ecsService.waitForDnsToMatchTasks(dnsName); err != nil {
+			ecsService.log.errorf("The DNS check failed. Error: %s", err)
+			return err
 		}
 	}
 
-	fmt.Println("Service looks good.")
+	if *flagMaxCpuUtilization > 0 || *flagMaxMemoryUtilization > 0 {
+		ecsService.log.infof("Checking the new tasks have resource headroom.")
+		if err := ecsService.checkResourceHeadroom(*flagHeadroomWindow, *flagMaxCpuUtilization, *flagMaxMemoryUtilization); err != nil {
+			ecsService.log.errorf("The resource headroom check failed. Error: %s", err)
+			return err
+		}
+	}
+
+	if *flagSoak > 0 {
+		ecsService.recordPhase("soak")
+		ecsService.log.infof("Soaking the service for %s.", *flagSoak)
+		if err := ecsService.soak(*flagSoak); err != nil {
+			ecsService.log.errorf("The service failed during the soak period. Error: %s", err)
+			return err
+		}
+		ecsService.log.infof("Soak period completed.")
+	}
+
+	return nil
+}
+
+func verifyScheduledTask(ctx context.Context, awsSession *session.Session) {
+	scheduledTask := newScheduledTaskHandler(ctx, awsSession, *flagScheduledRule, *flagEventBus, *flagCheckInterval, *flagTimeout)
+
+	logger.infof("Checking the scheduled task rule.")
+	if err := scheduledTask.checkRule(); err != nil {
+		logger.errorf("The scheduled task rule check failed. Error: %s", err)
+		os.Exit(1)
+	}
+
+	logger.infof("Waiting for the next invocation of the rule.")
+	if err := scheduledTask.waitForInvocation(); err != nil {
+		logger.errorf("The scheduled task did not complete successfully. Error: %s", err)
+		os.Exit(1)
+	}
+
+	logger.infof("Scheduled task looks good.")
 }
 
 func showVersion() {
 	fmt.Println(version)
 }
 
-func verbosePrint(format string, args ...interface{}) {
-	if *flagVerbose {
-		fmt.Printf(format, args...)
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// cleanupTimeout is how long the clean up after an interrupted wait can take, like putting the
+// traffic weights back or writing the troubleshooting output.
+const cleanupTimeout = 30 * time.Second
+
+// sleepContext waits for the duration, or returns the error of the context if it is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func exitOut(ecsService *serviceHandler, code int) {
-	fmt.Printf("Here is some trouble shooting information for %s.\n", *ecsService.serviceName)
-	fmt.Println("Historical events, showing maximum 10:")
-	if err := ecsService.printLastNEvents(10); err != nil {
-		fmt.Printf("There was an error listing the events. Error: %s", err)
-	}
-	fmt.Println("STOPPED services, showing maximum 5:")
-	if err := ecsService.printLastNTasks(5); err != nil {
-		fmt.Printf("There was an error listing the STOPPED tasks. Error: %s", err)
+	if ecsService.ctx.Err() != nil {
+		// The wait was interrupted, the troubleshooting still needs to call AWS.
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		ecsService.ctx = ctx
+	}
+	ecsService.releaseTaskProtection()
+	ecsService.printTroubleshooting(*flagTroubleshoot, *flagTroubleEvents, *flagTroubleTasks)
+	ecsService.printAnomalies()
+	ecsService.printStateDiff()
+	ecsService.sampleTransitions()
+	ecsService.printTransitionSummary()
+	if *flagBundle != "" {
+		ecsService.log.infof("Writing the trouble shooting bundle to %s.", *flagBundle)
+		if err := ecsService.writeBundle(*flagBundle); err != nil {
+			ecsService.log.errorf("There was an error writing the trouble shooting bundle. Error: %s", err)
+		}
+	}
+	writeReports(ecsService, "failed")
+	recordHistory(ecsService, "failed")
+	ecsService.publishResult("failed")
+	if *flagOnFailureCmd != "" {
+		ecsService.log.infof("Running the on failure command.")
+		if err := runHook(context.Background(), *flagOnFailureCmd, ecsService.resultEnv("failed")); err != nil {
+			ecsService.log.errorf("The on failure command failed. Error: %s", err)
+		}
 	}
 	os.Exit(code)
 }
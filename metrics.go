@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+var rolloutStates = []string{
+	ecs.DeploymentRolloutStateInProgress,
+	ecs.DeploymentRolloutStateCompleted,
+	ecs.DeploymentRolloutStateFailed,
+}
+
+// handleMetrics serves the state of the watches the request may see in the Prometheus text format.
+func (srv *server) handleMetrics(w http.ResponseWriter, r *http.Request, visible func(id string) bool) {
+	ids, byId := srv.visibleWatches(visible)
+	watches := []*serviceHandler{}
+	for _, id := range ids {
+		watches = append(watches, byId[id])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	views := map[*serviceHandler]handlerView{}
+	for _, sh := range watches {
+		views[sh] = sh.view()
+	}
+	metric := func(name, kind, help string, value func(sh *serviceHandler, view handlerView, labels string)) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, sh := range watches {
+			value(sh, views[sh], fmt.Sprintf(`cluster="%s",service="%s"`, escapeLabel(aws.StringValue(sh.clusterName)), escapeLabel(aws.StringValue(sh.serviceName))))
+		}
+	}
+
+	// count writes a metric from one of the counts in the service description.
+	count := func(name string, value func(service *ecs.Service) *int64) func(sh *serviceHandler, view handlerView, labels string) {
+		return func(sh *serviceHandler, view handlerView, labels string) {
+			if view.service != nil {
+				fmt.Fprintf(w, "%s{%s} %d\n", name, labels, aws.Int64Value(value(view.service)))
+			}
+		}
+	}
+
+	metric("awty_rollout_state", "gauge", "Rollout state of the PRIMARY deployment, 1 for the current state.", func(sh *serviceHandler, view handlerView, labels string) {
+		current := ""
+		if deployment := ecswait.PrimaryDeployment(view.service); deployment != nil {
+			current = aws.StringValue(deployment.RolloutState)
+		}
+		for _, state := range rolloutStates {
+			value := 0
+			if state == current {
+				value = 1
+			}
+			fmt.Fprintf(w, "awty_rollout_state{%s,state=\"%s\"} %d\n", labels, state, value)
+		}
+	})
+	metric("awty_desired_tasks", "gauge", "Desired count of the service.", count("awty_desired_tasks", func(service *ecs.Service) *int64 { return service.DesiredCount }))
+	metric("awty_running_tasks", "gauge", "Running count of the service.", count("awty_running_tasks", func(service *ecs.Service) *int64 { return service.RunningCount }))
+	metric("awty_pending_tasks", "gauge", "Pending count of the service.", count("awty_pending_tasks", func(service *ecs.Service) *int64 { return service.PendingCount }))
+	metric("awty_unhealthy_targets", "gauge", "Unhealthy targets at the last target group check.", func(sh *serviceHandler, view handlerView, labels string) {
+		fmt.Fprintf(w, "awty_unhealthy_targets{%s} %d\n", labels, view.unhealthyTargets)
+	})
+	metric("awty_watch_duration_seconds", "gauge", "How long the service has been watched.", func(sh *serviceHandler, view handlerView, labels string) {
+		fmt.Fprintf(w, "awty_watch_duration_seconds{%s} %.0f\n", labels, time.Since(sh.started).Seconds())
+	})
+	metric("awty_checks_total", "counter", "Times the service has been described.", func(sh *serviceHandler, view handlerView, labels string) {
+		fmt.Fprintf(w, "awty_checks_total{%s} %d\n", labels, view.checks)
+	})
+}
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// perServiceFlags are files written by a run. Each service gets its own when there are several,
+// the service name is added before the extension.
+var perServiceFlags = map[string]bool{
+	"report":      true,
+	"json-output": true,
+	"bundle":      true,
+	"state-file":  true,
+}
+
+// serviceLabel is the service name of a -service value, which can be an ARN.
+func serviceLabel(service string) string {
+	if resource, err := parseEcsArn(service); err == nil {
+		return resource.name
+	}
+	return service
+}
+
+// perServicePath adds the service to a file name: report.json becomes report-web.json.
+func perServicePath(path, service string) string {
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, extension), service, extension)
+}
+
+// serviceRun is one of the services waited for at the same time. Without a cluster it is in the
+// -cluster.
+type serviceRun struct {
+	cluster string
+	service string
+}
+
+// serviceRuns are the runs of services in the -cluster.
+func serviceRuns(services []string) []serviceRun {
+	runs := []serviceRun{}
+	for _, service := range services {
+		runs = append(runs, serviceRun{service: service})
+	}
+	return runs
+}
+
+// args are the arguments of the run, the flags given to us with the cluster and service replaced.
+func (run serviceRun) args(deploy bool) []string {
+	args := []string{}
+	if deploy {
+		args = append(args, "deploy")
+	}
+	flag.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case f.Name == "service" || f.Name == "all-services" || (f.Name == "cluster" && run.cluster != ""):
+			return
+		case perServiceFlags[f.Name] && value != "":
+			value = perServicePath(value, serviceLabel(run.service))
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, value))
+	})
+	if run.cluster != "" {
+		args = append(args, "-cluster="+run.cluster)
+	}
+	return append(args, "-service="+run.service)
+}
+
+// prefixOutput copies the output of a service run line by line with the service in front, so the
+// lines of the services don't get mixed up. The json log is copied as it is, its lines already
+// have the service.
+func prefixOutput(output io.Reader, label string, lock *sync.Mutex) {
+	prefix := fmt.Sprintf("[%s] ", label)
+	if jsonLogs() {
+		prefix = ""
+	}
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lock.Lock()
+		fmt.Printf("%s%s\n", prefix, scanner.Text())
+		lock.Unlock()
+	}
+}
+
+// clusterServiceArns lists the ARNs of the services in the cluster. The ARNs carry the region, which
+// the runs of the services would not know when the cluster was given as an ARN.
+func clusterServiceArns(ctx context.Context, client *ecs.ECS, cluster string) ([]string, error) {
+	arns := []string{}
+	err := client.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: aws.String(cluster)}, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+		arns = append(arns, aws.StringValueSlice(page.ServiceArns)...)
+		return true
+	})
+	return arns, err
+}
+
+// runMultipleServices waits for every service at the same time. Each service is a normal run of
+// ourselves with the same flags, so every check works the same as for one service. It exits 1
+// if any of the services fail.
+func runMultipleServices(ctx context.Context, runs []serviceRun, deploy bool) {
+	if *flagListen != "" {
+		logger.errorf("-listen only works with one -service.")
+		os.Exit(1)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		logger.errorf("There was an error finding the executable. Error: %s", err)
+		os.Exit(1)
+	}
+
+	labels := []string{}
+	for _, run := range runs {
+		labels = append(labels, serviceLabel(run.service))
+	}
+	logger.infof("Waiting for %d services: %s.", len(runs), strings.Join(labels, ", "))
+	var outputLock sync.Mutex
+	var group sync.WaitGroup
+	results := make([]error, len(runs))
+	for i, run := range runs {
+		group.Add(1)
+		go func(i int, run serviceRun) {
+			defer group.Done()
+			results[i] = runServiceProcess(ctx, executable, run.args(deploy), labels[i], &outputLock)
+		}(i, run)
+	}
+	group.Wait()
+
+	failed := 0
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "SERVICE\tRESULT")
+	for i := range runs {
+		result := "looks good"
+		if results[i] != nil {
+			result = fmt.Sprintf("failed: %s", results[i])
+			failed++
+		}
+		fmt.Fprintf(table, "%s\t%s\n", labels[i], result)
+	}
+	table.Flush()
+	if failed > 0 {
+		logger.errorf("%d of %d services failed.", failed, len(runs))
+		os.Exit(1)
+	}
+	logger.infof("Services look good.")
+}
+
+// runServiceProcess runs the wait for one service. Interrupting us interrupts it, so it still
+// prints its trouble shooting information.
+func runServiceProcess(ctx context.Context, executable string, args []string, label string, outputLock *sync.Mutex) error {
+	cmd := exec.Command(executable, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Signal(os.Interrupt)
+		case <-done:
+		}
+	}()
+
+	prefixOutput(stdout, label, outputLock)
+	return cmd.Wait()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// networkExpectations describes the awsvpc network configuration that the new deployment should use.
+// Empty values are not checked.
+type networkExpectations struct {
+	subnets        []string
+	securityGroups []string
+	assignPublicIp string
+}
+
+func (ne networkExpectations) empty() bool {
+	return len(ne.subnets) == 0 && len(ne.securityGroups) == 0 && ne.assignPublicIp == ""
+}
+
+// checkNetworkConfiguration compares the network configuration of the PRIMARY deployment
+// with what we expect it to be.
+func (sh *serviceHandler) checkNetworkConfiguration(expected networkExpectations) error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+	if deployment.NetworkConfiguration == nil || deployment.NetworkConfiguration.AwsvpcConfiguration == nil {
+		return fmt.Errorf("deployment %s does not use awsvpc networking", aws.StringValue(deployment.Id))
+	}
+
+	return compareNetworkConfiguration(deployment.NetworkConfiguration.AwsvpcConfiguration, expected)
+}
+
+func compareNetworkConfiguration(actual *ecs.AwsVpcConfiguration, expected networkExpectations) error {
+	problems := []string{}
+
+	if len(expected.subnets) > 0 && !sameStringSet(aws.StringValueSlice(actual.Subnets), expected.subnets) {
+		problems = append(problems, fmt.Sprintf("subnets are %v, expected %v", aws.StringValueSlice(actual.Subnets), expected.subnets))
+	}
+	if len(expected.securityGroups) > 0 && !sameStringSet(aws.StringValueSlice(actual.SecurityGroups), expected.securityGroups) {
+		problems = append(problems, fmt.Sprintf("security groups are %v, expected %v", aws.StringValueSlice(actual.SecurityGroups), expected.securityGroups))
+	}
+	if expected.assignPublicIp != "" {
+		// ECS leaves AssignPublicIp out when it was not set, which means DISABLED.
+		assign := aws.StringValue(actual.AssignPublicIp)
+		if assign == "" {
+			assign = ecs.AssignPublicIpDisabled
+		}
+		if assign != expected.assignPublicIp {
+			problems = append(problems, fmt.Sprintf("assign public IP is %s, expected %s", assign, expected.assignPublicIp))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("unexpected network configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// parseAssignPublicIp turns the value of -expect-assign-public-ip into the ECS representation.
+func parseAssignPublicIp(value string) (string, error) {
+	switch strings.ToUpper(value) {
+	case "":
+		return "", nil
+	case "TRUE", "ENABLED":
+		return ecs.AssignPublicIpEnabled, nil
+	case "FALSE", "DISABLED":
+		return ecs.AssignPublicIpDisabled, nil
+	}
+	return "", fmt.Errorf("invalid value %q, use ENABLED or DISABLED", value)
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+)
+
+// phaseTiming is how long one phase of the wait took.
+type phaseTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// recordPhase marks the start of a phase of the wait. The time spent in the previous phase is
+// kept for the history and the phase is saved to the state file, if there is one.
+func (sh *serviceHandler) recordPhase(phase string) {
+	sh.finishPhase()
+	sh.update(func() {
+		sh.currentPhase = phase
+		sh.phaseStarted = time.Now()
+	})
+	sh.publishProgress("phase")
+
+	if sh.waitState == nil {
+		return
+	}
+	sh.waitState.Phase = phase
+	if err := sh.waitState.save(); err != nil {
+		sh.log.errorf("There was an error saving the state file. Error: %s", err)
+	}
+}
+
+// finishPhase records the time spent in the current phase.
+func (sh *serviceHandler) finishPhase() {
+	if sh.currentPhase == "" {
+		return
+	}
+	sh.update(func() {
+		sh.phaseTimings = append(sh.phaseTimings, phaseTiming{Name: sh.currentPhase, Duration: time.Since(sh.phaseStarted)})
+		sh.currentPhase = ""
+	})
+}
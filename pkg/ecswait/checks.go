@@ -0,0 +1,352 @@
+package ecswait
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Names of the built in checks, for WithCheckTimeout.
+const (
+	CheckDeployment   = "deployment"
+	CheckRunningCount = "running count"
+	CheckTargetHealth = "target health"
+	CheckMinRunning   = "min running"
+)
+
+// Checker is a readiness check that Wait runs on every description of the service. The built in
+// checks are Checkers too, WithCheckers adds more.
+type Checker interface {
+	// Name identifies the check in the log, in errors and to WithCheckTimeout.
+	Name() string
+	// Check looks at the state of the wait. It must not describe the service itself, Wait does
+	// that once per interval. An error fails the wait, return one when the service will never be ready.
+	Check(ctx context.Context, state *State) (Status, error)
+}
+
+// State is what a Checker looks at.
+type State struct {
+	// Service is the description of the service of this interval.
+	Service *ecs.Service
+	// DeploymentId is the deployment that the wait is for.
+	DeploymentId string
+	// Active is true when every check before this one has passed. A check should only act on its
+	// result, like logging more about what is wrong, when it is active.
+	Active bool
+
+	snapshot *snapshot
+}
+
+// snapshot is what the checks of one interval share, so the tasks and targets are described at
+// most once per interval however many checks and hooks look at them.
+type snapshot struct {
+	w            *Waiter
+	service      *ecs.Service
+	deploymentId string
+
+	tasks      []*ecs.Task
+	tasksErr   error
+	tasksDone  bool
+	health     TargetHealth
+	healthErr  error
+	healthDone bool
+}
+
+// Tasks returns the RUNNING tasks of the deployment. They are described once per interval and
+// shared by every check and the Waiting hook.
+func (s *State) Tasks(ctx context.Context) ([]*ecs.Task, error) {
+	snap := s.snapshot
+	if !snap.tasksDone {
+		snap.tasks, snap.tasksErr = snap.w.deploymentTasks(ctx, snap.deploymentId, ecs.DesiredStatusRunning)
+		snap.tasksDone = true
+	}
+	return snap.tasks, snap.tasksErr
+}
+
+// TargetHealth returns the health of the targets, see Waiter.TargetHealth. It is described once
+// per interval, with the tasks of Tasks.
+func (s *State) TargetHealth(ctx context.Context) (TargetHealth, error) {
+	snap := s.snapshot
+	if !snap.healthDone {
+		snap.health, snap.healthErr = snap.w.targetHealth(ctx, snap.service, func() ([]*ecs.Task, error) { return s.Tasks(ctx) })
+		snap.healthDone = true
+	}
+	return snap.health, snap.healthErr
+}
+
+// Status is what a Checker makes of the state.
+type Status struct {
+	// Ready is true when the check has passed.
+	Ready bool
+	// Detail says what the check is waiting for. It is logged while the check has not passed.
+	Detail string
+	// Restart starts the timeout of the check again, for when what it waits for has changed.
+	Restart bool
+}
+
+// entry is a check of a wait and the state the wait keeps for it.
+type entry struct {
+	check   Checker
+	timeout time.Duration
+	// settle checks must pass for the stability window before they count, flappy services can
+	// look good for a moment.
+	settle bool
+
+	activeSince time.Time
+	okSince     time.Time
+	detail      string
+}
+
+// run is one Wait: its checks, the deployment it is for and the check it is waiting for.
+type run struct {
+	w            *Waiter
+	entries      []*entry
+	deploymentId string
+	phase        string
+	// last is the snapshot of the latest interval, for the Waiting hook.
+	last *snapshot
+}
+
+// newRun registers the deployment, running count and target health checks, then the checkers of
+// WithCheckers and the WithMinRunning check.
+func (w *Waiter) newRun() *run {
+	r := &run{w: w}
+	r.add(&deploymentCheck{w: w}, false)
+	r.add(&countCheck{w: w}, true)
+	r.add(&targetsCheck{w: w}, true)
+	for _, c := range w.checkers {
+		r.add(c, false)
+	}
+	if w.minRunning > 0 {
+		r.add(&minRunningCheck{w: w}, false)
+	}
+	return r
+}
+
+func (r *run) add(check Checker, settle bool) {
+	r.entries = append(r.entries, &entry{check: check, settle: settle, timeout: r.w.checkTimeouts[check.Name()]})
+}
+
+// CheckNames returns the names of the checks that Wait runs, in the order it runs them.
+func (w *Waiter) CheckNames() []string {
+	names := []string{}
+	for _, entry := range w.newRun().entries {
+		names = append(names, entry.check.Name())
+	}
+	return names
+}
+
+// tick runs every check against the description of the service and tells if they have all passed.
+func (r *run) tick(ctx context.Context, service *ecs.Service, now time.Time) (bool, error) {
+	w := r.w
+	if r.deploymentId == "" {
+		r.deploymentId = w.deploymentId
+		if r.deploymentId == "" {
+			deployment := PrimaryDeployment(service)
+			if deployment == nil {
+				return false, fmt.Errorf("service %s has no PRIMARY deployment", w.service)
+			}
+			r.deploymentId = aws.StringValue(deployment.Id)
+		}
+		w.log.Logf("Waiting for deployment %s of service %s.", r.deploymentId, w.service)
+		if w.hooks.Deployment != nil {
+			w.hooks.Deployment(r.deploymentId)
+		}
+	}
+	if err := w.checkFailedTasks(service, r.deploymentId); err != nil {
+		return false, err
+	}
+	r.last = &snapshot{w: w, service: service, deploymentId: r.deploymentId}
+
+	ready := true
+	active := true
+	for _, entry := range r.entries {
+		name := entry.check.Name()
+		if active && entry.activeSince.IsZero() {
+			entry.activeSince = now
+		}
+		result, err := entry.check.Check(ctx, &State{Service: service, DeploymentId: r.deploymentId, Active: active, snapshot: r.last})
+		if err != nil {
+			return false, err
+		}
+		if result.Restart && !entry.activeSince.IsZero() {
+			entry.activeSince = now
+		}
+
+		passed := result.Ready
+		if !result.Ready {
+			entry.okSince = time.Time{}
+		} else if entry.settle && w.stabilityWindow > 0 {
+			if entry.okSince.IsZero() {
+				entry.okSince = now
+				w.log.Logf("The %s check passed, waiting %s to see it stays that way.", name, w.stabilityWindow)
+			}
+			passed = now.Sub(entry.okSince) >= w.stabilityWindow
+		}
+		if passed {
+			w.log.Debugf("The %s check passed.", name)
+			continue
+		}
+
+		ready = false
+		if active {
+			if r.phase != name {
+				r.phase = name
+				if w.hooks.Phase != nil {
+					w.hooks.Phase(name)
+				}
+			}
+			if entry.timeout > 0 && now.Sub(entry.activeSince) > entry.timeout {
+				err := fmt.Errorf("%w waiting for the %s check after %s", ErrTimeout, name, entry.timeout)
+				if result.Detail != "" {
+					err = fmt.Errorf("%w, %s", err, result.Detail)
+				}
+				return false, err
+			}
+		}
+		active = false
+		if result.Detail == "" {
+			continue
+		}
+		// Only a change is news, the same line again every interval is progress.
+		if result.Detail != entry.detail {
+			entry.detail = result.Detail
+			w.log.Logf("Waiting for the %s check, %s.", name, result.Detail)
+		} else {
+			w.log.Progressf("Waiting for the %s check, %s.", name, result.Detail)
+		}
+	}
+	return ready, nil
+}
+
+// checkFailedTasks fails when the deployment has more failed task launches than WithMaxFailedTasks
+// allows, ECS can keep trying to start tasks that will never run for a long time.
+func (w *Waiter) checkFailedTasks(service *ecs.Service, deploymentId string) error {
+	if w.maxFailedTasks < 0 {
+		return nil
+	}
+	for _, deployment := range service.Deployments {
+		if aws.StringValue(deployment.Id) == deploymentId && aws.Int64Value(deployment.FailedTasks) > w.maxFailedTasks {
+			return fmt.Errorf("%w: deployment %s has %d failed tasks, the maximum is %d", ErrDeploymentFailed, deploymentId, aws.Int64Value(deployment.FailedTasks), w.maxFailedTasks)
+		}
+	}
+	return nil
+}
+
+// deploymentCheck waits for the deployment to be COMPLETED. Services with the CODE_DEPLOY or
+// EXTERNAL deployment controller, or behind a Classic Load Balancer, have no rollout state. Their
+// deployment counts as completed and the running count and targets tell if it worked.
+type deploymentCheck struct {
+	w         *Waiter
+	completed bool
+}
+
+func (dc *deploymentCheck) Name() string { return CheckDeployment }
+
+func (dc *deploymentCheck) Check(ctx context.Context, state *State) (Status, error) {
+	for _, deployment := range state.Service.Deployments {
+		if aws.StringValue(deployment.Id) != state.DeploymentId {
+			continue
+		}
+		rollout := aws.StringValue(deployment.RolloutState)
+		switch rollout {
+		case ecs.DeploymentRolloutStateCompleted, "":
+			if !dc.completed {
+				dc.completed = true
+				if rollout == "" {
+					dc.w.log.Logf("Deployment %s has no rollout state, the running count and targets tell if it worked.", state.DeploymentId)
+				} else {
+					dc.w.log.Logf("Deployment %s is in state %s.", state.DeploymentId, dc.w.formatState(rollout))
+				}
+			}
+			return Status{Ready: true}, nil
+		case ecs.DeploymentRolloutStateFailed:
+			// There is no point waiting any longer for a deployment that ECS has given up on.
+			return Status{}, fmt.Errorf("%w: deployment %s FAILED. Reason: %s", ErrDeploymentFailed, state.DeploymentId, aws.StringValue(deployment.RolloutStateReason))
+		}
+		return Status{Detail: fmt.Sprintf("deployment %s is %s", state.DeploymentId, dc.w.formatState(rollout))}, nil
+	}
+	return Status{}, fmt.Errorf("%w: deployment %s disappeared, another deployment replaced it", ErrDeploymentFailed, state.DeploymentId)
+}
+
+// countCheck waits for the running count to match the desired count. When something, normally
+// autoscaling, changes the desired count the timeout starts again as the new tasks need time to start.
+type countCheck struct {
+	w               *Waiter
+	started         bool
+	expectedDesired int64
+}
+
+func (cc *countCheck) Name() string { return CheckRunningCount }
+
+func (cc *countCheck) Check(ctx context.Context, state *State) (Status, error) {
+	desired := aws.Int64Value(state.Service.DesiredCount)
+	running := aws.Int64Value(state.Service.RunningCount)
+	status := Status{
+		Ready:  desired == running,
+		Detail: fmt.Sprintf("desired: %d and running: %d", desired, running),
+	}
+
+	if !cc.started {
+		cc.started = true
+		cc.expectedDesired = desired
+	}
+	if desired != cc.expectedDesired {
+		cc.w.log.Logf("Desired count changed from %d to %d while waiting, now waiting for %d running tasks.", cc.expectedDesired, desired, desired)
+		if cc.w.hooks.DesiredCountChanged != nil {
+			cc.w.hooks.DesiredCountChanged(cc.expectedDesired, desired)
+		}
+		cc.expectedDesired = desired
+		status.Restart = true
+	}
+	return status, nil
+}
+
+// targetsCheck waits for the targets of the service to be healthy.
+type targetsCheck struct {
+	w *Waiter
+}
+
+func (tc *targetsCheck) Name() string { return CheckTargetHealth }
+
+func (tc *targetsCheck) Check(ctx context.Context, state *State) (Status, error) {
+	health, err := state.TargetHealth(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	if tc.w.hooks.TargetHealth != nil {
+		tc.w.hooks.TargetHealth(health, state.Active)
+	}
+	return Status{
+		Ready:  health.Healthy(),
+		Detail: fmt.Sprintf("%d targets are unhealthy and %d are in their health check grace period", len(health.Unhealthy), len(health.InGracePeriod)),
+	}, nil
+}
+
+// minRunningCheck waits for the WithMinRunning healthy tasks. Tasks without container health
+// checks are UNKNOWN and count as healthy, their targets are checked instead.
+type minRunningCheck struct {
+	w *Waiter
+}
+
+func (mc *minRunningCheck) Name() string { return CheckMinRunning }
+
+func (mc *minRunningCheck) Check(ctx context.Context, state *State) (Status, error) {
+	tasks, err := state.Tasks(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	healthy := int64(0)
+	for _, task := range tasks {
+		if aws.StringValue(task.LastStatus) == ecs.DesiredStatusRunning && aws.StringValue(task.HealthStatus) != ecs.HealthStatusUnhealthy {
+			healthy++
+		}
+	}
+	return Status{
+		Ready:  healthy >= mc.w.minRunning,
+		Detail: fmt.Sprintf("deployment %s has %d healthy tasks, waiting for at least %d", state.DeploymentId, healthy, mc.w.minRunning),
+	}, nil
+}
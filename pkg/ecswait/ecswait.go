@@ -0,0 +1,187 @@
+// Package ecswait waits for the deployment of an ECS service to finish and for the service to be
+// healthy. It is the wait of are-we-there-yet for Go deployment tooling that wants to embed it
+// instead of running the binary:
+//
+//	waiter := ecswait.New(awsSession, "production", "web", ecswait.WithTimeout(15*time.Minute))
+//	result, err := waiter.Wait(ctx)
+//
+// A wait passes when the PRIMARY deployment is COMPLETED, the running count matches the desired
+// count and every target of the first target group of the service is healthy. The running count
+// and target health must stay good for the stability window before they are trusted. More checks
+// are added with WithCheckers, and Hooks follow the wait as it goes.
+package ecswait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+var (
+	// ErrServiceNotFound is returned when the cluster has no service with the name.
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrDeploymentFailed is returned when ECS gives up on the deployment or it has more failed
+	// tasks than WithMaxFailedTasks allows.
+	ErrDeploymentFailed = errors.New("deployment failed")
+	// ErrTimeout is returned when the service is not ready within WithTimeout.
+	ErrTimeout = errors.New("timed out")
+)
+
+// Waiter waits for one service. It is safe to call its methods from several goroutines.
+type Waiter struct {
+	ecs   ecsiface.ECSAPI
+	elbv2 elbv2iface.ELBV2API
+
+	cluster         string
+	service         string
+	interval        time.Duration
+	timeout         time.Duration
+	stabilityWindow time.Duration
+	maxFailedTasks  int64
+	minRunning      int64
+	ignoredTargets  map[string]bool
+	checkTimeouts   map[string]time.Duration
+	deploymentId    string
+	checkers        []Checker
+	wake            <-chan struct{}
+	hooks           Hooks
+	stateFormat     func(state string) string
+	log             Logger
+}
+
+// New returns a Waiter for the service in the cluster. An empty cluster is the default cluster.
+func New(provider client.ConfigProvider, cluster, service string, options ...Option) *Waiter {
+	w := &Waiter{
+		cluster:         cluster,
+		service:         service,
+		interval:        10 * time.Second,
+		timeout:         10 * time.Minute,
+		stabilityWindow: 15 * time.Second,
+		maxFailedTasks:  -1,
+		ignoredTargets:  map[string]bool{},
+		checkTimeouts:   map[string]time.Duration{},
+		log:             funcLogger(func(string, ...interface{}) {}),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	if w.ecs == nil {
+		w.ecs = ecs.New(provider)
+	}
+	if w.elbv2 == nil {
+		w.elbv2 = elbv2.New(provider)
+	}
+	return w
+}
+
+// Result is how the wait went.
+type Result struct {
+	// DeploymentId is the deployment that was waited for.
+	DeploymentId string
+	// Service is the last description of the service.
+	Service *ecs.Service
+	// Duration is how long the wait took.
+	Duration time.Duration
+}
+
+// Describe returns the current description of the service.
+func (w *Waiter) Describe(ctx context.Context) (*ecs.Service, error) {
+	input := &ecs.DescribeServicesInput{Services: []*string{aws.String(w.service)}}
+	if w.cluster != "" {
+		input.Cluster = aws.String(w.cluster)
+	}
+	output, err := w.ecs.DescribeServicesWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Services) == 0 || aws.StringValue(output.Services[0].Status) == "INACTIVE" {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, w.service)
+	}
+	return output.Services[0], nil
+}
+
+// Wait waits for the deployment that is PRIMARY when it starts. It describes the service every
+// interval and runs every check against that description, until they all pass on the same
+// interval, a check fails, a timeout runs out or the context is cancelled.
+func (w *Waiter) Wait(ctx context.Context) (*Result, error) {
+	started := time.Now()
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	result := &Result{}
+	r := w.newRun()
+	for tick := 0; ; tick++ {
+		if tick > 0 {
+			if err := w.sleep(ctx); err != nil {
+				return result, w.contextError(ctx, err)
+			}
+		}
+		service, err := w.Describe(ctx)
+		if err != nil {
+			return result, w.contextError(ctx, err)
+		}
+		result.Service = service
+		result.Duration = time.Since(started)
+		if w.hooks.Described != nil {
+			if err := w.hooks.Described(service); err != nil {
+				return result, err
+			}
+		}
+
+		ready, err := r.tick(ctx, service, time.Now())
+		result.DeploymentId = r.deploymentId
+		if err != nil {
+			return result, w.contextError(ctx, err)
+		}
+		if ready {
+			w.log.Logf("Every check passed.")
+			return result, nil
+		}
+		if w.hooks.Waiting != nil {
+			w.hooks.Waiting(&State{Service: service, DeploymentId: r.deploymentId, snapshot: r.last})
+		}
+		w.log.Progressf("Waiting another %s before checking again.", w.interval)
+	}
+}
+
+// formatState formats a rollout state for the log, see WithStateFormat.
+func (w *Waiter) formatState(state string) string {
+	if w.stateFormat == nil {
+		return state
+	}
+	return w.stateFormat(state)
+}
+
+// contextError turns the error of a cancelled wait into ErrTimeout when our own timeout ran out.
+func (w *Waiter) contextError(ctx context.Context, err error) error {
+	if w.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w waiting for service %s after %s", ErrTimeout, w.service, w.timeout)
+	}
+	return err
+}
+
+// sleep waits for the interval, or until something is sent on the WithWakeUp channel.
+func (w *Waiter) sleep(ctx context.Context) error {
+	timer := time.NewTimer(w.interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-w.wake:
+		w.log.Debugf("Woken up before the end of the interval, checking now.")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
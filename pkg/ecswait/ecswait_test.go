@@ -0,0 +1,245 @@
+package ecswait
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// fakeECS returns the next service description on every call, repeating the last one, and the
+// tasks. It counts how often the tasks are listed.
+type fakeECS struct {
+	ecsiface.ECSAPI
+	services  []*ecs.Service
+	tasks     []*ecs.Task
+	taskLists int
+}
+
+func (f *fakeECS) ListTasksPagesWithContext(ctx aws.Context, input *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool, opts ...request.Option) error {
+	f.taskLists++
+	output := &ecs.ListTasksOutput{}
+	for _, task := range f.tasks {
+		output.TaskArns = append(output.TaskArns, task.TaskArn)
+	}
+	fn(output, true)
+	return nil
+}
+
+func (f *fakeECS) DescribeTasksWithContext(ctx aws.Context, input *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{Tasks: f.tasks}, nil
+}
+
+func (f *fakeECS) DescribeServicesWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	service := f.services[0]
+	if len(f.services) > 1 {
+		f.services = f.services[1:]
+	}
+	return &ecs.DescribeServicesOutput{Services: []*ecs.Service{service}}, nil
+}
+
+type fakeELBV2 struct {
+	elbv2iface.ELBV2API
+	states []string
+}
+
+func (f *fakeELBV2) DescribeTargetHealthWithContext(ctx aws.Context, input *elbv2.DescribeTargetHealthInput, opts ...request.Option) (*elbv2.DescribeTargetHealthOutput, error) {
+	output := &elbv2.DescribeTargetHealthOutput{}
+	for i, state := range f.states {
+		output.TargetHealthDescriptions = append(output.TargetHealthDescriptions, &elbv2.TargetHealthDescription{
+			Target:       &elbv2.TargetDescription{Id: aws.String(string(rune('a' + i)))},
+			TargetHealth: &elbv2.TargetHealth{State: aws.String(state)},
+		})
+	}
+	return output, nil
+}
+
+// readyAfter is a Checker that is ready from its nth check on, or fails with err.
+type readyAfter struct {
+	n      int
+	checks int
+	err    error
+}
+
+func (r *readyAfter) Name() string { return "ready after" }
+
+func (r *readyAfter) Check(ctx context.Context, state *State) (Status, error) {
+	r.checks++
+	return Status{Ready: r.checks >= r.n, Detail: "not ready yet"}, r.err
+}
+
+func service(rolloutState string, desired, running, failed int64) *ecs.Service {
+	return &ecs.Service{
+		ServiceName:   aws.String("web"),
+		DesiredCount:  aws.Int64(desired),
+		RunningCount:  aws.Int64(running),
+		LoadBalancers: []*ecs.LoadBalancer{{TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/web/1")}},
+		Deployments: []*ecs.Deployment{{
+			Id:           aws.String("ecs-svc/1"),
+			Status:       aws.String("PRIMARY"),
+			RolloutState: aws.String(rolloutState),
+			FailedTasks:  aws.Int64(failed),
+		}},
+	}
+}
+
+func newTestWaiter(services []*ecs.Service, states []string, options ...Option) *Waiter {
+	options = append([]Option{
+		WithClients(&fakeECS{services: services}, &fakeELBV2{states: states}),
+		WithInterval(time.Millisecond),
+		WithStabilityWindow(0),
+	}, options...)
+	return New(nil, "production", "web", options...)
+}
+
+func TestWait(t *testing.T) {
+	tests := map[string]struct {
+		services []*ecs.Service
+		states   []string
+		options  []Option
+		err      error
+	}{
+		"completes": {
+			services: []*ecs.Service{
+				service(ecs.DeploymentRolloutStateInProgress, 2, 1, 0),
+				service(ecs.DeploymentRolloutStateCompleted, 2, 1, 0),
+				service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0),
+			},
+			states: []string{"healthy", "healthy"},
+		},
+		"deployment failed": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateFailed, 2, 0, 2)},
+			err:      ErrDeploymentFailed,
+		},
+		"too many failed tasks": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateInProgress, 2, 0, 3)},
+			options:  []Option{WithMaxFailedTasks(2)},
+			err:      ErrDeploymentFailed,
+		},
+		"unhealthy targets time out": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0)},
+			states:   []string{"healthy", "unhealthy"},
+			options:  []Option{WithTimeout(50 * time.Millisecond)},
+			err:      ErrTimeout,
+		},
+		"ignored targets": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0)},
+			states:   []string{"healthy", "draining"},
+			options:  []Option{WithIgnoredTargets("b")},
+		},
+		"no rollout state": {
+			services: []*ecs.Service{service("", 2, 2, 0)},
+			states:   []string{"healthy", "healthy"},
+		},
+		"check timeout": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateInProgress, 2, 1, 0)},
+			options:  []Option{WithTimeout(0), WithCheckTimeout(CheckDeployment, 20*time.Millisecond)},
+			err:      ErrTimeout,
+		},
+		"checker": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0)},
+			options:  []Option{WithCheckers(&readyAfter{n: 3})},
+		},
+		"checker fails": {
+			services: []*ecs.Service{service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0)},
+			options:  []Option{WithCheckers(&readyAfter{err: ErrDeploymentFailed})},
+			err:      ErrDeploymentFailed,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := newTestWaiter(test.services, test.states, test.options...).Wait(context.Background())
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if result.DeploymentId != "ecs-svc/1" {
+				t.Errorf("expected deployment ecs-svc/1, got %q", result.DeploymentId)
+			}
+		})
+	}
+}
+
+func TestWaitHooks(t *testing.T) {
+	phases := []string{}
+	deploymentId := ""
+	waiter := newTestWaiter(
+		[]*ecs.Service{
+			service(ecs.DeploymentRolloutStateInProgress, 2, 1, 0),
+			service(ecs.DeploymentRolloutStateCompleted, 2, 1, 0),
+			service(ecs.DeploymentRolloutStateCompleted, 2, 2, 0),
+		},
+		[]string{"healthy", "healthy"},
+		WithHooks(Hooks{
+			Deployment: func(id string) { deploymentId = id },
+			Phase:      func(name string) { phases = append(phases, name) },
+		}),
+	)
+	if _, err := waiter.Wait(context.Background()); err != nil {
+		t.Fatalf("wait: %s", err)
+	}
+	if deploymentId != "ecs-svc/1" {
+		t.Errorf("expected the hook to get deployment ecs-svc/1, got %q", deploymentId)
+	}
+	if len(phases) != 2 || phases[0] != CheckDeployment || phases[1] != CheckRunningCount {
+		t.Errorf("expected the deployment and running count phases, got %v", phases)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	waiter := newTestWaiter([]*ecs.Service{service(ecs.DeploymentRolloutStateInProgress, 2, 0, 0)}, nil)
+	if _, err := waiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWaitDescribesTasksOncePerInterval(t *testing.T) {
+	inGrace := service(ecs.DeploymentRolloutStateCompleted, 1, 1, 0)
+	inGrace.HealthCheckGracePeriodSeconds = aws.Int64(60)
+	fake := &fakeECS{
+		services: []*ecs.Service{inGrace},
+		tasks: []*ecs.Task{{
+			TaskArn:      aws.String("arn:aws:ecs:eu-west-1:123456789012:task/production/1"),
+			StartedBy:    aws.String("ecs-svc/1"),
+			LastStatus:   aws.String(ecs.DesiredStatusRunning),
+			HealthStatus: aws.String(ecs.HealthStatusUnknown),
+			StartedAt:    aws.Time(time.Now()),
+			Containers: []*ecs.Container{{
+				NetworkInterfaces: []*ecs.NetworkInterface{{PrivateIpv4Address: aws.String("a")}},
+			}},
+		}},
+	}
+	intervals := 0
+	waiter := New(nil, "production", "web",
+		WithClients(fake, &fakeELBV2{states: []string{"initial"}}),
+		WithInterval(time.Millisecond),
+		WithTimeout(20*time.Millisecond),
+		WithMinRunning(1),
+		WithHooks(Hooks{
+			Described: func(service *ecs.Service) error {
+				intervals++
+				return nil
+			},
+			Waiting: func(state *State) {
+				if _, err := state.Tasks(context.Background()); err != nil {
+					t.Errorf("tasks: %s", err)
+				}
+			},
+		}),
+	)
+	if _, err := waiter.Wait(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	// The target in its grace period, the min running check and the hook all need the tasks.
+	if fake.taskLists != intervals {
+		t.Errorf("expected the tasks to be listed once in each of the %d intervals, they were listed %d times", intervals, fake.taskLists)
+	}
+}
@@ -0,0 +1,146 @@
+package ecswait
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// Option changes how a Waiter waits.
+type Option func(*Waiter)
+
+// WithInterval sets the time between checks, 10 seconds by default. Consider the ECS API rate
+// limits when waiting for many services.
+func WithInterval(interval time.Duration) Option {
+	return func(w *Waiter) { w.interval = interval }
+}
+
+// WithTimeout sets how long Wait waits before returning ErrTimeout, 10 minutes by default. 0 waits
+// without an overall timeout, like when every check has its own with WithCheckTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *Waiter) { w.timeout = timeout }
+}
+
+// WithStabilityWindow sets how long the running count and target health must stay good before
+// they are trusted, 15 seconds by default.
+func WithStabilityWindow(window time.Duration) Option {
+	return func(w *Waiter) { w.stabilityWindow = window }
+}
+
+// WithMaxFailedTasks fails the wait once the deployment has more failed task launches than max.
+// The limit is off by default.
+func WithMaxFailedTasks(max int64) Option {
+	return func(w *Waiter) { w.maxFailedTasks = max }
+}
+
+// WithIgnoredTargets leaves targets out of the target health check by their IP address or
+// instance ID, for shared target groups with targets that are managed elsewhere.
+func WithIgnoredTargets(ids ...string) Option {
+	return func(w *Waiter) {
+		for _, id := range ids {
+			w.ignoredTargets[id] = true
+		}
+	}
+}
+
+// WithLogger receives a line about the progress of the wait, like while waiting for the running
+// count. Nothing is logged by default.
+func WithLogger(logf func(format string, args ...interface{})) Option {
+	return func(w *Waiter) { w.log = funcLogger(logf) }
+}
+
+// WithLeveledLogger is WithLogger for loggers that tell changes, progress and details apart.
+func WithLeveledLogger(logger Logger) Option {
+	return func(w *Waiter) { w.log = logger }
+}
+
+// WithCheckTimeout fails the wait with ErrTimeout once the wait has waited for the check for
+// longer than timeout. The timeout starts when every check before it has passed. Checks have no
+// timeout of their own by default.
+func WithCheckTimeout(name string, timeout time.Duration) Option {
+	return func(w *Waiter) { w.checkTimeouts[name] = timeout }
+}
+
+// WithDeployment waits for the deployment instead of the one that is PRIMARY when Wait starts,
+// like to carry on with a wait that was interrupted.
+func WithDeployment(id string) Option {
+	return func(w *Waiter) { w.deploymentId = id }
+}
+
+// WithMinRunning also waits for the deployment to have at least count RUNNING tasks that are not
+// UNHEALTHY. 0 turns the check off, which is the default.
+func WithMinRunning(count int64) Option {
+	return func(w *Waiter) { w.minRunning = count }
+}
+
+// WithCheckers adds checks that run after the deployment, running count and target health checks.
+func WithCheckers(checkers ...Checker) Option {
+	return func(w *Waiter) { w.checkers = append(w.checkers, checkers...) }
+}
+
+// WithWakeUp checks the service straight away instead of at the end of the interval when
+// something is sent on the channel, like when an ECS event for the service arrives.
+func WithWakeUp(wake <-chan struct{}) Option {
+	return func(w *Waiter) { w.wake = wake }
+}
+
+// WithHooks calls the hooks as the wait goes.
+func WithHooks(hooks Hooks) Option {
+	return func(w *Waiter) { w.hooks = hooks }
+}
+
+// WithStateFormat formats the rollout states in the log, like to color them on a terminal.
+func WithStateFormat(format func(state string) string) Option {
+	return func(w *Waiter) { w.stateFormat = format }
+}
+
+// Logger is where a Waiter says what it is doing.
+type Logger interface {
+	// Logf logs that something changed, like a check that passed.
+	Logf(format string, args ...interface{})
+	// Progressf logs a line that repeats every interval while the wait is in the same state.
+	Progressf(format string, args ...interface{})
+	// Debugf logs the details, like which targets are ignored.
+	Debugf(format string, args ...interface{})
+}
+
+// funcLogger logs every line but the details with a printf style function, see WithLogger.
+type funcLogger func(format string, args ...interface{})
+
+func (f funcLogger) Logf(format string, args ...interface{}) { f(format, args...) }
+
+func (f funcLogger) Progressf(format string, args ...interface{}) { f(format, args...) }
+
+func (f funcLogger) Debugf(format string, args ...interface{}) {}
+
+// Hooks follow a wait as it goes, every one of them is optional. They are called from the
+// goroutine that runs Wait.
+type Hooks struct {
+	// Described is called with every description of the service before the checks run on it. An
+	// error fails the wait.
+	Described func(service *ecs.Service) error
+	// Deployment is called with the deployment the wait is for once it is known.
+	Deployment func(id string)
+	// Phase is called with the name of the check when the wait starts waiting for it.
+	Phase func(name string)
+	// DesiredCountChanged is called when the desired count changes during the wait, normally
+	// because autoscaling changed it.
+	DesiredCountChanged func(from, to int64)
+	// TargetHealth is called every time the target health check runs. active tells if the wait
+	// is waiting for it, see State.
+	TargetHealth func(health TargetHealth, active bool)
+	// Waiting is called after every interval that did not finish the wait, before it sleeps. The
+	// state shares the tasks and targets that the checks of the interval described.
+	Waiting func(state *State)
+}
+
+// WithClients uses the clients instead of ones made from the config provider, for tests and
+// clients with their own retry settings. A nil client is made from the config provider.
+func WithClients(ecsClient ecsiface.ECSAPI, elbv2Client elbv2iface.ELBV2API) Option {
+	return func(w *Waiter) {
+		w.ecs = ecsClient
+		w.elbv2 = elbv2Client
+	}
+}
@@ -0,0 +1,29 @@
+package ecswait
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// PrimaryDeployment returns the PRIMARY deployment of the service description, nil when it has none.
+func PrimaryDeployment(service *ecs.Service) *ecs.Deployment {
+	if service == nil {
+		return nil
+	}
+	for _, deployment := range service.Deployments {
+		if aws.StringValue(deployment.Status) == "PRIMARY" {
+			return deployment
+		}
+	}
+	return nil
+}
+
+// Stable tells if the service has no deployment going on: one deployment that has completed and
+// the running count matching the desired count. It does not look at the targets.
+func Stable(service *ecs.Service) bool {
+	if len(service.Deployments) != 1 || aws.Int64Value(service.RunningCount) != aws.Int64Value(service.DesiredCount) {
+		return false
+	}
+	state := aws.StringValue(service.Deployments[0].RolloutState)
+	return state == "" || state == ecs.DeploymentRolloutStateCompleted
+}
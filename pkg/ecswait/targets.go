@@ -0,0 +1,170 @@
+package ecswait
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// describeTasksBatchSize is the most tasks DescribeTasks accepts in one call.
+const describeTasksBatchSize = 100
+
+// TargetHealth is the health of the targets of the first target group of a service. The ignored
+// targets are left out.
+type TargetHealth struct {
+	// Unhealthy are the targets that are not healthy.
+	Unhealthy []*elbv2.TargetHealthDescription
+	// InGracePeriod are the targets that are not healthy yet but belong to tasks in the health check
+	// grace period of the service, they are expected to be unhealthy for a while.
+	InGracePeriod []*elbv2.TargetHealthDescription
+}
+
+// Healthy tells if every target is healthy.
+func (h TargetHealth) Healthy() bool {
+	return len(h.Unhealthy) == 0 && len(h.InGracePeriod) == 0
+}
+
+// TargetHealth returns the health of the targets of the first target group of the service.
+// Services without a load balancer have no targets.
+func (w *Waiter) TargetHealth(ctx context.Context, service *ecs.Service) (TargetHealth, error) {
+	return w.targetHealth(ctx, service, func() ([]*ecs.Task, error) {
+		deployment := PrimaryDeployment(service)
+		if deployment == nil {
+			return nil, nil
+		}
+		return w.deploymentTasks(ctx, aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+	})
+}
+
+// targetHealth is TargetHealth with the RUNNING tasks of the deployment from tasks. They are only
+// asked for when a target is not healthy and the service has a health check grace period.
+func (w *Waiter) targetHealth(ctx context.Context, service *ecs.Service, tasks func() ([]*ecs.Task, error)) (TargetHealth, error) {
+	health := TargetHealth{
+		Unhealthy:     []*elbv2.TargetHealthDescription{},
+		InGracePeriod: []*elbv2.TargetHealthDescription{},
+	}
+	if len(service.LoadBalancers) == 0 || service.LoadBalancers[0].TargetGroupArn == nil {
+		w.log.Debugf("No load balancer to check.")
+		return health, nil
+	}
+	output, err := w.elbv2.DescribeTargetHealthWithContext(ctx, &elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: service.LoadBalancers[0].TargetGroupArn,
+	})
+	if err != nil {
+		return health, err
+	}
+
+	var graceIps map[string]bool
+	var gracePorts map[int64]bool
+	for _, target := range output.TargetHealthDescriptions {
+		id := aws.StringValue(target.Target.Id)
+		state := aws.StringValue(target.TargetHealth.State)
+		if w.ignoredTargets[id] {
+			w.log.Debugf("Ignoring target %s which is %s.", id, state)
+			continue
+		}
+		if state == elbv2.TargetHealthStateEnumHealthy {
+			continue
+		}
+		if graceIps == nil {
+			graceIps, gracePorts = map[string]bool{}, map[int64]bool{}
+			if HealthCheckGracePeriod(service) > 0 {
+				running, err := tasks()
+				if err != nil {
+					return health, err
+				}
+				graceIps, gracePorts = graceTargets(service, running)
+			}
+		}
+		// Targets of tasks in the health check grace period are expected to be unhealthy, only wait for them.
+		if graceIps[id] || (strings.HasPrefix(id, "i-") && gracePorts[aws.Int64Value(target.Target.Port)]) {
+			health.InGracePeriod = append(health.InGracePeriod, target)
+			continue
+		}
+		health.Unhealthy = append(health.Unhealthy, target)
+	}
+	return health, nil
+}
+
+// HealthCheckGracePeriod is how long ECS ignores failing health checks of a task of the service
+// after it starts.
+func HealthCheckGracePeriod(service *ecs.Service) time.Duration {
+	return time.Second * time.Duration(aws.Int64Value(service.HealthCheckGracePeriodSeconds))
+}
+
+// InGracePeriod tells if the task of the service started less than the health check grace period
+// ago. Tasks that have not started yet are in their grace period too.
+func InGracePeriod(service *ecs.Service, task *ecs.Task) bool {
+	grace := HealthCheckGracePeriod(service)
+	if grace == 0 {
+		return false
+	}
+	return task.StartedAt == nil || time.Since(aws.TimeValue(task.StartedAt)) < grace
+}
+
+// graceTargets returns the target IDs and ports of the tasks that are in their health check grace
+// period. awsvpc tasks are registered by IP, the others by the instance with a host port, so both
+// the IP and the host ports are returned.
+func graceTargets(service *ecs.Service, tasks []*ecs.Task) (map[string]bool, map[int64]bool) {
+	ips := map[string]bool{}
+	ports := map[int64]bool{}
+	for _, task := range tasks {
+		if !InGracePeriod(service, task) {
+			continue
+		}
+		for _, container := range task.Containers {
+			for _, networkInterface := range container.NetworkInterfaces {
+				ips[aws.StringValue(networkInterface.PrivateIpv4Address)] = true
+			}
+			for _, binding := range container.NetworkBindings {
+				ports[aws.Int64Value(binding.HostPort)] = true
+			}
+		}
+	}
+	return ips, ports
+}
+
+// deploymentTasks returns the tasks of the service with the desired status that were started by
+// the deployment. ECS sets startedBy to the deployment ID for tasks that it starts for a service.
+func (w *Waiter) deploymentTasks(ctx context.Context, deploymentId, desiredStatus string) ([]*ecs.Task, error) {
+	input := &ecs.ListTasksInput{
+		ServiceName:   aws.String(w.service),
+		DesiredStatus: aws.String(desiredStatus),
+	}
+	if w.cluster != "" {
+		input.Cluster = aws.String(w.cluster)
+	}
+	arns := []*string{}
+	err := w.ecs.ListTasksPagesWithContext(ctx, input, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		arns = append(arns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := []*ecs.Task{}
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := start + describeTasksBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := w.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: input.Cluster,
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range output.Tasks {
+			if aws.StringValue(task.StartedBy) == deploymentId {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// placementReason maps a fragment of an ECS placement failure event to an explanation.
+type placementReason struct {
+	pattern     *regexp.Regexp
+	explanation string
+}
+
+var placementReasons = []placementReason{
+	{regexp.MustCompile(`(?i)insufficient memory`), "not enough free memory on any container instance"},
+	{regexp.MustCompile(`(?i)insufficient CPU`), "not enough free CPU units on any container instance"},
+	{regexp.MustCompile(`(?i)insufficient GPU`), "not enough free GPUs on any container instance"},
+	{regexp.MustCompile(`(?i)is already using a port required by your task`), "the static host port is already in use, use dynamic host ports or add more instances"},
+	{regexp.MustCompile(`(?i)memberOf constraint`), "no container instance satisfies the memberOf placement constraint"},
+	{regexp.MustCompile(`(?i)distinctInstance`), "the distinctInstance placement constraint needs more container instances"},
+	{regexp.MustCompile(`(?i)no container instances? (were|was) found`), "the cluster or capacity provider has no registered container instances"},
+	{regexp.MustCompile(`(?i)missing an attribute required by your task`), "no container instance has the attributes that the task requires"},
+	{regexp.MustCompile(`(?i)insufficient (ENI|network interfaces)`), "no container instance has a free ENI for an awsvpc task"},
+	{regexp.MustCompile(`(?i)reached the limit on the number of tasks`), "the container instance task limit has been reached"},
+}
+
+var placementFailurePattern = regexp.MustCompile(`(?i)was unable to place a task`)
+
+// placementDiagnosis returns an explanation for each kind of placement failure found in the
+// events after the given time. The count of events per explanation is included.
+func placementDiagnosis(events []*ecs.ServiceEvent, since time.Time) []string {
+	counts := map[string]int{}
+	order := []string{}
+	for _, event := range events {
+		if aws.TimeValue(event.CreatedAt).Before(since) {
+			continue
+		}
+		message := aws.StringValue(event.Message)
+		if !placementFailurePattern.MatchString(message) {
+			continue
+		}
+
+		explanation := "unknown placement failure: " + message
+		for _, reason := range placementReasons {
+			if reason.pattern.MatchString(message) {
+				explanation = reason.explanation
+				break
+			}
+		}
+		if counts[explanation] == 0 {
+			order = append(order, explanation)
+		}
+		counts[explanation]++
+	}
+
+	diagnosis := []string{}
+	for _, explanation := range order {
+		diagnosis = append(diagnosis, fmt.Sprintf("%s (seen %d times)", explanation, counts[explanation]))
+	}
+	return diagnosis
+}
+
+// printPlacementDiagnosis prints why tasks of the PRIMARY deployment could not be placed, if they couldn't.
+func (sh *serviceHandler) printPlacementDiagnosis() {
+	since := time.Time{}
+	if deployment := sh.primaryDeployment(); deployment != nil {
+		since = aws.TimeValue(deployment.CreatedAt)
+	}
+
+	diagnosis := placementDiagnosis(sh.currentOutput.Events, since)
+	if len(diagnosis) == 0 {
+		return
+	}
+	fmt.Println("Tasks could not be placed because:")
+	for _, line := range diagnosis {
+		fmt.Printf("  %s\n", line)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// Exit codes of the -check-plugin protocol.
+const (
+	pluginHealthy   = 0
+	pluginUnhealthy = 1
+	pluginFatal     = 2
+)
+
+// pluginInput is written as JSON to the stdin of a check plugin.
+type pluginInput struct {
+	Cluster      string       `json:"cluster"`
+	Service      string       `json:"service"`
+	DeploymentId string       `json:"deployment_id"`
+	Description  *ecs.Service `json:"description"`
+}
+
+// execPlugin is an ecswait.Checker that runs an executable. An exit code of 1 means not healthy
+// yet and 2 means it never will be.
+type execPlugin struct {
+	path    string
+	cluster string
+	service string
+}
+
+// setCheckPlugins adds the executables that are run as part of every verification cycle.
+func (sh *serviceHandler) setCheckPlugins(paths []string) {
+	for _, path := range paths {
+		sh.checkers = append(sh.checkers, execPlugin{path: path, cluster: aws.StringValue(sh.clusterName), service: aws.StringValue(sh.serviceName)})
+	}
+}
+
+func (p execPlugin) Name() string {
+	return p.path
+}
+
+// Check runs the plugin with the service state on stdin. The last line it prints says what it is
+// waiting for.
+func (p execPlugin) Check(ctx context.Context, state *ecswait.State) (ecswait.Status, error) {
+	input, err := json.Marshal(pluginInput{
+		Cluster:      p.cluster,
+		Service:      p.service,
+		DeploymentId: state.DeploymentId,
+		Description:  state.Service,
+	})
+	if err != nil {
+		return ecswait.Status{}, err
+	}
+
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = io.MultiWriter(os.Stdout, output)
+	cmd.Stderr = os.Stderr
+
+	code := pluginHealthy
+	if err := cmd.Run(); err != nil {
+		exitErr := &exec.ExitError{}
+		if !errors.As(err, &exitErr) {
+			return ecswait.Status{}, fmt.Errorf("failed to run the plugin %s. Error: %s", p.path, err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	switch code {
+	case pluginHealthy:
+		return ecswait.Status{Ready: true}, nil
+	case pluginUnhealthy:
+		detail := lastLine(output.String())
+		if detail == "" {
+			detail = "the plugin says the service is not healthy yet"
+		}
+		return ecswait.Status{Detail: detail}, nil
+	case pluginFatal:
+		return ecswait.Status{}, fmt.Errorf("the plugin %s says the service will not become healthy", p.path)
+	}
+	return ecswait.Status{}, fmt.Errorf("the plugin %s exited with %d, expected 0, 1 or 2", p.path, code)
+}
+
+// lastLine returns the last line of the output that is not empty.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// progressBuffer is how many progress events a slow stream can fall behind before events are dropped for it.
+const progressBuffer = 16
+
+// progressEvent is sent to the progress streams of a watch.
+type progressEvent struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	Phase        string    `json:"phase,omitempty"`
+	DeploymentId string    `json:"deployment_id,omitempty"`
+	RolloutState string    `json:"rollout_state,omitempty"`
+	Desired      int64     `json:"desired"`
+	Running      int64     `json:"running"`
+	Pending      int64     `json:"pending"`
+	Result       string    `json:"result,omitempty"`
+}
+
+// progressStreams are the subscribers of the progress events of a service.
+type progressStreams struct {
+	lock        sync.Mutex
+	subscribers map[chan progressEvent]bool
+}
+
+func (ps *progressStreams) subscribe() chan progressEvent {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if ps.subscribers == nil {
+		ps.subscribers = map[chan progressEvent]bool{}
+	}
+	events := make(chan progressEvent, progressBuffer)
+	ps.subscribers[events] = true
+	return events
+}
+
+func (ps *progressStreams) unsubscribe(events chan progressEvent) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	delete(ps.subscribers, events)
+}
+
+// publish sends the event to every subscriber without waiting for slow ones.
+func (ps *progressStreams) publish(event progressEvent) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	for events := range ps.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// progressSnapshot describes where the wait is up to.
+func (sh *serviceHandler) progressSnapshot(eventType string) progressEvent {
+	view := sh.view()
+	event := progressEvent{
+		Type:         eventType,
+		Time:         time.Now(),
+		Phase:        view.phase,
+		DeploymentId: view.deploymentId,
+	}
+	if view.service != nil {
+		event.Desired = aws.Int64Value(view.service.DesiredCount)
+		event.Running = aws.Int64Value(view.service.RunningCount)
+		event.Pending = aws.Int64Value(view.service.PendingCount)
+		if deployment := ecswait.PrimaryDeployment(view.service); deployment != nil {
+			event.RolloutState = aws.StringValue(deployment.RolloutState)
+		}
+	}
+	return event
+}
+
+// publishProgress sends a snapshot to the progress streams.
+func (sh *serviceHandler) publishProgress(eventType string) {
+	sh.progress.publish(sh.progressSnapshot(eventType))
+}
+
+// publishResult sends the final result to the progress streams.
+func (sh *serviceHandler) publishResult(result string) {
+	event := sh.progressSnapshot("result")
+	event.Result = result
+	sh.progress.publish(event)
+
+	// We exit straight after the result, give the streams a moment to send it.
+	sh.progress.lock.Lock()
+	streaming := len(sh.progress.subscribers) > 0
+	sh.progress.lock.Unlock()
+	if streaming {
+		time.Sleep(time.Second)
+	}
+}
+
+// handleWatch routes /watches/{id}/... requests. Watches the request may not see are not found,
+// like ones that don't exist.
+func (srv *server) handleWatch(w http.ResponseWriter, r *http.Request, visible func(id string) bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/watches/"), "/")
+	if len(parts) != 2 || parts[1] != "stream" {
+		http.NotFound(w, r)
+		return
+	}
+	srv.lock.Lock()
+	sh, ok := srv.watches[parts[0]]
+	srv.lock.Unlock()
+	if !ok || !visible(parts[0]) {
+		http.Error(w, fmt.Sprintf("no watch called %s", parts[0]), http.StatusNotFound)
+		return
+	}
+	srv.streamProgress(w, r, sh)
+}
+
+// streamProgress sends the progress events of the watch as Server-Sent Events until the client goes away.
+func (srv *server) streamProgress(w http.ResponseWriter, r *http.Request, sh *serviceHandler) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events := sh.progress.subscribe()
+	defer sh.progress.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event progressEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	// Start with where we are up to so the client doesn't wait for the next change.
+	if err := send(sh.progressSnapshot("status")); err != nil {
+		return
+	}
+	for {
+		select {
+		case event := <-events:
+			if err := send(event); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// reapStopReason is shown on the tasks that -reap-old-tasks stops.
+const reapStopReason = "Stopped by are-we-there-yet: still running an old task definition after the deployment completed"
+
+// reapOldTasks stops RUNNING tasks of the service that are not on the task definition of the PRIMARY
+// deployment. These can be left behind when draining fails and ECS never gets around to stopping them.
+func (sh *serviceHandler) reapOldTasks() error {
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+	tasks, err := sh.serviceTasks(ecs.DesiredStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	reaped := 0
+	for _, task := range tasks {
+		if aws.StringValue(task.TaskDefinitionArn) == aws.StringValue(deployment.TaskDefinition) {
+			continue
+		}
+		_, err := sh.session.StopTaskWithContext(sh.ctx, &ecs.StopTaskInput{
+			Cluster: sh.clusterName,
+			Task:    task.TaskArn,
+			Reason:  aws.String(reapStopReason),
+		})
+		if err != nil {
+			return err
+		}
+		reaped++
+		sh.log.infof("Stopped task %s which was running %s.", taskId(aws.StringValue(task.TaskArn)), aws.StringValue(task.TaskDefinitionArn))
+	}
+
+	if reaped == 0 {
+		sh.log.infof("No old tasks found.")
+		return nil
+	}
+	sh.log.infof("Stopped %d old tasks.", reaped)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const redacted = "REDACTED"
+
+// redactor hides values that could be credentials before they are printed. Environment variable
+// values and secret references are always hidden, command arguments only when they match the pattern.
+type redactor struct {
+	pattern *regexp.Regexp
+}
+
+func newRedactor(pattern string) (*redactor, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &redactor{pattern: compiled}, nil
+}
+
+// setRedactor sets how credentials are hidden in the details that are printed.
+func (sh *serviceHandler) setRedactor(r *redactor) {
+	sh.redactor = r
+}
+
+func (r *redactor) environment(environment []*ecs.KeyValuePair) {
+	for _, variable := range environment {
+		if variable.Value != nil {
+			variable.Value = aws.String(redacted)
+		}
+	}
+}
+
+// arguments hides the arguments that match the pattern. A matching flag is kept, its value is
+// hidden: the value after the = of --api-key=abc, and the next argument of --password hunter2.
+func (r *redactor) arguments(arguments []*string) {
+	for i := 0; i < len(arguments); i++ {
+		argument := aws.StringValue(arguments[i])
+		if !r.pattern.MatchString(argument) {
+			continue
+		}
+		if !strings.HasPrefix(argument, "-") {
+			arguments[i] = aws.String(redacted)
+			continue
+		}
+		if equals := strings.Index(argument, "="); equals >= 0 {
+			arguments[i] = aws.String(argument[:equals+1] + redacted)
+			continue
+		}
+		if i+1 < len(arguments) {
+			i++
+			arguments[i] = aws.String(redacted)
+		}
+	}
+}
+
+// taskDefinition returns a copy of the task definition with the credentials hidden.
+func (r *redactor) taskDefinition(td *ecs.TaskDefinition) (*ecs.TaskDefinition, error) {
+	redactedTd := &ecs.TaskDefinition{}
+	if err := deepCopy(td, redactedTd); err != nil {
+		return nil, err
+	}
+	for _, container := range redactedTd.ContainerDefinitions {
+		r.environment(container.Environment)
+		for _, secret := range container.Secrets {
+			secret.ValueFrom = aws.String(redacted)
+		}
+		r.arguments(container.Command)
+		r.arguments(container.EntryPoint)
+	}
+	return redactedTd, nil
+}
+
+// tasks returns a copy of the tasks with the credentials in their container overrides hidden.
+func (r *redactor) tasks(tasks []*ecs.Task) ([]*ecs.Task, error) {
+	redactedTasks := []*ecs.Task{}
+	if err := deepCopy(tasks, &redactedTasks); err != nil {
+		return nil, err
+	}
+	for _, task := range redactedTasks {
+		if task.Overrides == nil {
+			continue
+		}
+		for _, override := range task.Overrides.ContainerOverrides {
+			r.environment(override.Environment)
+			r.arguments(override.Command)
+		}
+	}
+	return redactedTasks, nil
+}
+
+// deepCopy copies SDK structs through JSON so the copy shares no pointers with the original.
+func deepCopy(from, to interface{}) error {
+	content, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, to)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestRedactArguments(t *testing.T) {
+	r, err := newRedactor(`(?i)(password|passwd|secret|token|api[_-]?key|credential)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		arguments []string
+		expected  []string
+	}{
+		"flag and value": {
+			arguments: []string{"serve", "--password", "hunter2", "--port", "8080"},
+			expected:  []string{"serve", "--password", redacted, "--port", "8080"},
+		},
+		"flag with equals": {
+			arguments: []string{"serve", "--api-key=abc", "--port=8080"},
+			expected:  []string{"serve", "--api-key=" + redacted, "--port=8080"},
+		},
+		"flag at the end": {
+			arguments: []string{"serve", "-token"},
+			expected:  []string{"serve", "-token"},
+		},
+		"plain argument": {
+			arguments: []string{"sh", "-c", "echo $SECRET"},
+			expected:  []string{"sh", "-c", redacted},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			arguments := aws.StringSlice(test.arguments)
+			r.arguments(arguments)
+			if got := aws.StringValueSlice(arguments); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// regionUsage is the usage of the -region flag of every subcommand.
+const regionUsage = "AWS region of the service. Defaults to AWS_REGION, then AWS_DEFAULT_REGION, then the region of the AWS profile"
+
+// newAwsSession starts an AWS session in the region. Without one it is AWS_REGION, then
+// AWS_DEFAULT_REGION which the AWS CLI uses and CI runners often set, then the region of the
+// profile in ~/.aws/config.
+func newAwsSession(region string) (*session.Session, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// arnRegion is the region to use for a service given as an ARN. The ARN says where the service is,
+// so a -region that disagrees with it is a mistake.
+func arnRegion(region string, target ecsResource) (string, error) {
+	if target.region == "" {
+		return region, nil
+	}
+	if region != "" && region != target.region {
+		return "", fmt.Errorf("-region is %s but the ARN is in %s", region, target.region)
+	}
+	return target.region, nil
+}
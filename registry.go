@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// registeredWatch is a watch as the registry API shows it.
+type registeredWatch struct {
+	Id string `json:"id"`
+	watchConfig
+}
+
+// enableRegistry lets the tenants in the config register and unregister their own watches:
+// GET and POST /registry/watches and DELETE /registry/watches/{id}.
+func (d *daemon) enableRegistry() {
+	d.srv.mux.HandleFunc("/registry/watches", d.tenantOnly(d.handleRegistry))
+	d.srv.mux.HandleFunc("/registry/watches/", d.tenantOnly(d.handleRegistryWatch))
+	d.srv.watchScope = d.watchScope
+}
+
+// watchScope lets a tenant only see the watches it registered, on /watches/{id}, /metrics and
+// /debug/state. The watches in the config file need the -listen-api-key like before.
+func (d *daemon) watchScope(r *http.Request) func(id string) bool {
+	tenant, isTenant := d.tenantFor(r)
+	if !isTenant && !d.srv.hasApiKey(r) {
+		return nil
+	}
+	return func(id string) bool {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		// The watches of the config file have no tenant.
+		watch, ok := d.watches[id]
+		return ok && watch.tenant == tenant
+	}
+}
+
+// tenantAllows checks the watch only uses what the config lets the tenant use: its clusters and
+// the webhooks in the webhook_allowlist. The daemon would otherwise post to any URL a tenant
+// gives it and look at any service its credentials can see. The caller holds the lock.
+func (d *daemon) tenantAllows(tenant string, watch watchConfig) error {
+	allowed := false
+	for _, t := range d.cfg.Tenants {
+		if t.Name != tenant {
+			continue
+		}
+		for _, cluster := range t.Clusters {
+			allowed = allowed || cluster == watch.Cluster
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("tenant %s may not watch cluster %s", tenant, watch.Cluster)
+	}
+	if watch.NotifyWebhook != "" && !webhookAllowed(d.cfg.WebhookAllowlist, watch.NotifyWebhook) {
+		return fmt.Errorf("notify_webhook %s is not in the webhook_allowlist", watch.NotifyWebhook)
+	}
+	return nil
+}
+
+// webhookAllowed tells if the webhook has the scheme and host of an entry of the allowlist and
+// its path starts with the path of the entry. The path is cleaned first so ../ can't leave it.
+func webhookAllowed(allowlist []string, webhook string) bool {
+	target, err := url.Parse(webhook)
+	if err != nil {
+		return false
+	}
+	target.Path = path.Clean("/" + target.Path)
+	for _, entry := range allowlist {
+		allowed, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+		if target.Scheme == allowed.Scheme && target.Host == allowed.Host && target.User == nil && strings.HasPrefix(target.Path, allowed.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantFor returns the tenant whose token the request sends in the X-Api-Key header.
+func (d *daemon) tenantFor(r *http.Request) (string, bool) {
+	token := []byte(r.Header.Get("X-Api-Key"))
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, tenant := range d.cfg.Tenants {
+		if len(token) > 0 && subtle.ConstantTimeCompare(token, []byte(tenant.Token)) == 1 {
+			return tenant.Name, true
+		}
+	}
+	return "", false
+}
+
+// tenantOnly rejects requests without the token of a tenant.
+func (d *daemon) tenantOnly(handler func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := d.tenantFor(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r, tenant)
+	}
+}
+
+func (d *daemon) handleRegistry(w http.ResponseWriter, r *http.Request, tenant string) {
+	switch r.Method {
+	case http.MethodGet:
+		d.lock.Lock()
+		watches := []registeredWatch{}
+		for id, watch := range d.watches {
+			if watch.tenant == tenant {
+				watches = append(watches, registeredWatch{Id: id, watchConfig: watch.config})
+			}
+		}
+		d.lock.Unlock()
+		writeRegistryJson(w, http.StatusOK, watches)
+	case http.MethodPost:
+		watch := watchConfig{}
+		if err := json.NewDecoder(r.Body).Decode(&watch); err != nil {
+			http.Error(w, fmt.Sprintf("bad watch: %s", err), http.StatusBadRequest)
+			return
+		}
+		status, err := d.register(tenant, watch)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeRegistryJson(w, status, registeredWatch{Id: watchId(watch.Cluster, watch.Service), watchConfig: watch})
+	default:
+		http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+	}
+}
+
+func (d *daemon) handleRegistryWatch(w http.ResponseWriter, r *http.Request, tenant string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "use DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/registry/watches/")
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// Other tenants can't tell the watches of each other apart from ones that don't exist.
+	if watch, ok := d.watches[id]; !ok || watch.tenant != tenant {
+		http.NotFound(w, r)
+		return
+	}
+	logger.infof("Tenant %s unregistered %s.", tenant, id)
+	d.stopWatch(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// register starts a watch for the tenant. It returns the HTTP status to answer with.
+func (d *daemon) register(tenant string, watch watchConfig) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	settings, err := resolveWatch(d.cfg, d.triggers, watch)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := d.tenantAllows(tenant, watch); err != nil {
+		return http.StatusForbidden, err
+	}
+	id := watchId(watch.Cluster, watch.Service)
+	if _, ok := d.watches[id]; ok {
+		return http.StatusConflict, fmt.Errorf("service %s in cluster %s is already watched", watch.Service, watch.Cluster)
+	}
+	logger.infof("Tenant %s registered %s.", tenant, id)
+	d.startWatch(id, tenant, watch, settings)
+	return http.StatusCreated, nil
+}
+
+func writeRegistryJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// reportFormats are the formats the report of a run can be rendered in. The output of each is
+// checked against the files in testdata/render, scripts depend on it so it only changes on purpose.
+var reportFormats = map[string]func(io.Writer, runReport) error{
+	"text":     renderText,
+	"json":     renderJson,
+	"markdown": renderMarkdown,
+	"junit":    renderJunit,
+}
+
+// reportFormatNames returns the names of the report formats for help and error messages.
+func reportFormatNames() string {
+	names := []string{}
+	for name := range reportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// formatSeconds prints seconds to one decimal place, or - when they are not known.
+func formatSeconds(seconds *float64) string {
+	if seconds == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fs", *seconds)
+}
+
+// reportDeployment returns the deployment of the report, a run can fail before it finds one.
+func reportDeployment(report runReport) string {
+	if report.DeploymentId == "" {
+		return "unknown"
+	}
+	return report.DeploymentId
+}
+
+// endpointPublicIp returns the public IP of the endpoint, or - when the task has none.
+func endpointPublicIp(endpoint reportEndpoint) string {
+	if endpoint.PublicIp == "" {
+		return "-"
+	}
+	return endpoint.PublicIp
+}
+
+func renderJson(w io.Writer, report runReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", content)
+	return err
+}
+
+func renderText(w io.Writer, report runReport) error {
+	fmt.Fprintf(w, "Service %s in cluster %s: %s\n", report.Service, report.Cluster, report.Result)
+	fmt.Fprintf(w, "Deployment: %s\n", reportDeployment(report))
+	fmt.Fprintf(w, "Started: %s\n", report.Started.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Duration: %.1fs\n", report.DurationSeconds)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(report.Phases) > 0 {
+		fmt.Fprintln(tw, "\nPHASE\tDURATION")
+		for _, phase := range report.Phases {
+			fmt.Fprintf(tw, "%s\t%.1fs\n", phase.Name, phase.Seconds)
+		}
+	}
+	if len(report.Transitions) > 0 {
+		fmt.Fprintln(tw, "\nTRANSITION\tCOUNT\tP50\tP90\tMAX")
+		for _, t := range report.Transitions {
+			fmt.Fprintf(tw, "%s\t%d\t%.1fs\t%.1fs\t%.1fs\n", t.Name, t.Count, t.P50Seconds, t.P90Seconds, t.MaxSeconds)
+		}
+	}
+	if len(report.Tasks) > 0 {
+		fmt.Fprintln(tw, "\nTASK\tTASK DEFINITION\tPROVISIONING\tIMAGE PULL\tSTARTUP\tTOTAL")
+		for _, task := range report.Tasks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", task.TaskId, task.TaskDefinition,
+				formatSeconds(task.ProvisioningSeconds), formatSeconds(task.ImagePullSeconds),
+				formatSeconds(task.ContainerStartupSeconds), formatSeconds(task.TotalSeconds))
+		}
+	}
+	if len(report.Endpoints) > 0 {
+		fmt.Fprintln(tw, "\nTASK\tENI\tPRIVATE IP\tPUBLIC IP")
+		for _, endpoint := range report.Endpoints {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", endpoint.TaskId, endpoint.EniId, endpoint.PrivateIp, endpointPublicIp(endpoint))
+		}
+	}
+	return tw.Flush()
+}
+
+func renderMarkdown(w io.Writer, report runReport) error {
+	fmt.Fprintf(w, "## %s in %s: %s\n\n", report.Service, report.Cluster, report.Result)
+	fmt.Fprintf(w, "- Deployment: `%s`\n", reportDeployment(report))
+	fmt.Fprintf(w, "- Started: %s\n", report.Started.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "- Duration: %.1fs\n", report.DurationSeconds)
+
+	if len(report.Phases) > 0 {
+		fmt.Fprint(w, "\n| Phase | Duration |\n| --- | ---: |\n")
+		for _, phase := range report.Phases {
+			fmt.Fprintf(w, "| %s | %.1fs |\n", phase.Name, phase.Seconds)
+		}
+	}
+	if len(report.Transitions) > 0 {
+		fmt.Fprint(w, "\n| Transition | Count | P50 | P90 | Max |\n| --- | ---: | ---: | ---: | ---: |\n")
+		for _, t := range report.Transitions {
+			fmt.Fprintf(w, "| %s | %d | %.1fs | %.1fs | %.1fs |\n", t.Name, t.Count, t.P50Seconds, t.P90Seconds, t.MaxSeconds)
+		}
+	}
+	if len(report.Tasks) > 0 {
+		fmt.Fprint(w, "\n| Task | Task definition | Provisioning | Image pull | Startup | Total |\n| --- | --- | ---: | ---: | ---: | ---: |\n")
+		for _, task := range report.Tasks {
+			fmt.Fprintf(w, "| %s | `%s` | %s | %s | %s | %s |\n", task.TaskId, task.TaskDefinition,
+				formatSeconds(task.ProvisioningSeconds), formatSeconds(task.ImagePullSeconds),
+				formatSeconds(task.ContainerStartupSeconds), formatSeconds(task.TotalSeconds))
+		}
+	}
+	if len(report.Endpoints) > 0 {
+		fmt.Fprint(w, "\n| Task | ENI | Private IP | Public IP |\n| --- | --- | --- | --- |\n")
+		for _, endpoint := range report.Endpoints {
+			fmt.Fprintf(w, "| %s | `%s` | %s | %s |\n", endpoint.TaskId, endpoint.EniId, endpoint.PrivateIp, endpointPublicIp(endpoint))
+		}
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// renderJunit renders every phase as a test case so CI systems show where a deploy spent its time.
+// A failed run fails the phase it was in when it stopped.
+func renderJunit(w io.Writer, report runReport) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("%s/%s", report.Cluster, report.Service),
+		Time:      fmt.Sprintf("%.3f", report.DurationSeconds),
+		Timestamp: report.Started.UTC().Format(time.RFC3339),
+		Cases:     []junitTestCase{},
+	}
+	phases := report.Phases
+	if len(phases) == 0 {
+		phases = []reportPhase{{Name: "deployment", Seconds: report.DurationSeconds}}
+	}
+	for _, phase := range phases {
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      phase.Name,
+			ClassName: suite.Name,
+			Time:      fmt.Sprintf("%.3f", phase.Seconds),
+		})
+	}
+	if report.Result != "success" {
+		suite.Cases[len(suite.Cases)-1].Failure = &junitFailure{
+			Message: fmt.Sprintf("deployment %s %s", reportDeployment(report), report.Result),
+		}
+		suite.Failures = 1
+	}
+	suite.Tests = len(suite.Cases)
+
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, content)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// updateGolden rewrites the golden files with the current output: go test -run TestRender -update
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata/render")
+
+// goldenExtensions are the file extensions of the golden files of each format.
+var goldenExtensions = map[string]string{
+	"text":     "txt",
+	"json":     "json",
+	"markdown": "md",
+	"junit":    "xml",
+}
+
+func goldenReports() map[string]runReport {
+	started := time.Date(2023, 3, 14, 9, 30, 0, 0, time.UTC)
+	return map[string]runReport{
+		"success": {
+			Cluster:         "production",
+			Service:         "web",
+			DeploymentId:    "ecs-svc/1234567890123456789",
+			Result:          "success",
+			Started:         started,
+			DurationSeconds: 312.5,
+			Phases: []reportPhase{
+				{Name: "deployment", Seconds: 241.2},
+				{Name: "running count", Seconds: 15.3},
+				{Name: "target health", Seconds: 56},
+			},
+			Transitions: []reportTransition{
+				{Name: "PROVISIONING to PENDING", Count: 2, P50Seconds: 3.1, P90Seconds: 4.2, MaxSeconds: 4.2},
+				{Name: "PENDING to RUNNING", Count: 2, P50Seconds: 21, P90Seconds: 35.5, MaxSeconds: 35.5},
+			},
+			Tasks: []taskStartup{
+				{
+					TaskId:                  "0a1b2c3d4e5f",
+					TaskDefinition:          "arn:aws:ecs:eu-west-1:123456789012:task-definition/web:42",
+					ProvisioningSeconds:     aws.Float64(3.1),
+					ImagePullSeconds:        aws.Float64(12.4),
+					ContainerStartupSeconds: aws.Float64(8.6),
+					TotalSeconds:            aws.Float64(24.1),
+				},
+				{
+					TaskId:         "6a7b8c9d0e1f",
+					TaskDefinition: "arn:aws:ecs:eu-west-1:123456789012:task-definition/web:42",
+				},
+			},
+			Endpoints: []reportEndpoint{
+				{TaskId: "0a1b2c3d4e5f", EniId: "eni-0123456789abcdef0", PrivateIp: "10.0.1.12", PublicIp: "203.0.113.7"},
+				{TaskId: "6a7b8c9d0e1f", EniId: "eni-0fedcba9876543210", PrivateIp: "10.0.2.34"},
+			},
+		},
+		"failed": {
+			Cluster:         "production",
+			Service:         "web",
+			DeploymentId:    "ecs-svc/1234567890123456789",
+			Result:          "failed",
+			Started:         started,
+			DurationSeconds: 600,
+			Phases: []reportPhase{
+				{Name: "deployment", Seconds: 600},
+			},
+			Transitions: []reportTransition{},
+			Tasks:       []taskStartup{},
+			Endpoints:   []reportEndpoint{},
+		},
+		"empty": {
+			Cluster:     "production",
+			Service:     "web",
+			Result:      "failed",
+			Started:     started,
+			Phases:      []reportPhase{},
+			Transitions: []reportTransition{},
+			Tasks:       []taskStartup{},
+			Endpoints:   []reportEndpoint{},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	if len(goldenExtensions) != len(reportFormats) {
+		t.Fatalf("every report format needs a golden file extension, got %d extensions for %d formats", len(goldenExtensions), len(reportFormats))
+	}
+	for format, render := range reportFormats {
+		for name, report := range goldenReports() {
+			t.Run(format+"/"+name, func(t *testing.T) {
+				var output bytes.Buffer
+				if err := render(&output, report); err != nil {
+					t.Fatalf("render: %s", err)
+				}
+
+				path := filepath.Join("testdata", "render", name+"."+goldenExtensions[format])
+				if *updateGolden {
+					if err := os.WriteFile(path, output.Bytes(), 0644); err != nil {
+						t.Fatalf("write %s: %s", path, err)
+					}
+				}
+				golden, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("read %s: %s", path, err)
+				}
+				if !bytes.Equal(output.Bytes(), golden) {
+					t.Errorf("output does not match %s, run go test -run TestRender -update if the change is on purpose\ngot:\n%s\nwant:\n%s", path, output.Bytes(), golden)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// runReport is the report written with -json-output and -report. Durations are in seconds.
+type runReport struct {
+	Cluster         string             `json:"cluster"`
+	Service         string             `json:"service"`
+	DeploymentId    string             `json:"deployment_id"`
+	Result          string             `json:"result"`
+	Started         time.Time          `json:"started"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	Phases          []reportPhase      `json:"phases"`
+	Transitions     []reportTransition `json:"transitions"`
+	Tasks           []taskStartup      `json:"tasks"`
+	Endpoints       []reportEndpoint   `json:"endpoints"`
+}
+
+type reportPhase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+type reportTransition struct {
+	Name       string  `json:"name"`
+	Count      int     `json:"count"`
+	P50Seconds float64 `json:"p50_seconds"`
+	P90Seconds float64 `json:"p90_seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+}
+
+// reportEndpoint is where a task of the deployment can be reached, for smoke tests that run after
+// the deploy. The public IP is left out when the task has none.
+type reportEndpoint struct {
+	TaskId    string `json:"task_id"`
+	EniId     string `json:"eni_id"`
+	PrivateIp string `json:"private_ip"`
+	PublicIp  string `json:"public_ip,omitempty"`
+}
+
+// taskStartup splits the time a task took to start into the image pull and the container startup,
+// so a slow deploy can be put down to big images or slow application boot. A duration is left
+// out when ECS did not record the timestamps for it.
+type taskStartup struct {
+	TaskId                  string   `json:"task_id"`
+	TaskDefinition          string   `json:"task_definition"`
+	ProvisioningSeconds     *float64 `json:"provisioning_seconds,omitempty"`
+	ImagePullSeconds        *float64 `json:"image_pull_seconds,omitempty"`
+	ContainerStartupSeconds *float64 `json:"container_startup_seconds,omitempty"`
+	TotalSeconds            *float64 `json:"total_seconds,omitempty"`
+}
+
+// secondsBetween returns the seconds from start to end, or nil if either is not set.
+func secondsBetween(start, end *time.Time) *float64 {
+	if start == nil || end == nil || start.IsZero() || end.IsZero() {
+		return nil
+	}
+	return aws.Float64(end.Sub(*start).Seconds())
+}
+
+func newTaskStartup(task *ecs.Task) taskStartup {
+	return taskStartup{
+		TaskId:                  taskId(aws.StringValue(task.TaskArn)),
+		TaskDefinition:          aws.StringValue(task.TaskDefinitionArn),
+		ProvisioningSeconds:     secondsBetween(task.CreatedAt, task.PullStartedAt),
+		ImagePullSeconds:        secondsBetween(task.PullStartedAt, task.PullStoppedAt),
+		ContainerStartupSeconds: secondsBetween(task.PullStoppedAt, task.StartedAt),
+		TotalSeconds:            secondsBetween(task.CreatedAt, task.StartedAt),
+	}
+}
+
+// buildReport collects the result of the run and the startup of every task of the watched deployment.
+func (sh *serviceHandler) buildReport(result string) runReport {
+	sh.finishPhase()
+	report := runReport{
+		Cluster:         aws.StringValue(sh.clusterName),
+		Service:         aws.StringValue(sh.serviceName),
+		DeploymentId:    sh.trackedDeployment,
+		Result:          result,
+		Started:         sh.started,
+		DurationSeconds: time.Since(sh.started).Seconds(),
+		Phases:          []reportPhase{},
+		Transitions:     []reportTransition{},
+		Tasks:           []taskStartup{},
+		Endpoints:       []reportEndpoint{},
+	}
+	for _, phase := range sh.phaseTimings {
+		report.Phases = append(report.Phases, reportPhase{Name: phase.Name, Seconds: phase.Duration.Seconds()})
+	}
+	for _, stats := range sh.transitionSummary() {
+		report.Transitions = append(report.Transitions, reportTransition{
+			Name:       stats.Name,
+			Count:      stats.Count,
+			P50Seconds: stats.P50.Seconds(),
+			P90Seconds: stats.P90.Seconds(),
+			MaxSeconds: stats.Max.Seconds(),
+		})
+	}
+
+	if deploymentId := sh.failingDeploymentId(); deploymentId != "" {
+		tasks, err := sh.deploymentTasks(deploymentId, ecs.DesiredStatusRunning)
+		if err != nil {
+			sh.log.errorf("There was an error listing the tasks for the JSON output. Error: %s", err)
+		}
+		for _, task := range tasks {
+			report.Tasks = append(report.Tasks, newTaskStartup(task))
+		}
+		endpoints, err := sh.taskEndpoints(tasks)
+		if err != nil {
+			sh.log.errorf("There was an error looking up the task endpoints for the JSON output. Error: %s", err)
+		}
+		for _, endpoint := range endpoints {
+			report.Endpoints = append(report.Endpoints, reportEndpoint{
+				TaskId:    taskId(endpoint.taskArn),
+				EniId:     endpoint.eniId,
+				PrivateIp: endpoint.privateIp,
+				PublicIp:  endpoint.publicIp,
+			})
+		}
+	}
+	return report
+}
+
+// writeReport renders the report in the format to the path.
+func writeReport(path, format string, report runReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return reportFormats[format](file, report)
+}
+
+// writeReports writes the -json-output and -report files, if there are any.
+func writeReports(ecsService *serviceHandler, result string) {
+	if *flagJsonOutput == "" && *flagReport == "" {
+		return
+	}
+	report := ecsService.buildReport(result)
+	if *flagJsonOutput != "" {
+		if err := writeReport(*flagJsonOutput, "json", report); err != nil {
+			ecsService.log.errorf("There was an error writing the JSON output. Error: %s", err)
+		}
+	}
+	if *flagReport != "" {
+		if err := writeReport(*flagReport, *flagReportAs, report); err != nil {
+			ecsService.log.errorf("There was an error writing the report. Error: %s", err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// taskResources are the CPU units, memory in MiB and GPUs that a task needs.
+type taskResources struct {
+	cpu    int64
+	memory int64
+	gpu    int64
+}
+
+// requiredResources works out what the task definition needs. Task level CPU and memory
+// win over the container values, which are summed up when the task level is not set.
+func requiredResources(td *ecs.TaskDefinition) taskResources {
+	resources := taskResources{}
+	for _, container := range td.ContainerDefinitions {
+		resources.cpu += aws.Int64Value(container.Cpu)
+		if container.Memory != nil {
+			resources.memory += aws.Int64Value(container.Memory)
+		} else {
+			resources.memory += aws.Int64Value(container.MemoryReservation)
+		}
+		for _, requirement := range container.ResourceRequirements {
+			if aws.StringValue(requirement.Type) == ecs.ResourceTypeGpu {
+				gpus, _ := strconv.ParseInt(aws.StringValue(requirement.Value), 10, 64)
+				resources.gpu += gpus
+			}
+		}
+	}
+
+	if cpu, err := strconv.ParseInt(aws.StringValue(td.Cpu), 10, 64); err == nil {
+		resources.cpu = cpu
+	}
+	if memory, err := strconv.ParseInt(aws.StringValue(td.Memory), 10, 64); err == nil {
+		resources.memory = memory
+	}
+	return resources
+}
+
+// checkResources compares the task definition requirements with the expected values, then
+// warns when the requirements can't be provided by Fargate or the cluster's container instances.
+// Expected values of 0 are not checked.
+func (sh *serviceHandler) checkResources(expectedCpu, expectedMemory int64) error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+	required := requiredResources(td)
+	sh.log.infof("Task definition requires CPU: %d, Memory: %d MiB, GPU: %d.", required.cpu, required.memory, required.gpu)
+
+	problems := []string{}
+	if expectedCpu > 0 && required.cpu != expectedCpu {
+		problems = append(problems, fmt.Sprintf("CPU is %d, expected %d", required.cpu, expectedCpu))
+	}
+	if expectedMemory > 0 && required.memory != expectedMemory {
+		problems = append(problems, fmt.Sprintf("memory is %d MiB, expected %d MiB", required.memory, expectedMemory))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unexpected resource requirements: %s", strings.Join(problems, "; "))
+	}
+
+	var warnings []string
+	if sh.usesFargate() {
+		warnings = fargateResourceWarnings(required)
+	} else {
+		warnings, err = sh.containerInstanceResourceWarnings(required)
+		if err != nil {
+			return err
+		}
+	}
+	for _, warning := range warnings {
+		sh.log.warnf("%s", warning)
+	}
+	return nil
+}
+
+// usesFargate reports if the service runs its tasks on Fargate.
+func (sh *serviceHandler) usesFargate() bool {
+	if aws.StringValue(sh.currentOutput.LaunchType) == ecs.LaunchTypeFargate {
+		return true
+	}
+	for _, item := range sh.currentOutput.CapacityProviderStrategy {
+		if strings.HasPrefix(aws.StringValue(item.CapacityProvider), "FARGATE") {
+			return true
+		}
+	}
+	return false
+}
+
+// fargateMemoryRanges lists the memory values in MiB that Fargate supports for each CPU value.
+var fargateMemoryRanges = map[int64]struct{ min, max, step int64 }{
+	256:   {512, 2048, 512},
+	512:   {1024, 4096, 1024},
+	1024:  {2048, 8192, 1024},
+	2048:  {4096, 16384, 1024},
+	4096:  {8192, 30720, 1024},
+	8192:  {16384, 61440, 4096},
+	16384: {32768, 122880, 8192},
+}
+
+func fargateResourceWarnings(required taskResources) []string {
+	warnings := []string{}
+	if required.gpu > 0 {
+		warnings = append(warnings, "Fargate does not provide GPUs")
+	}
+
+	memoryRange, ok := fargateMemoryRanges[required.cpu]
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf("%d CPU units is not a Fargate task size", required.cpu))
+		return warnings
+	}
+	// 256 CPU units only allow 512, 1024 and 2048 MiB, which the step covers apart from 1536.
+	validMemory := required.memory >= memoryRange.min && required.memory <= memoryRange.max && (required.memory-memoryRange.min)%memoryRange.step == 0
+	if required.cpu == 256 && required.memory == 1536 {
+		validMemory = false
+	}
+	if !validMemory {
+		warnings = append(warnings, fmt.Sprintf("%d MiB of memory is not supported by Fargate with %d CPU units", required.memory, required.cpu))
+	}
+	return warnings
+}
+
+// containerInstanceResourceWarnings checks that at least one container instance in the cluster is
+// big enough for the task. Only registered resources are compared, not what is free right now.
+func (sh *serviceHandler) containerInstanceResourceWarnings(required taskResources) ([]string, error) {
+	arns := []*string{}
+	err := sh.session.ListContainerInstancesPagesWithContext(sh.ctx,
+		&ecs.ListContainerInstancesInput{Cluster: sh.clusterName},
+		func(page *ecs.ListContainerInstancesOutput, lastPage bool) bool {
+			arns = append(arns, page.ContainerInstanceArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(arns) == 0 {
+		return []string{"the cluster has no container instances to run the task on"}, nil
+	}
+
+	largest := taskResources{}
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := start + describeTasksBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := sh.session.DescribeContainerInstancesWithContext(sh.ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            sh.clusterName,
+			ContainerInstances: arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range output.ContainerInstances {
+			registered := registeredResources(instance)
+			if registered.cpu > largest.cpu {
+				largest.cpu = registered.cpu
+			}
+			if registered.memory > largest.memory {
+				largest.memory = registered.memory
+			}
+			if registered.gpu > largest.gpu {
+				largest.gpu = registered.gpu
+			}
+		}
+	}
+
+	warnings := []string{}
+	if required.cpu > largest.cpu {
+		warnings = append(warnings, fmt.Sprintf("the task needs %d CPU units, the largest container instance has %d", required.cpu, largest.cpu))
+	}
+	if required.memory > largest.memory {
+		warnings = append(warnings, fmt.Sprintf("the task needs %d MiB of memory, the largest container instance has %d MiB", required.memory, largest.memory))
+	}
+	if required.gpu > largest.gpu {
+		warnings = append(warnings, fmt.Sprintf("the task needs %d GPUs, the largest container instance has %d", required.gpu, largest.gpu))
+	}
+	return warnings, nil
+}
+
+func registeredResources(instance *ecs.ContainerInstance) taskResources {
+	registered := taskResources{}
+	for _, resource := range instance.RegisteredResources {
+		switch aws.StringValue(resource.Name) {
+		case "CPU":
+			registered.cpu = aws.Int64Value(resource.IntegerValue)
+		case "MEMORY":
+			registered.memory = aws.Int64Value(resource.IntegerValue)
+		case "GPU":
+			registered.gpu = int64(len(resource.StringSetValue))
+		}
+	}
+	return registered
+}
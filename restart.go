@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// restartStopReason is shown on the tasks that -restart-unhealthy stops.
+const restartStopReason = "Stopped by are-we-there-yet: task was UNHEALTHY during the deployment"
+
+// setMaxRestarts sets how many UNHEALTHY tasks can be stopped while waiting. 0 turns restarts off.
+func (sh *serviceHandler) setMaxRestarts(max int) {
+	sh.maxRestarts = max
+}
+
+// restartUnhealthyTasks stops RUNNING tasks of the watched deployment whose container health
+// checks have marked them UNHEALTHY, so that ECS starts replacements. Tasks stuck like this can hold
+// up a deployment until the timeout.
+func (sh *serviceHandler) restartUnhealthyTasks(tasks []*ecs.Task) {
+	if sh.restarts >= sh.maxRestarts {
+		return
+	}
+
+	for _, task := range tasks {
+		if aws.StringValue(task.HealthStatus) != ecs.HealthStatusUnhealthy || ecswait.InGracePeriod(sh.currentOutput, task) {
+			continue
+		}
+		_, err := sh.session.StopTaskWithContext(sh.ctx, &ecs.StopTaskInput{
+			Cluster: sh.clusterName,
+			Task:    task.TaskArn,
+			Reason:  aws.String(restartStopReason),
+		})
+		if err != nil {
+			sh.log.errorf("There was an error stopping unhealthy task %s. Error: %s", taskId(aws.StringValue(task.TaskArn)), err)
+			continue
+		}
+		sh.restarts++
+		sh.log.infof("Stopped unhealthy task %s so it gets replaced, restart %d of %d.", taskId(aws.StringValue(task.TaskArn)), sh.restarts, sh.maxRestarts)
+		if sh.restarts >= sh.maxRestarts {
+			sh.log.infof("Reached the maximum number of restarts, unhealthy tasks will be left alone.")
+			return
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+// scheduledTaskHandler verifies ECS tasks that are started on a schedule by an EventBridge rule.
+// Scheduled tasks have no service to watch, so instead we wait for the next invocation of the rule
+// and check that the task it starts runs to a successful completion.
+type scheduledTaskHandler struct {
+	ctx            context.Context
+	session        *ecs.ECS
+	eventsSession  *eventbridge.EventBridge
+	ruleName       *string
+	eventBusName   *string
+	schedule       string
+	checkInterval  int
+	checkTimeout   int
+	taskDefinition *ecs.TaskDefinition
+	clusterArn     *string
+}
+
+func newScheduledTaskHandler(ctx context.Context, awsSession *session.Session, ruleName, eventBusName string, checkInterval, checkTimeout int) *scheduledTaskHandler {
+	handler := &scheduledTaskHandler{
+		ctx:           ctx,
+		session:       ecs.New(awsSession),
+		eventsSession: eventbridge.New(awsSession),
+		ruleName:      aws.String(ruleName),
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+	}
+	if eventBusName != "" {
+		handler.eventBusName = aws.String(eventBusName)
+	}
+	return handler
+}
+
+// checkRule makes sure the rule is enabled and finds the ECS task that it starts.
+func (st *scheduledTaskHandler) checkRule() error {
+	rule, err := st.eventsSession.DescribeRuleWithContext(st.ctx, &eventbridge.DescribeRuleInput{
+		Name:         st.ruleName,
+		EventBusName: st.eventBusName,
+	})
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(rule.State) != eventbridge.RuleStateEnabled {
+		return fmt.Errorf("rule %s is %s", aws.StringValue(st.ruleName), aws.StringValue(rule.State))
+	}
+	st.schedule = aws.StringValue(rule.ScheduleExpression)
+	logger.infof("Rule %s is enabled with schedule %s.", aws.StringValue(st.ruleName), st.schedule)
+
+	targets, err := st.eventsSession.ListTargetsByRuleWithContext(st.ctx, &eventbridge.ListTargetsByRuleInput{
+		Rule:         st.ruleName,
+		EventBusName: st.eventBusName,
+	})
+	if err != nil {
+		return err
+	}
+	for _, target := range targets.Targets {
+		if target.EcsParameters == nil {
+			continue
+		}
+		output, err := st.session.DescribeTaskDefinitionWithContext(st.ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: target.EcsParameters.TaskDefinitionArn,
+		})
+		if err != nil {
+			return err
+		}
+		st.taskDefinition = output.TaskDefinition
+		st.clusterArn = target.Arn
+		logger.infof("Rule starts task definition %s on cluster %s.", aws.StringValue(st.taskDefinition.TaskDefinitionArn), aws.StringValue(st.clusterArn))
+		return nil
+	}
+
+	return fmt.Errorf("rule %s has no ECS task target", aws.StringValue(st.ruleName))
+}
+
+// startedByMaxLength is how long startedBy of a task can be. EventBridge cuts events-rule/<rule name>
+// off there for rules with long names.
+const startedByMaxLength = 36
+
+// ruleStartedBy returns the startedBy that EventBridge sets on the tasks that the rule runs.
+func ruleStartedBy(ruleName string) string {
+	startedBy := "events-rule/" + ruleName
+	if len(startedBy) > startedByMaxLength {
+		startedBy = startedBy[:startedByMaxLength]
+	}
+	return startedBy
+}
+
+// invokedTasks finds the tasks that the rule started after the given time. Other rules can run
+// the same task definition, so only tasks with the startedBy of this rule count.
+func (st *scheduledTaskHandler) invokedTasks(since time.Time) ([]*ecs.Task, error) {
+	arns := []*string{}
+	for _, status := range []string{ecs.DesiredStatusRunning, ecs.DesiredStatusStopped} {
+		err := st.session.ListTasksPagesWithContext(st.ctx,
+			&ecs.ListTasksInput{
+				Cluster:       st.clusterArn,
+				Family:        st.taskDefinition.Family,
+				DesiredStatus: aws.String(status),
+			},
+			func(page *ecs.ListTasksOutput, lastPage bool) bool {
+				arns = append(arns, page.TaskArns...)
+				return true
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	startedBy := ruleStartedBy(aws.StringValue(st.ruleName))
+	tasks := []*ecs.Task{}
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := start + describeTasksBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := st.session.DescribeTasksWithContext(st.ctx, &ecs.DescribeTasksInput{
+			Cluster: st.clusterArn,
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range output.Tasks {
+			if aws.StringValue(task.StartedBy) == startedBy && aws.TimeValue(task.CreatedAt).After(since) {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// waitForInvocation waits for the rule to start a task and for that task to stop.
+// The run is a success when every essential container exited with code 0. The rule gets until its
+// next invocation plus the -timeout, so hourly and daily rules don't need a hand tuned timeout.
+func (st *scheduledTaskHandler) waitForInvocation() error {
+	waitStarted := time.Now()
+	wait := time.Minute * time.Duration(st.checkTimeout)
+	if next, err := nextInvocation(st.schedule, waitStarted); err != nil {
+		logger.warnf("Can't tell when rule %s runs next, waiting %s for it. Error: %s", aws.StringValue(st.ruleName), wait, err)
+	} else {
+		wait += next.Sub(waitStarted)
+		logger.infof("Rule %s runs next by %s. Waiting until %s for the task to complete.",
+			aws.StringValue(st.ruleName), next.Format(time.RFC3339), waitStarted.Add(wait).Format(time.RFC3339))
+	}
+	essential := map[string]bool{}
+	for _, container := range st.taskDefinition.ContainerDefinitions {
+		// Containers are essential unless they are marked otherwise.
+		essential[aws.StringValue(container.Name)] = container.Essential == nil || aws.BoolValue(container.Essential)
+	}
+
+	checkTimer := time.NewTicker(time.Second * time.Duration(st.checkInterval))
+	timeout := time.NewTimer(wait)
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	// Task status is only logged when it changes, the wait for a daily rule has a lot of checks.
+	lastStatus := map[string]string{}
+
+	for {
+		select {
+		case <-checkTimer.C:
+			tasks, err := st.invokedTasks(waitStarted)
+			if err != nil {
+				return err
+			}
+			if len(tasks) == 0 {
+				logger.progressf("Waiting another %d seconds for rule %s to start a task.", st.checkInterval, aws.StringValue(st.ruleName))
+				continue
+			}
+
+			stopped := true
+			for _, task := range tasks {
+				arn, status := aws.StringValue(task.TaskArn), aws.StringValue(task.LastStatus)
+				if status != ecs.DesiredStatusStopped {
+					stopped = false
+					if lastStatus[arn] != status {
+						logger.infof("Task %s is %s.", arn, status)
+					}
+				}
+				lastStatus[arn] = status
+			}
+			if !stopped {
+				logger.progressf("Waiting another %d seconds for the tasks of rule %s to stop.", st.checkInterval, aws.StringValue(st.ruleName))
+				continue
+			}
+
+			for _, task := range tasks {
+				for _, container := range task.Containers {
+					if !essential[aws.StringValue(container.Name)] {
+						continue
+					}
+					if container.ExitCode == nil || aws.Int64Value(container.ExitCode) != 0 {
+						return fmt.Errorf(
+							"container %s in task %s did not exit cleanly. Exit code: %s, Reason: %s, Task stopped reason: %s",
+							aws.StringValue(container.Name),
+							aws.StringValue(task.TaskArn),
+							exitCodeString(container.ExitCode),
+							aws.StringValue(container.Reason),
+							aws.StringValue(task.StoppedReason),
+						)
+					}
+				}
+				logger.infof("Task %s completed successfully.", aws.StringValue(task.TaskArn))
+			}
+			return nil
+		case <-st.ctx.Done():
+			return st.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for rule %s to run a task to completion", aws.StringValue(st.ruleName))
+		}
+	}
+}
+
+func exitCodeString(code *int64) string {
+	if code == nil {
+		return "none"
+	}
+	return fmt.Sprint(*code)
+}
+
+// eventBridgeNames are the month and day of week names that EventBridge cron expressions allow.
+var eventBridgeNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	"SUN": 1, "MON": 2, "TUE": 3, "WED": 4, "THU": 5, "FRI": 6, "SAT": 7,
+}
+
+// nextInvocation returns the latest time that the next invocation of a rule with the given
+// schedule expression can happen. For rate(...) that is a rate from now, as the rule's start is
+// unknown. For cron(...) it is the next match, in UTC like EventBridge. Rules without a schedule
+// and cron expressions using L, W or # return an error.
+func nextInvocation(expression string, now time.Time) (time.Time, error) {
+	switch {
+	case strings.HasPrefix(expression, "rate(") && strings.HasSuffix(expression, ")"):
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(expression, "rate("), ")"))
+		if len(fields) != 2 {
+			return time.Time{}, fmt.Errorf("bad rate expression %q", expression)
+		}
+		value, err := strconv.Atoi(fields[0])
+		if err != nil || value < 1 {
+			return time.Time{}, fmt.Errorf("bad rate expression %q", expression)
+		}
+		unit := map[string]time.Duration{
+			"minute": time.Minute, "minutes": time.Minute,
+			"hour": time.Hour, "hours": time.Hour,
+			"day": 24 * time.Hour, "days": 24 * time.Hour,
+		}[fields[1]]
+		if unit == 0 {
+			return time.Time{}, fmt.Errorf("bad unit in rate expression %q", expression)
+		}
+		return now.Add(time.Duration(value) * unit), nil
+	case strings.HasPrefix(expression, "cron(") && strings.HasSuffix(expression, ")"):
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(expression, "cron("), ")"))
+		if len(fields) != 6 {
+			return time.Time{}, fmt.Errorf("cron expression %q needs 6 fields", expression)
+		}
+		if fields[5] != "*" {
+			return time.Time{}, fmt.Errorf("years in cron expression %q are not supported", expression)
+		}
+		month, err := eventBridgeField(fields[3], 0)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad month in cron expression %q. Error: %s", expression, err)
+		}
+		// EventBridge counts the days of the week from 1 for Sunday, cron from 0.
+		weekday, err := eventBridgeField(fields[4], -1)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad day of week in cron expression %q. Error: %s", expression, err)
+		}
+		day := fields[2]
+		if day == "?" {
+			day = "*"
+		}
+		schedule, err := parseCron(strings.Join([]string{fields[0], fields[1], day, month, weekday}, " "))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return schedule.next(now.UTC()), nil
+	case expression == "":
+		return time.Time{}, fmt.Errorf("the rule has no schedule")
+	}
+	return time.Time{}, fmt.Errorf("unknown schedule expression %q", expression)
+}
+
+// eventBridgeField turns the month or day of week field of an EventBridge cron expression into a
+// cron field. Names become numbers and every value is moved by offset.
+func eventBridgeField(field string, offset int) (string, error) {
+	if field == "?" || field == "*" {
+		return "*", nil
+	}
+	items := strings.Split(field, ",")
+	for i, item := range items {
+		step := ""
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			item, step = item[:slash], item[slash:]
+		}
+		bounds := strings.Split(item, "-")
+		for j, bound := range bounds {
+			if bound == "*" {
+				continue
+			}
+			value, ok := eventBridgeNames[strings.ToUpper(bound)]
+			if !ok {
+				var err error
+				if value, err = strconv.Atoi(bound); err != nil {
+					return "", fmt.Errorf("unsupported value %q", bound)
+				}
+			}
+			bounds[j] = strconv.Itoa(value + offset)
+		}
+		items[i] = strings.Join(bounds, "-") + step
+	}
+	return strings.Join(items, ","), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextInvocation(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2024, time.May, 15, 10, 20, 30, 0, time.UTC)
+	tests := map[string]struct {
+		expression string
+		expected   time.Time
+		err        bool
+	}{
+		"rate in minutes": {
+			expression: "rate(5 minutes)",
+			expected:   now.Add(5 * time.Minute),
+		},
+		"rate of one hour": {
+			expression: "rate(1 hour)",
+			expected:   now.Add(time.Hour),
+		},
+		"rate in days": {
+			expression: "rate(2 days)",
+			expected:   now.Add(48 * time.Hour),
+		},
+		"daily cron": {
+			expression: "cron(0 3 * * ? *)",
+			expected:   time.Date(2024, time.May, 16, 3, 0, 0, 0, time.UTC),
+		},
+		"hourly cron": {
+			expression: "cron(15 * * * ? *)",
+			expected:   time.Date(2024, time.May, 15, 11, 15, 0, 0, time.UTC),
+		},
+		"day of week names": {
+			expression: "cron(0 9 ? * MON-FRI *)",
+			expected:   time.Date(2024, time.May, 16, 9, 0, 0, 0, time.UTC),
+		},
+		"day of week numbers count from sunday": {
+			expression: "cron(0 9 ? * 1 *)",
+			expected:   time.Date(2024, time.May, 19, 9, 0, 0, 0, time.UTC),
+		},
+		"month names": {
+			expression: "cron(0 0 1 JAN,JUL ? *)",
+			expected:   time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"last day of the month": {
+			expression: "cron(0 0 L * ? *)",
+			err:        true,
+		},
+		"years": {
+			expression: "cron(0 0 1 1 ? 2030)",
+			err:        true,
+		},
+		"bad rate unit": {
+			expression: "rate(5 weeks)",
+			err:        true,
+		},
+		"no schedule": {
+			expression: "",
+			err:        true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := nextInvocation(test.expression, now)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// secretReference is a secret that the task definition needs ECS to resolve before the task can start.
+type secretReference struct {
+	container string
+	name      string
+	valueFrom string
+}
+
+// taskDefinitionSecrets collects every secret referenced by the task definition, including
+// log driver secret options and private registry credentials.
+func taskDefinitionSecrets(td *ecs.TaskDefinition) []secretReference {
+	secrets := []secretReference{}
+	for _, container := range td.ContainerDefinitions {
+		containerName := aws.StringValue(container.Name)
+		for _, secret := range container.Secrets {
+			secrets = append(secrets, secretReference{containerName, aws.StringValue(secret.Name), aws.StringValue(secret.ValueFrom)})
+		}
+		if container.LogConfiguration != nil {
+			for _, secret := range container.LogConfiguration.SecretOptions {
+				secrets = append(secrets, secretReference{containerName, aws.StringValue(secret.Name), aws.StringValue(secret.ValueFrom)})
+			}
+		}
+		if container.RepositoryCredentials != nil {
+			secrets = append(secrets, secretReference{containerName, "repositoryCredentials", aws.StringValue(container.RepositoryCredentials.CredentialsParameter)})
+		}
+	}
+	return secrets
+}
+
+// checkSecrets makes sure that the secrets referenced in the task definition exist and
+// that the execution role is allowed to read them. Missing secrets stop tasks from starting
+// and otherwise only show up in the stopped reason of the tasks.
+func (sh *serviceHandler) checkSecrets() error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+
+	secrets := taskDefinitionSecrets(td)
+	if len(secrets) == 0 {
+		sh.log.infof("Task definition has no secrets to check.")
+		return nil
+	}
+
+	executionRole := aws.StringValue(td.ExecutionRoleArn)
+	if executionRole == "" {
+		return fmt.Errorf("task definition %s uses secrets but has no execution role", aws.StringValue(td.TaskDefinitionArn))
+	}
+	roleArn, err := arn.Parse(executionRole)
+	if err != nil {
+		return fmt.Errorf("execution role %s is not a valid ARN. Error: %s", executionRole, err)
+	}
+
+	problems := []string{}
+	for _, secret := range secrets {
+		resourceArn, action, err := sh.checkSecretExists(secret.valueFrom, roleArn)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s secret %s (%s): %s", secret.container, secret.name, secret.valueFrom, err))
+			continue
+		}
+
+		allowed, err := sh.simulatePrincipalPolicy(executionRole, []string{action}, resourceArn)
+		if err != nil {
+			return err
+		}
+		if len(allowed) == 0 {
+			problems = append(problems, fmt.Sprintf("%s secret %s: execution role is not allowed to %s on %s", secret.container, secret.name, action, resourceArn))
+			continue
+		}
+		sh.log.debugf("Secret %s for container %s is readable by the execution role.", secret.name, secret.container)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("secrets can't be resolved:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkSecretExists looks up the secret in Secrets Manager or Parameter Store depending on the reference.
+// It returns the ARN to check permissions against and the action that the execution role needs on it.
+func (sh *serviceHandler) checkSecretExists(valueFrom string, roleArn arn.ARN) (string, string, error) {
+	if strings.HasPrefix(valueFrom, "arn:") {
+		secretArn, err := arn.Parse(valueFrom)
+		if err != nil {
+			return "", "", err
+		}
+
+		if secretArn.Service == "secretsmanager" {
+			// ECS allows a JSON key, version stage and version ID to follow the secret ARN.
+			// The secret ARN itself is the first 7 colon separated fields.
+			secretId := strings.Join(strings.SplitN(valueFrom, ":", 8)[:7], ":")
+			_, err := sh.secretsManagerClient(secretArn.Region).DescribeSecretWithContext(sh.ctx, &secretsmanager.DescribeSecretInput{
+				SecretId: aws.String(secretId),
+			})
+			return secretId, "secretsmanager:GetSecretValue", err
+		}
+
+		if secretArn.Service == "ssm" {
+			// Hierarchical parameter names keep their leading slash, simple names don't have one.
+			name := strings.TrimPrefix(secretArn.Resource, "parameter/")
+			if strings.Contains(name, "/") {
+				name = "/" + name
+			}
+			return valueFrom, "ssm:GetParameters", sh.checkParameterExists(sh.ssmClient(secretArn.Region), name)
+		}
+
+		return "", "", fmt.Errorf("unsupported secret service %s", secretArn.Service)
+	}
+
+	// A plain name is an SSM parameter in the same account and region as the task.
+	name := valueFrom
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	parameterArn := arn.ARN{
+		Partition: roleArn.Partition,
+		Service:   "ssm",
+		Region:    aws.StringValue(sh.session.Config.Region),
+		AccountID: roleArn.AccountID,
+		Resource:  "parameter" + name,
+	}
+	return parameterArn.String(), "ssm:GetParameters", sh.checkParameterExists(sh.ssmSession, valueFrom)
+}
+
+func (sh *serviceHandler) checkParameterExists(client *ssm.SSM, name string) error {
+	output, err := client.DescribeParametersWithContext(sh.ctx, &ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Name"),
+				Option: aws.String("Equals"),
+				Values: []*string{aws.String(name)},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Parameters) == 0 {
+		return fmt.Errorf("parameter not found")
+	}
+	return nil
+}
+
+// secretsManagerClient returns a Secrets Manager client for the region of a secret ARN. Secrets can
+// be shared from other regions, where the client of the service can't find them.
+func (sh *serviceHandler) secretsManagerClient(region string) *secretsmanager.SecretsManager {
+	if region == "" || region == aws.StringValue(sh.awsSession.Config.Region) {
+		return sh.secretsManagerSession
+	}
+	return secretsmanager.New(sh.awsSession, aws.NewConfig().WithRegion(region))
+}
+
+// ssmClient returns a Parameter Store client for the region of a parameter ARN, see secretsManagerClient.
+func (sh *serviceHandler) ssmClient(region string) *ssm.SSM {
+	if region == "" || region == aws.StringValue(sh.awsSession.Config.Region) {
+		return sh.ssmSession
+	}
+	return ssm.New(sh.awsSession, aws.NewConfig().WithRegion(region))
+}
+
+// simulatePrincipalPolicy asks IAM which of the actions the principal is allowed to perform
+// on the resource. Only the allowed actions are returned.
+func (sh *serviceHandler) simulatePrincipalPolicy(principalArn string, actions []string, resourceArn string) ([]string, error) {
+	allowed := []string{}
+	err := sh.iamSession.SimulatePrincipalPolicyPagesWithContext(sh.ctx,
+		&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principalArn),
+			ActionNames:     aws.StringSlice(actions),
+			ResourceArns:    []*string{aws.String(resourceArn)},
+		},
+		func(page *iam.SimulatePolicyResponse, lastPage bool) bool {
+			for _, result := range page.EvaluationResults {
+				if aws.StringValue(result.EvalDecision) == iam.PolicyEvaluationDecisionTypeAllowed {
+					allowed = append(allowed, aws.StringValue(result.EvalActionName))
+				}
+			}
+			return true
+		},
+	)
+	return allowed, err
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// checkSecurityGroupReachability makes sure that the task security groups allow the load balancer
+// to reach the tasks on the health check port. If they don't, health checks can never succeed
+// and we would only find out after the timeout.
+func (sh *serviceHandler) checkSecurityGroupReachability() error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+
+	if len(sh.currentOutput.LoadBalancers) == 0 {
+		sh.log.infof("No load balancer to check security groups against.")
+		return nil
+	}
+
+	if sh.currentOutput.NetworkConfiguration == nil || sh.currentOutput.NetworkConfiguration.AwsvpcConfiguration == nil {
+		sh.log.infof("Service does not use awsvpc networking, security groups are on the container instances and are not checked.")
+		return nil
+	}
+	taskGroupIds := sh.currentOutput.NetworkConfiguration.AwsvpcConfiguration.SecurityGroups
+	if len(taskGroupIds) == 0 {
+		return fmt.Errorf("service has no security groups in its network configuration")
+	}
+
+	taskGroups, err := sh.ec2Session.DescribeSecurityGroupsWithContext(sh.ctx, &ec2.DescribeSecurityGroupsInput{
+		GroupIds: taskGroupIds,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, lb := range sh.currentOutput.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+		tg, err := sh.describeTargetGroup(aws.StringValue(lb.TargetGroupArn))
+		if err != nil {
+			return err
+		}
+
+		port := aws.Int64Value(lb.ContainerPort)
+		if hcPort := aws.StringValue(tg.HealthCheckPort); hcPort != "" && hcPort != "traffic-port" {
+			port, err = strconv.ParseInt(hcPort, 10, 64)
+			if err != nil {
+				return fmt.Errorf("health check port %q on target group %s is not a valid port", hcPort, aws.StringValue(tg.TargetGroupName))
+			}
+		}
+
+		lbOutput, err := sh.elbv2Session.DescribeLoadBalancersWithContext(sh.ctx, &elbv2.DescribeLoadBalancersInput{
+			LoadBalancerArns: tg.LoadBalancerArns,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Load balancers reach IPv6 target groups over IPv6 and the others over IPv4.
+		ipv6 := aws.StringValue(tg.IpAddressType) == elbv2.TargetGroupIpAddressTypeEnumIpv6
+		for _, loadBalancer := range lbOutput.LoadBalancers {
+			subnetCidrs, err := sh.loadBalancerSubnetCidrs(loadBalancer, ipv6)
+			if err != nil {
+				return err
+			}
+			if len(loadBalancer.SecurityGroups) == 0 {
+				sh.log.debugf("Load balancer %s has no security groups, only checking its subnet ranges.", aws.StringValue(loadBalancer.LoadBalancerName))
+			}
+
+			allowed, prefixLists := ingressAllowed(taskGroups.SecurityGroups, port, aws.StringValueSlice(loadBalancer.SecurityGroups), subnetCidrs)
+			if !allowed && len(prefixLists) > 0 {
+				sh.log.warnf(
+					"Security groups %v allow port %d from prefix lists %v. Prefix lists are not checked, so it is not known if load balancer %s can reach the tasks.",
+					aws.StringValueSlice(taskGroupIds),
+					port,
+					prefixLists,
+					aws.StringValue(loadBalancer.LoadBalancerName),
+				)
+				continue
+			}
+			if !allowed {
+				return fmt.Errorf(
+					"security groups %v do not allow load balancer %s to reach port %d, health checks can never succeed",
+					aws.StringValueSlice(taskGroupIds),
+					aws.StringValue(loadBalancer.LoadBalancerName),
+					port,
+				)
+			}
+			sh.log.debugf("Load balancer %s can reach the tasks on port %d.", aws.StringValue(loadBalancer.LoadBalancerName), port)
+		}
+	}
+
+	return nil
+}
+
+// loadBalancerSubnetCidrs returns the IPv4 ranges of the subnets of the load balancer, or the IPv6
+// ones when ipv6 is set.
+func (sh *serviceHandler) loadBalancerSubnetCidrs(lb *elbv2.LoadBalancer, ipv6 bool) ([]*net.IPNet, error) {
+	subnetIds := []*string{}
+	for _, az := range lb.AvailabilityZones {
+		subnetIds = append(subnetIds, az.SubnetId)
+	}
+	if len(subnetIds) == 0 {
+		return nil, nil
+	}
+
+	output, err := sh.ec2Session.DescribeSubnetsWithContext(sh.ctx, &ec2.DescribeSubnetsInput{SubnetIds: subnetIds})
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []string{}
+	for _, subnet := range output.Subnets {
+		if !ipv6 {
+			blocks = append(blocks, aws.StringValue(subnet.CidrBlock))
+			continue
+		}
+		for _, association := range subnet.Ipv6CidrBlockAssociationSet {
+			blocks = append(blocks, aws.StringValue(association.Ipv6CidrBlock))
+		}
+	}
+
+	cidrs := []*net.IPNet{}
+	for _, block := range blocks {
+		_, cidr, err := net.ParseCIDR(block)
+		if err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// ingressAllowed reports if any of the security groups lets traffic in on the port, either
+// from one of the source security groups or from IPv4 or IPv6 ranges covering every source subnet.
+// Prefix lists are not looked into. When they are all that could let the traffic in, they are
+// returned so the caller can say so instead of reporting it as not allowed.
+func ingressAllowed(groups []*ec2.SecurityGroup, port int64, sourceGroupIds []string, sourceCidrs []*net.IPNet) (bool, []string) {
+	sources := map[string]bool{}
+	for _, id := range sourceGroupIds {
+		sources[id] = true
+	}
+	covered := make([]bool, len(sourceCidrs))
+	prefixLists := []string{}
+
+	for _, group := range groups {
+		for _, permission := range group.IpPermissions {
+			if !permissionCoversPort(permission, port) {
+				continue
+			}
+			for _, pair := range permission.UserIdGroupPairs {
+				if sources[aws.StringValue(pair.GroupId)] {
+					return true, nil
+				}
+			}
+			ranges := []string{}
+			for _, ipRange := range permission.IpRanges {
+				ranges = append(ranges, aws.StringValue(ipRange.CidrIp))
+			}
+			for _, ipRange := range permission.Ipv6Ranges {
+				ranges = append(ranges, aws.StringValue(ipRange.CidrIpv6))
+			}
+			for _, ipRange := range ranges {
+				_, allowed, err := net.ParseCIDR(ipRange)
+				if err != nil {
+					continue
+				}
+				for i, cidr := range sourceCidrs {
+					if cidrContains(allowed, cidr) {
+						covered[i] = true
+					}
+				}
+			}
+			for _, prefixList := range permission.PrefixListIds {
+				prefixLists = append(prefixLists, aws.StringValue(prefixList.PrefixListId))
+			}
+		}
+	}
+
+	if len(sourceCidrs) == 0 {
+		return false, prefixLists
+	}
+	for _, ok := range covered {
+		if !ok {
+			return false, prefixLists
+		}
+	}
+	return true, nil
+}
+
+func permissionCoversPort(permission *ec2.IpPermission, port int64) bool {
+	switch aws.StringValue(permission.IpProtocol) {
+	case "-1":
+		return true
+	case "tcp", "6":
+		return aws.Int64Value(permission.FromPort) <= port && port <= aws.Int64Value(permission.ToPort)
+	}
+	return false
+}
+
+// cidrContains reports if the inner network is entirely within the outer network. Networks of
+// different IP versions never contain each other.
+func cidrContains(outer, inner *net.IPNet) bool {
+	outerSize, outerBits := outer.Mask.Size()
+	innerSize, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerSize <= innerSize && outer.Contains(inner.IP)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func mustParseCidr(t *testing.T, block string) *net.IPNet {
+	t.Helper()
+	_, cidr, err := net.ParseCIDR(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cidr
+}
+
+func TestCidrContains(t *testing.T) {
+	tests := map[string]struct {
+		outer    string
+		inner    string
+		expected bool
+	}{
+		"same network":          {outer: "10.0.0.0/24", inner: "10.0.0.0/24", expected: true},
+		"subnet of the range":   {outer: "10.0.0.0/16", inner: "10.0.3.0/24", expected: true},
+		"everything":            {outer: "0.0.0.0/0", inner: "192.168.1.0/24", expected: true},
+		"wider than the range":  {outer: "10.0.3.0/24", inner: "10.0.0.0/16", expected: false},
+		"overlapping":           {outer: "10.0.0.0/25", inner: "10.0.0.0/24", expected: false},
+		"other network":         {outer: "10.1.0.0/16", inner: "10.0.3.0/24", expected: false},
+		"ipv6 subnet":           {outer: "2001:db8::/32", inner: "2001:db8:1::/64", expected: true},
+		"ipv6 everything":       {outer: "::/0", inner: "2001:db8:1::/64", expected: true},
+		"ipv6 other network":    {outer: "2001:db8::/48", inner: "2001:db8:1::/64", expected: false},
+		"ipv6 wider":            {outer: "2001:db8:1::/64", inner: "2001:db8::/32", expected: false},
+		"ipv4 range ipv6 inner": {outer: "0.0.0.0/0", inner: "2001:db8::/64", expected: false},
+		"ipv6 range ipv4 inner": {outer: "::/0", inner: "10.0.0.0/24", expected: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := cidrContains(mustParseCidr(t, test.outer), mustParseCidr(t, test.inner)); got != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressAllowed(t *testing.T) {
+	tcp := func(from, to int64) *ec2.IpPermission {
+		return &ec2.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(from), ToPort: aws.Int64(to)}
+	}
+	withCidrs := func(permission *ec2.IpPermission, blocks ...string) *ec2.IpPermission {
+		for _, block := range blocks {
+			if _, cidr, err := net.ParseCIDR(block); err == nil && cidr.IP.To4() == nil {
+				permission.Ipv6Ranges = append(permission.Ipv6Ranges, &ec2.Ipv6Range{CidrIpv6: aws.String(block)})
+			} else {
+				permission.IpRanges = append(permission.IpRanges, &ec2.IpRange{CidrIp: aws.String(block)})
+			}
+		}
+		return permission
+	}
+	withGroups := func(permission *ec2.IpPermission, ids ...string) *ec2.IpPermission {
+		for _, id := range ids {
+			permission.UserIdGroupPairs = append(permission.UserIdGroupPairs, &ec2.UserIdGroupPair{GroupId: aws.String(id)})
+		}
+		return permission
+	}
+	withPrefixLists := func(permission *ec2.IpPermission, ids ...string) *ec2.IpPermission {
+		for _, id := range ids {
+			permission.PrefixListIds = append(permission.PrefixListIds, &ec2.PrefixListId{PrefixListId: aws.String(id)})
+		}
+		return permission
+	}
+	group := func(permissions ...*ec2.IpPermission) *ec2.SecurityGroup {
+		return &ec2.SecurityGroup{IpPermissions: permissions}
+	}
+
+	tests := map[string]struct {
+		groups       []*ec2.SecurityGroup
+		port         int64
+		sourceGroups []string
+		sourceCidrs  []string
+		expected     bool
+		prefixLists  []string
+	}{
+		"source group": {
+			groups:       []*ec2.SecurityGroup{group(withGroups(tcp(8080, 8080), "sg-lb"))},
+			port:         8080,
+			sourceGroups: []string{"sg-lb"},
+			expected:     true,
+		},
+		"other source group": {
+			groups:       []*ec2.SecurityGroup{group(withGroups(tcp(8080, 8080), "sg-other"))},
+			port:         8080,
+			sourceGroups: []string{"sg-lb"},
+			expected:     false,
+			prefixLists:  []string{},
+		},
+		"source group on another port": {
+			groups:       []*ec2.SecurityGroup{group(withGroups(tcp(80, 80), "sg-lb"))},
+			port:         8080,
+			sourceGroups: []string{"sg-lb"},
+			expected:     false,
+			prefixLists:  []string{},
+		},
+		"port range": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8000, 8999), "10.0.0.0/16"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    true,
+		},
+		"port range edges": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8080, 8090), "10.0.0.0/16"))},
+			port:        8090,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    true,
+		},
+		"port outside of the range": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8000, 8079), "10.0.0.0/16"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    false,
+			prefixLists: []string{},
+		},
+		"all traffic": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(&ec2.IpPermission{IpProtocol: aws.String("-1")}, "10.0.0.0/8"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    true,
+		},
+		"udp only": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(&ec2.IpPermission{IpProtocol: aws.String("udp"), FromPort: aws.Int64(0), ToPort: aws.Int64(65535)}, "0.0.0.0/0"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    false,
+			prefixLists: []string{},
+		},
+		"every subnet covered by different rules": {
+			groups: []*ec2.SecurityGroup{
+				group(withCidrs(tcp(8080, 8080), "10.0.1.0/24")),
+				group(withCidrs(tcp(8080, 8080), "10.0.2.0/24")),
+			},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			expected:    true,
+		},
+		"one subnet not covered": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8080, 8080), "10.0.1.0/24"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			expected:    false,
+			prefixLists: []string{},
+		},
+		"ipv6 range": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8080, 8080), "2001:db8::/56"))},
+			port:        8080,
+			sourceCidrs: []string{"2001:db8:0:1::/64", "2001:db8:0:2::/64"},
+			expected:    true,
+		},
+		"ipv4 range for ipv6 subnets": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8080, 8080), "0.0.0.0/0"))},
+			port:        8080,
+			sourceCidrs: []string{"2001:db8:0:1::/64"},
+			expected:    false,
+			prefixLists: []string{},
+		},
+		"prefix list": {
+			groups:      []*ec2.SecurityGroup{group(withPrefixLists(tcp(8080, 8080), "pl-123"))},
+			port:        8080,
+			sourceCidrs: []string{"10.0.1.0/24"},
+			expected:    false,
+			prefixLists: []string{"pl-123"},
+		},
+		"no sources": {
+			groups:      []*ec2.SecurityGroup{group(withCidrs(tcp(8080, 8080), "0.0.0.0/0"))},
+			port:        8080,
+			expected:    false,
+			prefixLists: []string{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cidrs := []*net.IPNet{}
+			for _, block := range test.sourceCidrs {
+				cidrs = append(cidrs, mustParseCidr(t, block))
+			}
+			allowed, prefixLists := ingressAllowed(test.groups, test.port, test.sourceGroups, cidrs)
+			if allowed != test.expected {
+				t.Errorf("expected allowed %t, got %t", test.expected, allowed)
+			}
+			if !reflect.DeepEqual(prefixLists, test.prefixLists) {
+				t.Errorf("expected prefix lists %v, got %v", test.prefixLists, prefixLists)
+			}
+		})
+	}
+}
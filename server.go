@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// server is the HTTP server that runs alongside the wait when -listen is set.
+// Each service that is being waited for is a watch.
+type server struct {
+	apiKey string
+	mux    *http.ServeMux
+	// watchScope, when it is set, answers which watches a request may see, nil when it is not
+	// allowed to see any. The daemon sets it so tenants only see the watches they registered.
+	watchScope func(r *http.Request) func(id string) bool
+
+	lock           sync.Mutex
+	watches        map[string]*serviceHandler
+	ready          bool
+	notReadyReason string
+}
+
+// ecsStateChangeEvent is the part of an ECS EventBridge event that we need to find the watch it belongs to.
+type ecsStateChangeEvent struct {
+	DetailType string   `json:"detail-type"`
+	Source     string   `json:"source"`
+	Resources  []string `json:"resources"`
+	Detail     struct {
+		ClusterArn string `json:"clusterArn"`
+		Group      string `json:"group"`
+	} `json:"detail"`
+}
+
+func newServer(apiKey string) *server {
+	srv := &server{
+		apiKey:  apiKey,
+		mux:     http.NewServeMux(),
+		watches: map[string]*serviceHandler{},
+	}
+	srv.mux.HandleFunc("/events", srv.authorized(srv.handleEvent))
+	srv.mux.HandleFunc("/watches/", srv.scoped(srv.handleWatch))
+	srv.mux.HandleFunc("/metrics", srv.scoped(srv.handleMetrics))
+	srv.mux.HandleFunc("/healthz", srv.handleHealthz)
+	srv.mux.HandleFunc("/readyz", srv.handleReadyz)
+	return srv
+}
+
+// addWatch makes a service that we are waiting for known to the server.
+func (srv *server) addWatch(id string, sh *serviceHandler) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.watches[id] = sh
+}
+
+// removeWatch forgets a service that we no longer wait for.
+func (srv *server) removeWatch(id string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	delete(srv.watches, id)
+}
+
+// start serves HTTP in the background. The wait carries on if the server fails.
+func (srv *server) start(addr string) {
+	go func() {
+		logger.infof("Listening on %s.", addr)
+		if err := http.ListenAndServe(addr, srv.mux); err != nil {
+			logger.errorf("The HTTP server stopped. Error: %s", err)
+		}
+	}()
+}
+
+// hasApiKey is true when the request sends the -listen-api-key, or when there is none.
+func (srv *server) hasApiKey(r *http.Request) bool {
+	return srv.apiKey == "" || r.Header.Get("X-Api-Key") == srv.apiKey
+}
+
+// authorized rejects requests without the -listen-api-key, when one is set.
+func (srv *server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !srv.hasApiKey(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// scoped passes the handler which watches the request may see. Without a watchScope that is every
+// watch for requests with the -listen-api-key. Requests that may see none are rejected.
+func (srv *server) scoped(handler func(http.ResponseWriter, *http.Request, func(id string) bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var visible func(id string) bool
+		if srv.watchScope != nil {
+			visible = srv.watchScope(r)
+		} else if srv.hasApiKey(r) {
+			visible = func(id string) bool { return true }
+		}
+		if visible == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r, visible)
+	}
+}
+
+// visibleWatches returns the watches the request may see, sorted by their ID.
+func (srv *server) visibleWatches(visible func(id string) bool) ([]string, map[string]*serviceHandler) {
+	srv.lock.Lock()
+	all := map[string]*serviceHandler{}
+	for id, sh := range srv.watches {
+		all[id] = sh
+	}
+	srv.lock.Unlock()
+
+	// The scope can take locks of its own, so it is asked without holding ours.
+	ids := []string{}
+	watches := map[string]*serviceHandler{}
+	for id, sh := range all {
+		if visible(id) {
+			ids = append(ids, id)
+			watches[id] = sh
+		}
+	}
+	sort.Strings(ids)
+	return ids, watches
+}
+
+// handleEvent receives ECS state change events from an EventBridge API destination and checks
+// the service they are for straight away instead of waiting for the next check interval.
+func (srv *server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	event := ecsStateChangeEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, fmt.Sprintf("bad event: %s", err), http.StatusBadRequest)
+		return
+	}
+	if event.Source != "aws.ecs" {
+		http.Error(w, "only aws.ecs events are accepted", http.StatusBadRequest)
+		return
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	for _, sh := range srv.watches {
+		if sh.matchesEvent(event) {
+			sh.log.debugf("Received %s for %s.", event.DetailType, aws.StringValue(sh.serviceName))
+			sh.wakeUp()
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// matchesEvent is true when the event is about the service. Deployment and service action events
+// have the service ARN in the resources and task events have the service in the group.
+func (sh *serviceHandler) matchesEvent(event ecsStateChangeEvent) bool {
+	cluster := aws.StringValue(sh.clusterName)
+	service := aws.StringValue(sh.serviceName)
+	for _, resource := range event.Resources {
+		if strings.HasSuffix(resource, fmt.Sprintf(":service/%s/%s", cluster, service)) || strings.HasSuffix(resource, ":service/"+service) {
+			return true
+		}
+	}
+	clusterArn := event.Detail.ClusterArn
+	return event.Detail.Group == "service:"+service && clusterArn[strings.LastIndex(clusterArn, "/")+1:] == cluster
+}
+
+// wakeUp makes the wait check the service now. It never blocks, one pending wake up is enough.
+func (sh *serviceHandler) wakeUp() {
+	select {
+	case sh.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+)
+
+// serviceDnsName works out the private DNS name of the service from its Cloud Map registry.
+func (sh *serviceHandler) serviceDnsName() (string, error) {
+	if len(sh.currentOutput.ServiceRegistries) == 0 {
+		return "", fmt.Errorf("service has no service discovery registries")
+	}
+
+	registryArn := aws.StringValue(sh.currentOutput.ServiceRegistries[0].RegistryArn)
+	parts := strings.SplitN(registryArn, "service/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("unexpected service registry ARN %s", registryArn)
+	}
+
+	serviceOutput, err := sh.serviceDiscoverySession.GetServiceWithContext(sh.ctx, &servicediscovery.GetServiceInput{
+		Id: aws.String(parts[1]),
+	})
+	if err != nil {
+		return "", err
+	}
+	namespaceOutput, err := sh.serviceDiscoverySession.GetNamespaceWithContext(sh.ctx, &servicediscovery.GetNamespaceInput{
+		Id: serviceOutput.Service.NamespaceId,
+	})
+	if err != nil {
+		return "", err
+	}
+	if aws.StringValue(namespaceOutput.Namespace.Type) == servicediscovery.NamespaceTypeHttp {
+		return "", fmt.Errorf("namespace %s is HTTP only and can't be resolved with DNS", aws.StringValue(namespaceOutput.Namespace.Name))
+	}
+
+	return aws.StringValue(serviceOutput.Service.Name) + "." + aws.StringValue(namespaceOutput.Namespace.Name), nil
+}
+
+// waitForDnsToMatchTasks resolves the DNS name until it returns exactly the private IPs of the
+// RUNNING tasks in the PRIMARY deployment. Missing new IPs or left over old IPs mean DNS is stale.
+func (sh *serviceHandler) waitForDnsToMatchTasks(dnsName string) error {
+	var progress progressLine
+	isComplete := func() (bool, error) {
+		if err := sh.refresh(); err != nil {
+			return false, err
+		}
+		deployment := sh.primaryDeployment()
+		if deployment == nil {
+			return false, fmt.Errorf("no PRIMARY deployment found")
+		}
+		tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+		if err != nil {
+			return false, err
+		}
+		endpoints, err := sh.taskEndpoints(tasks)
+		if err != nil {
+			return false, err
+		}
+		expected := []string{}
+		for _, endpoint := range endpoints {
+			expected = append(expected, endpoint.privateIp)
+		}
+
+		resolved, err := resolveServiceAddresses(sh.ctx, dnsName)
+		if err != nil {
+			sh.log.errorf("Failed to resolve %s. Error: %s", dnsName, err)
+			return false, nil
+		}
+
+		sort.Strings(expected)
+		sort.Strings(resolved)
+		if sameStringSet(expected, resolved) {
+			sh.log.infof("%s resolves to the new tasks %v.", dnsName, resolved)
+			return true, nil
+		}
+		progress.logf(sh.log, fmt.Sprint(resolved, expected), "%s resolves to %v, the new tasks are %v.", dnsName, resolved, expected)
+		return false, nil
+	}
+
+	if ok, err := isComplete(); err != nil || ok {
+		return err
+	}
+
+	checkTimer := time.NewTicker(time.Second * time.Duration(sh.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(sh.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-checkTimer.C:
+			ok, err := isComplete()
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+			sh.log.progressf("Waiting another %d seconds for DNS to catch up.", sh.checkInterval)
+		case <-sh.ctx.Done():
+			return sh.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for %s to resolve to the new tasks", dnsName)
+		}
+	}
+}
+
+// resolveServiceAddresses looks up the A/AAAA records of the name. Services registered
+// with only SRV records are resolved through their targets.
+func resolveServiceAddresses(ctx context.Context, name string) ([]string, error) {
+	addresses, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err == nil {
+		return addresses, nil
+	}
+
+	_, srvRecords, srvErr := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if srvErr != nil {
+		return nil, err
+	}
+	addresses = []string{}
+	for _, srv := range srvRecords {
+		targetAddresses, err := net.DefaultResolver.LookupHost(ctx, srv.Target)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, targetAddresses...)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// trafficShifter moves a percentage of the traffic of a listener or listener rule to the green
+// target group of a blue/green deployment, checking the green targets stay healthy afterwards.
+type trafficShifter struct {
+	ctx            context.Context
+	session        *elbv2.ELBV2
+	listenerArn    string
+	ruleArn        string
+	greenArn       string
+	checkInterval  int
+	verifyDuration time.Duration
+}
+
+// currentActions returns the actions of the rule, or the default actions of the listener.
+func (ts *trafficShifter) currentActions() ([]*elbv2.Action, error) {
+	if ts.ruleArn != "" {
+		output, err := ts.session.DescribeRulesWithContext(ts.ctx, &elbv2.DescribeRulesInput{RuleArns: []*string{aws.String(ts.ruleArn)}})
+		if err != nil {
+			return nil, err
+		}
+		if len(output.Rules) == 0 {
+			return nil, fmt.Errorf("rule %s not found", ts.ruleArn)
+		}
+		return output.Rules[0].Actions, nil
+	}
+	output, err := ts.session.DescribeListenersWithContext(ts.ctx, &elbv2.DescribeListenersInput{ListenerArns: []*string{aws.String(ts.listenerArn)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Listeners) == 0 {
+		return nil, fmt.Errorf("listener %s not found", ts.listenerArn)
+	}
+	return output.Listeners[0].DefaultActions, nil
+}
+
+func (ts *trafficShifter) applyActions(ctx context.Context, actions []*elbv2.Action) error {
+	if ts.ruleArn != "" {
+		_, err := ts.session.ModifyRuleWithContext(ctx, &elbv2.ModifyRuleInput{RuleArn: aws.String(ts.ruleArn), Actions: actions})
+		return err
+	}
+	_, err := ts.session.ModifyListenerWithContext(ctx, &elbv2.ModifyListenerInput{ListenerArn: aws.String(ts.listenerArn), DefaultActions: actions})
+	return err
+}
+
+// shiftedActions copies the actions with the forward action sending percent of the traffic to the
+// green target group and the rest to the blue one. The forward action must have two target groups,
+// or one that is not the green one.
+func (ts *trafficShifter) shiftedActions(actions []*elbv2.Action, percent int64) ([]*elbv2.Action, error) {
+	shifted := []*elbv2.Action{}
+	found := false
+	for _, action := range actions {
+		if aws.StringValue(action.Type) != elbv2.ActionTypeEnumForward {
+			shifted = append(shifted, action)
+			continue
+		}
+		found = true
+
+		forward := &elbv2.ForwardActionConfig{}
+		if action.ForwardConfig != nil {
+			forward.TargetGroupStickinessConfig = action.ForwardConfig.TargetGroupStickinessConfig
+			for _, tg := range action.ForwardConfig.TargetGroups {
+				forward.TargetGroups = append(forward.TargetGroups, &elbv2.TargetGroupTuple{TargetGroupArn: tg.TargetGroupArn})
+			}
+		} else {
+			forward.TargetGroups = []*elbv2.TargetGroupTuple{{TargetGroupArn: action.TargetGroupArn}}
+		}
+
+		blueArn := ""
+		for _, tg := range forward.TargetGroups {
+			if aws.StringValue(tg.TargetGroupArn) != ts.greenArn {
+				if blueArn != "" {
+					return nil, fmt.Errorf("the forward action has more than one target group other than %s", ts.greenArn)
+				}
+				blueArn = aws.StringValue(tg.TargetGroupArn)
+			}
+		}
+		if blueArn == "" {
+			return nil, fmt.Errorf("the forward action has no blue target group next to %s", ts.greenArn)
+		}
+		forward.TargetGroups = []*elbv2.TargetGroupTuple{
+			{TargetGroupArn: aws.String(blueArn), Weight: aws.Int64(100 - percent)},
+			{TargetGroupArn: aws.String(ts.greenArn), Weight: aws.Int64(percent)},
+		}
+		shifted = append(shifted, &elbv2.Action{
+			Type:          action.Type,
+			Order:         action.Order,
+			ForwardConfig: forward,
+		})
+	}
+	if !found {
+		return nil, fmt.Errorf("no forward action found")
+	}
+	return shifted, nil
+}
+
+// greenHealthy is true when the green target group has targets and all of them are healthy.
+func (ts *trafficShifter) greenHealthy() (bool, error) {
+	output, err := ts.session.DescribeTargetHealthWithContext(ts.ctx, &elbv2.DescribeTargetHealthInput{TargetGroupArn: aws.String(ts.greenArn)})
+	if err != nil {
+		return false, err
+	}
+	if len(output.TargetHealthDescriptions) == 0 {
+		logger.infof("The green target group has no targets.")
+		return false, nil
+	}
+	healthy := true
+	for _, target := range output.TargetHealthDescriptions {
+		if aws.StringValue(target.TargetHealth.State) != elbv2.TargetHealthStateEnumHealthy {
+			logger.infof("Green target %s is %s. Reason: %s", aws.StringValue(target.Target.Id), colorState(aws.StringValue(target.TargetHealth.State)), aws.StringValue(target.TargetHealth.Reason))
+			healthy = false
+		}
+	}
+	return healthy, nil
+}
+
+// shift moves the traffic and watches the green targets for the verify duration.
+// The previous weights are put back if the green targets become unhealthy.
+func (ts *trafficShifter) shift(percent int64) error {
+	healthy, err := ts.greenHealthy()
+	if err != nil {
+		return err
+	}
+	if !healthy && percent > 0 {
+		return fmt.Errorf("the green targets are not healthy, not shifting traffic to them")
+	}
+
+	previous, err := ts.currentActions()
+	if err != nil {
+		return err
+	}
+	shifted, err := ts.shiftedActions(previous, percent)
+	if err != nil {
+		return err
+	}
+	if err := ts.applyActions(ts.ctx, shifted); err != nil {
+		return err
+	}
+	logger.infof("Shifted %d%% of the traffic to %s, checking it stays healthy for %s.", percent, ts.greenArn, ts.verifyDuration)
+
+	deadline := time.Now().Add(ts.verifyDuration)
+	for time.Now().Before(deadline) {
+		err := sleepContext(ts.ctx, time.Second*time.Duration(ts.checkInterval))
+		if err == nil {
+			var healthy bool
+			healthy, err = ts.greenHealthy()
+			if err == nil && !healthy {
+				err = fmt.Errorf("the green targets became unhealthy")
+			}
+		}
+		if err != nil {
+			logger.infof("Putting the previous traffic weights back.")
+			// The weights are put back even when the shift was interrupted.
+			restoreCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+			restoreErr := ts.applyActions(restoreCtx, previous)
+			cancel()
+			if restoreErr != nil {
+				return fmt.Errorf("%s and restoring the previous weights failed. Error: %s", err, restoreErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runShift is the shift subcommand, like: shift -listener arn -target-group green-arn 10
+func runShift(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("shift", flag.ExitOnError)
+	listenerArn := flags.String("listener", "", "Listener whose default action forwards to the blue and green target groups")
+	ruleArn := flags.String("rule", "", "Listener rule that forwards to the blue and green target groups. Use instead of -listener")
+	greenArn := flags.String("target-group", "", "Green target group to shift the traffic to")
+	checkInterval := flags.Int("check", 10, "Seconds between health checks")
+	verify := flags.Duration("verify", time.Minute, "How long the green targets must stay healthy after the shift")
+	debugAws := flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID")
+	region := flags.String("region", "", regionUsage)
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+
+	if flags.NArg() != 1 || (*listenerArn == "") == (*ruleArn == "") || *greenArn == "" {
+		logger.errorf("Usage: shift -listener arn|-rule arn -target-group green-arn PERCENT")
+		os.Exit(1)
+	}
+	percent, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		logger.errorf("Bad percentage %q, use a number from 0 to 100.", flags.Arg(0))
+		os.Exit(1)
+	}
+
+	awsSession, err := newAwsSession(*region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *debugAws {
+		debugAwsRequests(awsSession)
+	}
+	shifter := &trafficShifter{
+		ctx:            ctx,
+		session:        elbv2.New(awsSession),
+		listenerArn:    *listenerArn,
+		ruleArn:        *ruleArn,
+		greenArn:       *greenArn,
+		checkInterval:  *checkInterval,
+		verifyDuration: *verify,
+	}
+	if err := shifter.shift(percent); err != nil {
+		logger.errorf("The traffic shift failed. Error: %s", err)
+		os.Exit(1)
+	}
+	logger.infof("%d%% of the traffic is on the green target group and it looks good.", percent)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// scaleInStopReason starts the stopped reason of tasks that ECS stopped because the desired count
+// went down, like when autoscaling scales in.
+const scaleInStopReason = "Scaling activity initiated by"
+
+// soak keeps watching the service for the period after all the checks have passed.
+// It fails if the running count drops, targets become unhealthy or tasks of the PRIMARY
+// deployment stop. This catches services that are healthy for a short time and then crash.
+// Targets of tasks in their health check grace period and tasks stopped by a scale in are
+// expected while autoscaling moves the desired count, they don't fail the soak.
+func (sh *serviceHandler) soak(period time.Duration) error {
+	if err := sh.refresh(); err != nil {
+		return err
+	}
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+	deploymentId := aws.StringValue(deployment.Id)
+
+	stoppedBefore, err := sh.deploymentTasks(deploymentId, ecs.DesiredStatusStopped)
+	if err != nil {
+		return err
+	}
+	knownStopped := map[string]bool{}
+	for _, task := range stoppedBefore {
+		knownStopped[aws.StringValue(task.TaskArn)] = true
+	}
+
+	checkTimer := time.NewTicker(time.Second * time.Duration(sh.checkInterval))
+	soakTimer := time.NewTimer(period)
+	defer checkTimer.Stop()
+	defer soakTimer.Stop()
+
+	for {
+		select {
+		case <-checkTimer.C:
+			if err := sh.refresh(); err != nil {
+				return err
+			}
+			desired := aws.Int64Value(sh.currentOutput.DesiredCount)
+			running := aws.Int64Value(sh.currentOutput.RunningCount)
+			if running < desired {
+				return fmt.Errorf("running count dropped to %d, desired is %d", running, desired)
+			}
+
+			ok, err := sh.checkTargetGroup()
+			if err != nil {
+				return err
+			}
+			if !ok && sh.unhealthyTargets > 0 {
+				return fmt.Errorf("targets became unhealthy")
+			}
+			if !ok {
+				sh.log.debugf("%d targets are in their health check grace period.", sh.targetsInGrace)
+			}
+
+			stopped, err := sh.deploymentTasks(deploymentId, ecs.DesiredStatusStopped)
+			if err != nil {
+				return err
+			}
+			for _, task := range stopped {
+				if knownStopped[aws.StringValue(task.TaskArn)] {
+					continue
+				}
+				if strings.HasPrefix(aws.StringValue(task.StoppedReason), scaleInStopReason) {
+					sh.log.infof("Task %s was stopped by a scale in.", taskId(aws.StringValue(task.TaskArn)))
+					knownStopped[aws.StringValue(task.TaskArn)] = true
+					continue
+				}
+				return fmt.Errorf("task %s stopped. Reason: %s", aws.StringValue(task.TaskArn), aws.StringValue(task.StoppedReason))
+			}
+			sh.log.debugf("Service is still good, running: %d, desired: %d.", running, desired)
+		case <-sh.ctx.Done():
+			return sh.ctx.Err()
+		case <-soakTimer.C:
+			return nil
+		}
+	}
+}
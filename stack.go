@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// stackHandler waits for a CloudFormation stack operation to finish, printing the stack events as they happen.
+type stackHandler struct {
+	ctx           context.Context
+	session       *cloudformation.CloudFormation
+	stackName     *string
+	checkInterval int
+	checkTimeout  int
+	seenEvents    map[string]bool
+}
+
+func newStackHandler(ctx context.Context, awsSession *session.Session, stackName string, checkInterval, checkTimeout int) *stackHandler {
+	return &stackHandler{
+		ctx:           ctx,
+		session:       cloudformation.New(awsSession),
+		stackName:     aws.String(stackName),
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+		seenEvents:    map[string]bool{},
+	}
+}
+
+func (sth *stackHandler) describeStack() (*cloudformation.Stack, error) {
+	output, err := sth.session.DescribeStacksWithContext(sth.ctx, &cloudformation.DescribeStacksInput{StackName: sth.stackName})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Stacks) == 0 {
+		return nil, fmt.Errorf("stack %s not found", aws.StringValue(sth.stackName))
+	}
+	return output.Stacks[0], nil
+}
+
+// printNewEvents prints the stack events since the operation started that have not been printed yet, oldest first.
+func (sth *stackHandler) printNewEvents(since time.Time) error {
+	events := []*cloudformation.StackEvent{}
+	err := sth.session.DescribeStackEventsPagesWithContext(sth.ctx, &cloudformation.DescribeStackEventsInput{StackName: sth.stackName},
+		func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+			for _, event := range page.StackEvents {
+				// Events are newest first, stop at the ones from before the operation.
+				if aws.TimeValue(event.Timestamp).Before(since) {
+					return false
+				}
+				events = append(events, event)
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if sth.seenEvents[aws.StringValue(event.EventId)] {
+			continue
+		}
+		sth.seenEvents[aws.StringValue(event.EventId)] = true
+		fmt.Printf("%s %s %s %s %s\n",
+			aws.TimeValue(event.Timestamp).Format(time.RFC3339),
+			aws.StringValue(event.LogicalResourceId),
+			aws.StringValue(event.ResourceType),
+			aws.StringValue(event.ResourceStatus),
+			aws.StringValue(event.ResourceStatusReason),
+		)
+	}
+	return nil
+}
+
+// stackFinished works out if the stack status is final. Rollbacks and failures are errors
+// as soon as they start, there is no need to wait for the rollback to finish.
+func stackFinished(status string) (bool, error) {
+	switch {
+	case strings.Contains(status, "ROLLBACK"), strings.HasSuffix(status, "_FAILED"), status == cloudformation.StackStatusDeleteComplete:
+		return true, fmt.Errorf("stack is %s", status)
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return false, nil
+	}
+	return true, nil
+}
+
+// waitForStack waits for the current stack operation to finish.
+func (sth *stackHandler) waitForStack() error {
+	checkTimer := time.NewTicker(time.Second * time.Duration(sth.checkInterval))
+	timeout := time.NewTicker(time.Minute * time.Duration(sth.checkTimeout))
+	defer checkTimer.Stop()
+	defer timeout.Stop()
+
+	for {
+		stack, err := sth.describeStack()
+		if err != nil {
+			return err
+		}
+		since := aws.TimeValue(stack.CreationTime)
+		if stack.LastUpdatedTime != nil {
+			since = aws.TimeValue(stack.LastUpdatedTime)
+		}
+		if err := sth.printNewEvents(since); err != nil {
+			return err
+		}
+
+		status := aws.StringValue(stack.StackStatus)
+		finished, err := stackFinished(status)
+		if err != nil {
+			return fmt.Errorf("%s. Reason: %s", err, aws.StringValue(stack.StackStatusReason))
+		}
+		if finished {
+			logger.infof("Stack %s is %s.", aws.StringValue(sth.stackName), status)
+			return nil
+		}
+		logger.debugf("Waiting another %d seconds for stack %s, currently %s.", sth.checkInterval, aws.StringValue(sth.stackName), status)
+
+		select {
+		case <-checkTimer.C:
+		case <-sth.ctx.Done():
+			return sth.ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for stack %s, it is still %s", aws.StringValue(sth.stackName), status)
+		}
+	}
+}
+
+// runWaitStack is the "wait stack" subcommand.
+func runWaitStack(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("wait stack", flag.ExitOnError)
+	stackName := flags.String("stack", "", "CloudFormation stack to wait for")
+	checkInterval := flags.Int("check", 10, "Seconds between checks")
+	timeout := flags.Int("timeout", 30, "Timeout in minutes")
+	debugAws := flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID")
+	region := flags.String("region", "", regionUsage)
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+
+	if *stackName == "" {
+		logger.errorf("-stack is required.")
+		os.Exit(1)
+	}
+	awsSession, err := newAwsSession(*region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *debugAws {
+		debugAwsRequests(awsSession)
+	}
+
+	stack := newStackHandler(ctx, awsSession, *stackName, *checkInterval, *timeout)
+	logger.infof("Waiting for stack %s.", *stackName)
+	if err := stack.waitForStack(); err != nil {
+		logger.errorf("The stack did not complete. Error: %s", err)
+		os.Exit(1)
+	}
+	logger.infof("Stack looks good.")
+}
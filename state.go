@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// The goroutine running the wait owns its serviceHandler. It is the only one that changes the state
+// of the wait and it takes the write lock when it does, so it can read the state without locking.
+// Everything else, like the server, reads the state through view. Service descriptions are never
+// changed once they are stored, so a view shares them instead of copying.
+
+// handlerView is a consistent copy of the state of a wait.
+type handlerView struct {
+	service          *ecs.Service
+	deploymentId     string
+	phase            string
+	phaseStarted     time.Time
+	phases           []phaseTiming
+	checks           int
+	unhealthyTargets int
+	targetsInGrace   int
+	seenEvents       int
+	anomalies        []string
+}
+
+// view returns a copy of the state of the wait that is safe to use from any goroutine.
+func (sh *serviceHandler) view() handlerView {
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	return handlerView{
+		service:          sh.currentOutput,
+		deploymentId:     sh.trackedDeployment,
+		phase:            sh.currentPhase,
+		phaseStarted:     sh.phaseStarted,
+		phases:           append([]phaseTiming{}, sh.phaseTimings...),
+		checks:           sh.checks,
+		unhealthyTargets: sh.unhealthyTargets,
+		targetsInGrace:   sh.targetsInGrace,
+		seenEvents:       len(sh.seenEvents),
+		anomalies:        sh.anomalyFindings(),
+	}
+}
+
+// update changes the state of the wait while holding the write lock. Only the goroutine running
+// the wait calls it, and change must not call AWS or view.
+func (sh *serviceHandler) update(change func()) {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	change()
+}
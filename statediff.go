@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// serviceSnapshot is the part of the service state that a deployment changes.
+type serviceSnapshot struct {
+	desiredCount    int64
+	taskDefinition  string
+	platformVersion string
+	// previousTaskDefinition is what the ACTIVE deployment that is being replaced runs.
+	previousTaskDefinition string
+	deployments            map[string]string
+}
+
+func snapshotService(service *ecs.Service) serviceSnapshot {
+	snapshot := serviceSnapshot{
+		desiredCount:    aws.Int64Value(service.DesiredCount),
+		taskDefinition:  aws.StringValue(service.TaskDefinition),
+		platformVersion: aws.StringValue(service.PlatformVersion),
+		deployments:     map[string]string{},
+	}
+	for _, deployment := range service.Deployments {
+		if aws.StringValue(deployment.Status) == "ACTIVE" && snapshot.previousTaskDefinition == "" {
+			snapshot.previousTaskDefinition = aws.StringValue(deployment.TaskDefinition)
+		}
+		snapshot.deployments[aws.StringValue(deployment.Id)] = fmt.Sprintf("%s %s, task definition %s, running %d of %d",
+			aws.StringValue(deployment.Status),
+			aws.StringValue(deployment.RolloutState),
+			aws.StringValue(deployment.TaskDefinition),
+			aws.Int64Value(deployment.RunningCount),
+			aws.Int64Value(deployment.DesiredCount),
+		)
+	}
+	return snapshot
+}
+
+// diffSnapshots describes every difference between the two snapshots, one per line.
+func diffSnapshots(before, after serviceSnapshot) []string {
+	changes := []string{}
+	if before.desiredCount != after.desiredCount {
+		changes = append(changes, fmt.Sprintf("desired count: %d -> %d", before.desiredCount, after.desiredCount))
+	}
+	if before.taskDefinition != after.taskDefinition {
+		changes = append(changes, fmt.Sprintf("task definition: %s -> %s", before.taskDefinition, after.taskDefinition))
+	}
+	if before.platformVersion != after.platformVersion {
+		changes = append(changes, fmt.Sprintf("platform version: %s -> %s", before.platformVersion, after.platformVersion))
+	}
+
+	for _, deployment := range sortedKeys(before.deployments) {
+		state, ok := after.deployments[deployment]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("deployment %s: %s -> gone", deployment, before.deployments[deployment]))
+		case state != before.deployments[deployment]:
+			changes = append(changes, fmt.Sprintf("deployment %s: %s -> %s", deployment, before.deployments[deployment], state))
+		}
+	}
+	for _, deployment := range sortedKeys(after.deployments) {
+		if _, ok := before.deployments[deployment]; !ok {
+			changes = append(changes, fmt.Sprintf("deployment %s: new -> %s", deployment, after.deployments[deployment]))
+		}
+	}
+	return changes
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// captureInitialState remembers the service state to compare with at the end of the wait.
+func (sh *serviceHandler) captureInitialState() {
+	snapshot := snapshotService(sh.currentOutput)
+	sh.initialState = &snapshot
+}
+
+// printStateDiff prints what changed in the service since the wait started. With -V the changes
+// in the task definition of the deployment are printed too.
+func (sh *serviceHandler) printStateDiff() {
+	if sh.initialState == nil {
+		return
+	}
+	changes := diffSnapshots(*sh.initialState, snapshotService(sh.currentOutput))
+	if len(changes) == 0 {
+		fmt.Println("The service did not change while it was watched.")
+	} else {
+		fmt.Printf("Changes to the service while it was watched:\n  %s\n", strings.Join(changes, "\n  "))
+	}
+
+	// The service is normally updated before the wait starts, so compare with what the old deployment ran.
+	before, after := sh.initialState.previousTaskDefinition, aws.StringValue(sh.currentOutput.TaskDefinition)
+	if before == "" {
+		before = sh.initialState.taskDefinition
+	}
+	if !sh.log.verbose() || before == after {
+		return
+	}
+	if err := sh.printTaskDefinitionDiff(before, after); err != nil {
+		sh.log.errorf("There was an error comparing the task definitions. Error: %s", err)
+	}
+}
+
+// printTaskDefinitionDiff prints the differences between two task definitions.
+func (sh *serviceHandler) printTaskDefinitionDiff(before, after string) error {
+	beforeTd, err := sh.describeTaskDefinition(before)
+	if err != nil {
+		return err
+	}
+	afterTd, err := sh.describeTaskDefinition(after)
+	if err != nil {
+		return err
+	}
+	changes, err := sh.diffTaskDefinitions(beforeTd, afterTd)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Printf("Task definitions %s and %s are the same.\n", before, after)
+		return nil
+	}
+	fmt.Printf("Differences from %s to %s:\n  %s\n", before, after, strings.Join(changes, "\n  "))
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// waitState is the progress of a wait that is kept in the -state-file. If the wait is
+// interrupted, say by a CI runner restarting, running again with the same state file
+// carries on watching the same deployment rather than whatever is PRIMARY now.
+type waitState struct {
+	path string
+
+	Cluster      string    `json:"cluster"`
+	Service      string    `json:"service"`
+	DeploymentId string    `json:"deployment_id"`
+	Phase        string    `json:"phase"`
+	Attempt      int       `json:"attempt"`
+	Started      time.Time `json:"started"`
+}
+
+// loadWaitState reads the state file. A new state is returned when the file does not exist
+// or it is for a different service.
+func loadWaitState(path, cluster, service string) (*waitState, error) {
+	fresh := &waitState{path: path, Cluster: cluster, Service: service, Attempt: 1, Started: time.Now()}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &waitState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s. Error: %s", path, err)
+	}
+	if state.Cluster != cluster || state.Service != service {
+		logger.warnf("state file %s is for service %s in cluster %s, starting again.", path, state.Service, state.Cluster)
+		return fresh, nil
+	}
+	state.path = path
+	if state.Attempt < 1 {
+		state.Attempt = 1
+	}
+	return state, nil
+}
+
+// save writes the state to a temporary file first so an interrupted write can't leave a broken state file.
+func (ws *waitState) save() error {
+	content, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ws.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ws.path)
+}
+
+// remove deletes the state file once the wait has a final result.
+func (ws *waitState) remove() {
+	if err := os.Remove(ws.path); err != nil && !os.IsNotExist(err) {
+		logger.errorf("There was an error removing the state file. Error: %s", err)
+	}
+}
+
+// setWaitState sets the state that progress is recorded in.
+func (sh *serviceHandler) setWaitState(state *waitState) {
+	sh.waitState = state
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// describeTargetGroup looks up a single target group by ARN.
+func (sh *serviceHandler) describeTargetGroup(arn string) (*elbv2.TargetGroup, error) {
+	output, err := sh.elbv2Session.DescribeTargetGroupsWithContext(sh.ctx, &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: []*string{aws.String(arn)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.TargetGroups) == 0 {
+		return nil, fmt.Errorf("target group %s not found", arn)
+	}
+	return output.TargetGroups[0], nil
+}
+
+// printHealthCheckReport prints the health check configuration of the service target groups
+// along with any common mistakes found in it. It is used to diagnose targets that stay unhealthy.
+func (sh *serviceHandler) printHealthCheckReport() error {
+	if len(sh.currentOutput.LoadBalancers) == 0 {
+		return nil
+	}
+
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+
+	for _, lb := range sh.currentOutput.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+		tg, err := sh.describeTargetGroup(aws.StringValue(lb.TargetGroupArn))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Health check for target group %s:\n", aws.StringValue(tg.TargetGroupName))
+		fmt.Printf("  Protocol: %s, Port: %s, Path: %s\n", aws.StringValue(tg.HealthCheckProtocol), aws.StringValue(tg.HealthCheckPort), aws.StringValue(tg.HealthCheckPath))
+		fmt.Printf("  Interval: %ds, Timeout: %ds, Healthy threshold: %d, Unhealthy threshold: %d\n",
+			aws.Int64Value(tg.HealthCheckIntervalSeconds),
+			aws.Int64Value(tg.HealthCheckTimeoutSeconds),
+			aws.Int64Value(tg.HealthyThresholdCount),
+			aws.Int64Value(tg.UnhealthyThresholdCount),
+		)
+		if tg.Matcher != nil {
+			fmt.Printf("  Success codes: %s%s\n", aws.StringValue(tg.Matcher.HttpCode), aws.StringValue(tg.Matcher.GrpcCode))
+		}
+
+		for _, finding := range healthCheckFindings(tg, lb, td, sh.currentOutput) {
+			fmt.Printf("  WARNING: %s\n", finding)
+		}
+	}
+
+	return nil
+}
+
+// healthCheckFindings looks for the health check misconfigurations that we commonly see.
+func healthCheckFindings(tg *elbv2.TargetGroup, lb *ecs.LoadBalancer, td *ecs.TaskDefinition, service *ecs.Service) []string {
+	findings := []string{}
+
+	if tg.HealthCheckEnabled != nil && !aws.BoolValue(tg.HealthCheckEnabled) {
+		findings = append(findings, "health checks are disabled on the target group")
+	}
+
+	containerPorts := map[int64]bool{}
+	container := containerDefinition(td, aws.StringValue(lb.ContainerName))
+	if container == nil {
+		findings = append(findings, fmt.Sprintf("container %s is not in task definition %s", aws.StringValue(lb.ContainerName), aws.StringValue(td.TaskDefinitionArn)))
+	} else {
+		for _, mapping := range container.PortMappings {
+			containerPorts[aws.Int64Value(mapping.ContainerPort)] = true
+		}
+		if !containerPorts[aws.Int64Value(lb.ContainerPort)] {
+			findings = append(findings, fmt.Sprintf("container %s does not map port %d that the load balancer sends traffic to", aws.StringValue(lb.ContainerName), aws.Int64Value(lb.ContainerPort)))
+		}
+	}
+
+	hcPort := aws.StringValue(tg.HealthCheckPort)
+	if hcPort != "" && hcPort != "traffic-port" {
+		port, err := strconv.ParseInt(hcPort, 10, 64)
+		switch {
+		case err != nil:
+			findings = append(findings, fmt.Sprintf("health check port %q is not a valid port", hcPort))
+		case aws.StringValue(tg.TargetType) == elbv2.TargetTypeEnumInstance:
+			findings = append(findings, fmt.Sprintf("health check port is fixed to %d on an instance target group, dynamic host ports will not be checked. Consider using traffic-port", port))
+		case container != nil && !containerPorts[port]:
+			findings = append(findings, fmt.Sprintf("health check port %d is not mapped by container %s", port, aws.StringValue(lb.ContainerName)))
+		}
+	}
+
+	timeToHealthy := aws.Int64Value(tg.HealthCheckIntervalSeconds) * aws.Int64Value(tg.HealthyThresholdCount)
+	if aws.Int64Value(service.HealthCheckGracePeriodSeconds) == 0 {
+		findings = append(findings, fmt.Sprintf("the service has no health check grace period, new tasks need at least %ds to pass health checks and may be replaced while starting", timeToHealthy))
+	}
+	if timeToHealthy > 300 {
+		findings = append(findings, fmt.Sprintf("targets need %ds of passing health checks to become healthy", timeToHealthy))
+	}
+
+	return findings
+}
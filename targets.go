@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// explicitFlags are the flags given on the command line.
+func explicitFlags() map[string]bool {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// configTarget finds the target of the config for the -cluster and -service of the command line.
+func (c *config) configTarget(cluster, service string) (targetConfig, bool) {
+	for _, target := range c.Targets {
+		if target.Service == service && (cluster == "" || target.Cluster == cluster) {
+			return target, true
+		}
+	}
+	return targetConfig{}, false
+}
+
+// applyConfigFlags sets the flags of the config and then of the target, skipping the ones given on
+// the command line.
+func applyConfigFlags(cfg *config, target targetConfig, explicit map[string]bool) error {
+	values := map[string]interface{}{}
+	for name, value := range cfg.Flags {
+		values[name] = value
+	}
+	for name, value := range target.Flags {
+		values[name] = value
+	}
+	for name, value := range values {
+		switch name {
+		case "config", "service", "cluster":
+			return fmt.Errorf("-%s can't be set in the flags of the config", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q in the config", name)
+		}
+		if err := flag.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("bad value for %s in the config. Error: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// applyConfig applies the flags and targets of the -config. It returns the runs to do at the same
+// time when the config has several targets and none was picked with -service.
+func applyConfig(path string) ([]serviceRun, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	explicit := explicitFlags()
+	target := targetConfig{}
+	if explicit["service"] {
+		target, _ = cfg.configTarget(*flagClusterName, *flagServiceName)
+	} else if len(cfg.Targets) > 1 {
+		runs := []serviceRun{}
+		for _, target := range cfg.Targets {
+			runs = append(runs, serviceRun{cluster: target.Cluster, service: target.Service})
+		}
+		return runs, nil
+	} else if len(cfg.Targets) == 1 {
+		target = cfg.Targets[0]
+		*flagServiceName = target.Service
+		if !explicit["cluster"] {
+			*flagClusterName = target.Cluster
+		}
+	}
+	return nil, applyConfigFlags(cfg, target, explicit)
+}
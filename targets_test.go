@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestApplyConfigFlags(t *testing.T) {
+	tests := map[string]struct {
+		configFlags map[string]interface{}
+		targetFlags map[string]interface{}
+		explicit    map[string]bool
+		expected    map[string]string
+		err         bool
+	}{
+		"config flags": {
+			configFlags: map[string]interface{}{"timeout": 20, "check-listeners": true},
+			expected:    map[string]string{"timeout": "20", "check-listeners": "true"},
+		},
+		"target wins over the config": {
+			configFlags: map[string]interface{}{"timeout": 20, "check": 5},
+			targetFlags: map[string]interface{}{"timeout": 30},
+			expected:    map[string]string{"timeout": "30", "check": "5"},
+		},
+		"command line wins over the config": {
+			configFlags: map[string]interface{}{"timeout": 20, "check": 5},
+			explicit:    map[string]bool{"timeout": true},
+			expected:    map[string]string{"timeout": "10", "check": "5"},
+		},
+		"command line wins over the target": {
+			targetFlags: map[string]interface{}{"timeout": 30},
+			explicit:    map[string]bool{"timeout": true},
+			expected:    map[string]string{"timeout": "10"},
+		},
+		"unknown flag": {
+			configFlags: map[string]interface{}{"timout": 20},
+			err:         true,
+		},
+		"unknown target flag": {
+			targetFlags: map[string]interface{}{"chek": 5},
+			err:         true,
+		},
+		"service can't be set": {
+			targetFlags: map[string]interface{}{"service": "web"},
+			err:         true,
+		},
+		"bad value": {
+			configFlags: map[string]interface{}{"timeout": "soon"},
+			err:         true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The flags are global, put back what the test changes.
+			for _, name := range []string{"timeout", "check", "check-listeners"} {
+				original := flag.Lookup(name).Value.String()
+				defer flag.Set(name, original)
+			}
+			flag.Set("timeout", "10")
+
+			cfg := &config{Flags: test.configFlags}
+			err := applyConfigFlags(cfg, targetConfig{Flags: test.targetFlags}, test.explicit)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range test.expected {
+				if got := flag.Lookup(name).Value.String(); got != expected {
+					t.Errorf("expected -%s %s, got %s", name, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const (
+	// taskDefinitionVisibilityTimeout is how long a newly registered task definition gets to show up.
+	taskDefinitionVisibilityTimeout = 2 * time.Minute
+	taskDefinitionVisibilityCheck   = 5 * time.Second
+)
+
+// taskDefinition returns the task definition that the service is currently configured with.
+func (sh *serviceHandler) taskDefinition() (*ecs.TaskDefinition, error) {
+	return sh.describeTaskDefinition(aws.StringValue(sh.currentOutput.TaskDefinition))
+}
+
+// describeTaskDefinition returns the task definition with the ARN.
+// The result is cached as task definition revisions are immutable.
+func (sh *serviceHandler) describeTaskDefinition(arn string) (*ecs.TaskDefinition, error) {
+	sh.cacheLock.Lock()
+	td, ok := sh.taskDefinitionCache[arn]
+	sh.cacheLock.Unlock()
+	if ok {
+		return td, nil
+	}
+
+	output, err := sh.session.DescribeTaskDefinitionWithContext(sh.ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(arn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sh.cacheLock.Lock()
+	defer sh.cacheLock.Unlock()
+	if sh.taskDefinitionCache == nil {
+		sh.taskDefinitionCache = map[string]*ecs.TaskDefinition{}
+	}
+	sh.taskDefinitionCache[arn] = output.TaskDefinition
+	return output.TaskDefinition, nil
+}
+
+// containerDefinition finds a container in the task definition by name.
+func containerDefinition(td *ecs.TaskDefinition, name string) *ecs.ContainerDefinition {
+	for _, container := range td.ContainerDefinitions {
+		if aws.StringValue(container.Name) == name {
+			return container
+		}
+	}
+	return nil
+}
+
+// waitForTaskDefinition waits for a task definition to be visible and ACTIVE. Right after
+// RegisterTaskDefinition it can take a moment before DescribeTaskDefinition finds the new revision.
+func (sh *serviceHandler) waitForTaskDefinition(taskDefinition string) error {
+	deadline := time.Now().Add(taskDefinitionVisibilityTimeout)
+	for {
+		output, err := sh.session.DescribeTaskDefinitionWithContext(sh.ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(taskDefinition),
+		})
+		if err == nil {
+			status := aws.StringValue(output.TaskDefinition.Status)
+			if status != ecs.TaskDefinitionStatusActive {
+				return fmt.Errorf("task definition %s is %s", taskDefinition, status)
+			}
+			sh.log.infof("Task definition %s is ACTIVE.", aws.StringValue(output.TaskDefinition.TaskDefinitionArn))
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("task definition %s is still not visible after %s. Error: %s", taskDefinition, taskDefinitionVisibilityTimeout, err)
+		}
+		sh.log.debugf("Task definition %s is not visible yet. Error: %s", taskDefinition, err)
+		if err := sleepContext(sh.ctx, taskDefinitionVisibilityCheck); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+const (
+	// taskProtectionBatchSize is the maximum number of tasks UpdateTaskProtection accepts in one call.
+	taskProtectionBatchSize = 10
+	// maxTaskProtection is the longest ECS allows a task to be protected for.
+	maxTaskProtection = 48 * time.Hour
+	// taskProtectionMargin is added to the protection so it doesn't run out while the checks finish.
+	taskProtectionMargin = 10 * time.Minute
+)
+
+// protectDeploymentTasks turns on scale-in protection for the RUNNING tasks of the PRIMARY deployment
+// so that the tasks we are checking can't be stopped by scale in or another deployment. The protection
+// runs out after the period in case we don't get to release it. The protected tasks are returned.
+func (sh *serviceHandler) protectDeploymentTasks(period time.Duration) ([]*string, error) {
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return nil, fmt.Errorf("no PRIMARY deployment found")
+	}
+	tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	arns := []*string{}
+	for _, task := range tasks {
+		arns = append(arns, task.TaskArn)
+	}
+
+	period += taskProtectionMargin
+	if period > maxTaskProtection {
+		period = maxTaskProtection
+	}
+	if err := sh.setTaskProtection(sh.ctx, arns, true, period); err != nil {
+		return nil, err
+	}
+	sh.log.infof("Protected %d tasks for up to %s.", len(arns), period)
+	return arns, nil
+}
+
+// releaseTaskProtection turns the protection of the protected tasks off again, once the on
+// success command has run too. The wait may have been interrupted, so it does not use its context.
+func (sh *serviceHandler) releaseTaskProtection() {
+	arns := sh.protectedTasks
+	if len(arns) == 0 {
+		return
+	}
+	sh.protectedTasks = nil
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := sh.setTaskProtection(ctx, arns, false, 0); err != nil {
+		sh.log.errorf("There was an error releasing the task protection. Error: %s", err)
+		return
+	}
+	sh.log.infof("Released the protection of %d tasks.", len(arns))
+}
+
+func (sh *serviceHandler) setTaskProtection(ctx context.Context, arns []*string, enabled bool, period time.Duration) error {
+	for start := 0; start < len(arns); start += taskProtectionBatchSize {
+		end := start + taskProtectionBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		input := &ecs.UpdateTaskProtectionInput{
+			Cluster:           sh.clusterName,
+			Tasks:             arns[start:end],
+			ProtectionEnabled: aws.Bool(enabled),
+		}
+		if enabled {
+			input.ExpiresInMinutes = aws.Int64(int64(math.Ceil(period.Minutes())))
+		}
+		output, err := sh.session.UpdateTaskProtectionWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		if len(output.Failures) > 0 {
+			failures := []string{}
+			for _, failure := range output.Failures {
+				failures = append(failures, fmt.Sprintf("%s: %s", taskId(aws.StringValue(failure.Arn)), aws.StringValue(failure.Reason)))
+			}
+			return fmt.Errorf("task protection failed for %s", strings.Join(failures, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// requiredPermission is an IAM action that the task role must be allowed to perform on a resource.
+type requiredPermission struct {
+	action   string
+	resource string
+}
+
+// parseRequiredPermissions reads a comma separated list of action=resource pairs.
+// The resource is optional and defaults to every resource.
+func parseRequiredPermissions(value string) ([]requiredPermission, error) {
+	permissions := []requiredPermission{}
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		permission := requiredPermission{action: parts[0], resource: "*"}
+		if len(parts) == 2 && parts[1] != "" {
+			permission.resource = parts[1]
+		}
+		if !strings.Contains(permission.action, ":") {
+			return nil, fmt.Errorf("%q is not an IAM action like s3:GetObject", permission.action)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// checkTaskRolePermissions uses IAM policy simulation to make sure the task role grants the
+// required permissions. Missing permissions only show up as runtime errors in the application
+// after the deployment has been declared a success.
+func (sh *serviceHandler) checkTaskRolePermissions(required []requiredPermission) error {
+	td, err := sh.taskDefinition()
+	if err != nil {
+		return err
+	}
+
+	taskRole := aws.StringValue(td.TaskRoleArn)
+	if taskRole == "" {
+		return fmt.Errorf("task definition %s has no task role", aws.StringValue(td.TaskDefinitionArn))
+	}
+
+	denied := []string{}
+	for _, permission := range required {
+		allowed, err := sh.simulatePrincipalPolicy(taskRole, []string{permission.action}, permission.resource)
+		if err != nil {
+			return err
+		}
+		if len(allowed) == 0 {
+			denied = append(denied, fmt.Sprintf("%s on %s", permission.action, permission.resource))
+			continue
+		}
+		sh.log.debugf("Task role is allowed %s on %s.", permission.action, permission.resource)
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("task role %s is not allowed:\n  %s", taskRole, strings.Join(denied, "\n  "))
+	}
+	return nil
+}
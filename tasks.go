@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// describeTasksBatchSize is the maximum number of tasks DescribeTasks accepts in one call.
+const describeTasksBatchSize = 100
+
+// deploymentTasks returns the tasks of the service with the desired status that were started
+// by the deployment. ECS sets startedBy to the deployment ID for tasks that it starts for a service.
+func (sh *serviceHandler) deploymentTasks(deploymentId, desiredStatus string) ([]*ecs.Task, error) {
+	tasks, err := sh.serviceTasks(desiredStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	deploymentTasks := []*ecs.Task{}
+	for _, task := range tasks {
+		if aws.StringValue(task.StartedBy) == deploymentId {
+			deploymentTasks = append(deploymentTasks, task)
+		}
+	}
+	return deploymentTasks, nil
+}
+
+// serviceTasks returns every task of the service with the desired status.
+func (sh *serviceHandler) serviceTasks(desiredStatus string) ([]*ecs.Task, error) {
+	arns := []*string{}
+	err := sh.session.ListTasksPagesWithContext(sh.ctx,
+		&ecs.ListTasksInput{
+			Cluster:       sh.clusterName,
+			ServiceName:   sh.serviceName,
+			DesiredStatus: aws.String(desiredStatus),
+		},
+		func(page *ecs.ListTasksOutput, lastPage bool) bool {
+			arns = append(arns, page.TaskArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return sh.describeTasks(arns)
+}
+
+// describeTasks describes the tasks in batches that the API accepts.
+func (sh *serviceHandler) describeTasks(arns []*string) ([]*ecs.Task, error) {
+	tasks := []*ecs.Task{}
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := start + describeTasksBatchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := sh.session.DescribeTasksWithContext(sh.ctx, &ecs.DescribeTasksInput{
+			Cluster: sh.clusterName,
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, output.Tasks...)
+	}
+	return tasks, nil
+}
+
+// taskEndpoint is where a task can be reached on the network.
+type taskEndpoint struct {
+	taskArn   string
+	eniId     string
+	privateIp string
+	publicIp  string
+}
+
+// taskEndpoints resolves the network interface and addresses of each task.
+// Public IPs are not part of the task description so they are looked up on the ENIs.
+func (sh *serviceHandler) taskEndpoints(tasks []*ecs.Task) ([]taskEndpoint, error) {
+	endpoints := []taskEndpoint{}
+	eniIds := []*string{}
+
+	for _, task := range tasks {
+		endpoint := taskEndpoint{taskArn: aws.StringValue(task.TaskArn)}
+		for _, attachment := range task.Attachments {
+			if aws.StringValue(attachment.Type) != "ElasticNetworkInterface" {
+				continue
+			}
+			for _, detail := range attachment.Details {
+				switch aws.StringValue(detail.Name) {
+				case "networkInterfaceId":
+					endpoint.eniId = aws.StringValue(detail.Value)
+				case "privateIPv4Address":
+					endpoint.privateIp = aws.StringValue(detail.Value)
+				}
+			}
+		}
+		if endpoint.eniId != "" {
+			eniIds = append(eniIds, aws.String(endpoint.eniId))
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if len(eniIds) == 0 {
+		return endpoints, nil
+	}
+
+	output, err := sh.ec2Session.DescribeNetworkInterfacesWithContext(sh.ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: eniIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	publicIps := map[string]string{}
+	for _, eni := range output.NetworkInterfaces {
+		if eni.Association != nil {
+			publicIps[aws.StringValue(eni.NetworkInterfaceId)] = aws.StringValue(eni.Association.PublicIp)
+		}
+	}
+	for i := range endpoints {
+		endpoints[i].publicIp = publicIps[endpoints[i].eniId]
+	}
+
+	return endpoints, nil
+}
+
+// printTaskEndpoints prints the ENI and addresses of the RUNNING tasks in the PRIMARY deployment.
+func (sh *serviceHandler) printTaskEndpoints() error {
+	deployment := sh.primaryDeployment()
+	if deployment == nil {
+		return fmt.Errorf("no PRIMARY deployment found")
+	}
+
+	tasks, err := sh.deploymentTasks(aws.StringValue(deployment.Id), ecs.DesiredStatusRunning)
+	if err != nil {
+		return err
+	}
+	endpoints, err := sh.taskEndpoints(tasks)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Tasks running for deployment %s:\n", aws.StringValue(deployment.Id))
+	for _, endpoint := range endpoints {
+		publicIp := endpoint.publicIp
+		if publicIp == "" {
+			publicIp = "none"
+		}
+		fmt.Printf("  %s ENI: %s, Private IP: %s, Public IP: %s\n", endpoint.taskArn, endpoint.eniId, endpoint.privateIp, publicIp)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// throttlingPatterns match the service events ECS writes when it backs off launching tasks.
+// ECS throttles services whose tasks keep failing to start, and the running count then sits
+// still for up to 15 minutes between launch attempts, which looks like a stall.
+var throttlingPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`is unable to consistently start tasks successfully`),
+	regexp.MustCompile(`(?i)operations are being throttled`),
+	regexp.MustCompile(`(?i)rate exceeded`),
+}
+
+const throttlingDiagnosis = "ECS is throttling task launches for this service"
+
+// throttlingEvents returns the events after the given time that show ECS is throttling the service, newest first.
+func throttlingEvents(events []*ecs.ServiceEvent, since time.Time) []*ecs.ServiceEvent {
+	throttled := []*ecs.ServiceEvent{}
+	for _, event := range events {
+		if aws.TimeValue(event.CreatedAt).Before(since) {
+			continue
+		}
+		for _, pattern := range throttlingPatterns {
+			if pattern.MatchString(aws.StringValue(event.Message)) {
+				throttled = append(throttled, event)
+				break
+			}
+		}
+	}
+	return throttled
+}
+
+// deploymentThrottlingEvents returns the throttling events since the PRIMARY deployment started.
+func (sh *serviceHandler) deploymentThrottlingEvents() []*ecs.ServiceEvent {
+	since := time.Time{}
+	if deployment := sh.primaryDeployment(); deployment != nil {
+		since = aws.TimeValue(deployment.CreatedAt)
+	}
+	return throttlingEvents(sh.currentOutput.Events, since)
+}
+
+// reportThrottling prints the throttling diagnosis the first time it shows up while waiting.
+func (sh *serviceHandler) reportThrottling() {
+	if sh.throttlingReported {
+		return
+	}
+	throttled := sh.deploymentThrottlingEvents()
+	if len(throttled) == 0 {
+		return
+	}
+	sh.throttlingReported = true
+	sh.log.warnf("%s, new tasks will start slowly until the failures that caused it stop. Latest event: %s", throttlingDiagnosis, aws.StringValue(throttled[0].Message))
+}
+
+// printThrottlingDiagnosis prints the throttling events of the PRIMARY deployment, if there are any.
+func (sh *serviceHandler) printThrottlingDiagnosis() {
+	throttled := sh.deploymentThrottlingEvents()
+	if len(throttled) == 0 {
+		return
+	}
+	fmt.Printf("%s, it backs off after tasks repeatedly fail to start. Seen %d times, first at %s and last at %s.\n",
+		throttlingDiagnosis,
+		len(throttled),
+		aws.TimeValue(throttled[len(throttled)-1].CreatedAt).Format(time.RFC3339),
+		aws.TimeValue(throttled[0].CreatedAt).Format(time.RFC3339),
+	)
+	fmt.Println("Look at why the stopped tasks below failed, the throttling stops once tasks start successfully.")
+}
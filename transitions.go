@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// taskTransition is when a task of the watched deployment was created, started and became healthy.
+type taskTransition struct {
+	created     time.Time
+	started     time.Time
+	healthy     time.Time
+	seenHealthy bool
+}
+
+// transitionStats summarizes how long tasks took for one transition.
+type transitionStats struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	Max   time.Duration `json:"max"`
+}
+
+// setTrackTransitions turns the sampling of the task transitions on, for the reports and the
+// history that show them. Without them the tasks are not described for it.
+func (sh *serviceHandler) setTrackTransitions(track bool) {
+	sh.trackTransitions = track
+}
+
+// sampleTransitions samples the tasks of the watched deployment once more, at the end of the wait.
+func (sh *serviceHandler) sampleTransitions() {
+	deploymentId := sh.failingDeploymentId()
+	if !sh.trackTransitions || deploymentId == "" {
+		return
+	}
+	tasks, err := sh.deploymentTasks(deploymentId, ecs.DesiredStatusRunning)
+	if err != nil {
+		sh.log.debugf("There was an error sampling the task transitions. Error: %s", err)
+		return
+	}
+	sh.observeTransitions(tasks)
+}
+
+// observeTransitions takes in the RUNNING tasks of the watched deployment. ECS records when a task
+// was created and started, but not when its health checks passed, so that is the first check that
+// sees it HEALTHY. Tasks that are already HEALTHY when first seen are left out of that transition.
+func (sh *serviceHandler) observeTransitions(tasks []*ecs.Task) {
+	if sh.transitions == nil {
+		sh.transitions = map[string]*taskTransition{}
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		healthy := aws.StringValue(task.HealthStatus) == ecs.HealthStatusHealthy
+		transition, ok := sh.transitions[aws.StringValue(task.TaskArn)]
+		if !ok {
+			transition = &taskTransition{created: aws.TimeValue(task.CreatedAt), seenHealthy: healthy}
+			sh.transitions[aws.StringValue(task.TaskArn)] = transition
+		}
+		if task.StartedAt != nil {
+			transition.started = aws.TimeValue(task.StartedAt)
+		}
+		if healthy && !transition.seenHealthy && transition.healthy.IsZero() {
+			transition.healthy = now
+		}
+	}
+}
+
+// transitionSummary returns the percentiles of the pending to running and running to healthy durations.
+func (sh *serviceHandler) transitionSummary() []transitionStats {
+	pendingToRunning := []time.Duration{}
+	runningToHealthy := []time.Duration{}
+	for _, transition := range sh.transitions {
+		if transition.started.IsZero() {
+			continue
+		}
+		pendingToRunning = append(pendingToRunning, transition.started.Sub(transition.created))
+		if !transition.healthy.IsZero() {
+			runningToHealthy = append(runningToHealthy, transition.healthy.Sub(transition.started))
+		}
+	}
+
+	summary := []transitionStats{}
+	for _, durations := range []struct {
+		name   string
+		values []time.Duration
+	}{
+		{"pending to running", pendingToRunning},
+		{"running to healthy", runningToHealthy},
+	} {
+		if len(durations.values) == 0 {
+			continue
+		}
+		sort.Slice(durations.values, func(i, j int) bool { return durations.values[i] < durations.values[j] })
+		summary = append(summary, transitionStats{
+			Name:  durations.name,
+			Count: len(durations.values),
+			P50:   percentile(durations.values, 50),
+			P90:   percentile(durations.values, 90),
+			Max:   durations.values[len(durations.values)-1],
+		})
+	}
+	return summary
+}
+
+// percentile returns the percentile of sorted durations, interpolating between the two closest
+// ranks. Few tasks are started per deployment, so the nearest rank would jump around. It returns 0
+// when there are no durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	position := math.Max(0, math.Min(100, p)) / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	fraction := position - float64(lower)
+	return sorted[lower] + time.Duration(fraction*float64(sorted[upper]-sorted[lower]))
+}
+
+// printTransitionSummary prints the task transition percentiles.
+func (sh *serviceHandler) printTransitionSummary() {
+	for _, stats := range sh.transitionSummary() {
+		fmt.Printf("Tasks took p50 %s, p90 %s and max %s from %s, over %d tasks.\n",
+			stats.P50.Round(time.Second), stats.P90.Round(time.Second), stats.Max.Round(time.Second), stats.Name, stats.Count)
+	}
+}
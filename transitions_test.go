@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := map[string]struct {
+		sorted   []time.Duration
+		p        float64
+		expected time.Duration
+	}{
+		"empty": {
+			sorted:   nil,
+			p:        50,
+			expected: 0,
+		},
+		"single": {
+			sorted:   []time.Duration{7 * time.Second},
+			p:        90,
+			expected: 7 * time.Second,
+		},
+		"median of an odd count": {
+			sorted:   []time.Duration{1 * time.Second, 2 * time.Second, 9 * time.Second},
+			p:        50,
+			expected: 2 * time.Second,
+		},
+		"median of an even count is interpolated": {
+			sorted:   []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 9 * time.Second},
+			p:        50,
+			expected: 3 * time.Second,
+		},
+		"p90 is interpolated": {
+			sorted:   []time.Duration{10 * time.Second, 20 * time.Second},
+			p:        90,
+			expected: 19 * time.Second,
+		},
+		"p0 is the minimum": {
+			sorted:   []time.Duration{3 * time.Second, 5 * time.Second, 8 * time.Second},
+			p:        0,
+			expected: 3 * time.Second,
+		},
+		"p100 is the maximum": {
+			sorted:   []time.Duration{3 * time.Second, 5 * time.Second, 8 * time.Second},
+			p:        100,
+			expected: 8 * time.Second,
+		},
+		"out of range is clamped": {
+			sorted:   []time.Duration{3 * time.Second, 5 * time.Second},
+			p:        150,
+			expected: 5 * time.Second,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := percentile(test.sorted, test.p); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
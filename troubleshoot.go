@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Levels of trouble shooting information.
+const (
+	troubleshootOff   = "off"
+	troubleshootBasic = "basic"
+	troubleshootFull  = "full"
+)
+
+// printTroubleshooting prints what is known about the state of the service to explain why the
+// deployment did not work. basic is limited to the events and the stopped tasks, full also
+// describes the tasks that are still running, the container logs and the health check.
+func (sh *serviceHandler) printTroubleshooting(level string, events, tasks int) {
+	if level == troubleshootOff {
+		return
+	}
+	full := level == troubleshootFull
+
+	fmt.Printf("Here is some trouble shooting information for %s.\n", aws.StringValue(sh.serviceName))
+	if *flagEventsSince {
+		fmt.Printf("Events since the deployment started, newest first, showing maximum %d:\n", events)
+	} else {
+		fmt.Printf("Historical events, newest first, showing maximum %d:\n", events)
+	}
+	if err := sh.printLastNEvents(events, *flagEventsSince); err != nil {
+		sh.log.errorf("There was an error listing the events. Error: %s", err)
+	}
+	sh.printPlacementDiagnosis()
+	sh.printThrottlingDiagnosis()
+	if full {
+		fmt.Println("RUNNING and PENDING tasks of the deployment:")
+		if err := sh.printDeploymentTasks(); err != nil {
+			sh.log.errorf("There was an error listing the RUNNING tasks. Error: %s", err)
+		}
+	}
+	fmt.Printf("STOPPED tasks, showing maximum %d:\n", tasks)
+	if err := sh.printLastNTasks(tasks, full); err != nil {
+		sh.log.errorf("There was an error listing the STOPPED tasks. Error: %s", err)
+	}
+	if err := sh.printEfsMountFailures(); err != nil {
+		sh.log.errorf("There was an error looking for EFS mount failures. Error: %s", err)
+	}
+	if full && len(sh.currentOutput.LoadBalancers) > 0 {
+		fmt.Println("Target group health check configuration:")
+		if err := sh.printHealthCheckReport(); err != nil {
+			sh.log.errorf("There was an error describing the health check configuration. Error: %s", err)
+		}
+	}
+}
+
+// failingDeploymentId returns the tracked deployment, falling back to the PRIMARY deployment.
+func (sh *serviceHandler) failingDeploymentId() string {
+	if sh.trackedDeployment != "" {
+		return sh.trackedDeployment
+	}
+	if deployment := sh.primaryDeployment(); deployment != nil {
+		return aws.StringValue(deployment.Id)
+	}
+	return ""
+}
+
+// printDeploymentTasks prints the RUNNING and PENDING tasks of the failing deployment with the
+// state of their containers, to show what is still starting and why it is not healthy yet.
+func (sh *serviceHandler) printDeploymentTasks() error {
+	deploymentId := sh.failingDeploymentId()
+	if deploymentId == "" {
+		return fmt.Errorf("no deployment found")
+	}
+	tasks, err := sh.deploymentTasks(deploymentId, ecs.DesiredStatusRunning)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		fmt.Printf("Deployment %s has no RUNNING or PENDING tasks.\n", deploymentId)
+		return nil
+	}
+
+	for _, task := range tasks {
+		fmt.Printf("  %s last status: %s, health: %s", taskId(aws.StringValue(task.TaskArn)), aws.StringValue(task.LastStatus), colorState(aws.StringValue(task.HealthStatus)))
+		if task.StartedAt != nil {
+			fmt.Printf(", started at %s", aws.TimeValue(task.StartedAt).Local().Format(eventTimeFormat))
+		}
+		fmt.Println()
+		for _, container := range task.Containers {
+			fmt.Printf("    %s last status: %s, health: %s", aws.StringValue(container.Name), aws.StringValue(container.LastStatus), colorState(aws.StringValue(container.HealthStatus)))
+			if container.ExitCode != nil {
+				fmt.Printf(", exit code: %d", aws.Int64Value(container.ExitCode))
+			}
+			if container.Reason != nil {
+				fmt.Printf(", reason: %s", aws.StringValue(container.Reason))
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// printStoppedTaskTable prints one line per stopped task with why it stopped and the exit code of
+// each container.
+func printStoppedTaskTable(tasks []*ecs.Task) {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return aws.TimeValue(t).Local().Format(eventTimeFormat)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "TASK\tREVISION\tSTOP CODE\tSTOPPED REASON\tEXIT CODES\tSTARTED\tSTOPPED")
+	for _, task := range tasks {
+		exitCodes := []string{}
+		for _, container := range task.Containers {
+			exitCode := "-"
+			if container.ExitCode != nil {
+				exitCode = fmt.Sprint(aws.Int64Value(container.ExitCode))
+			}
+			exitCodes = append(exitCodes, fmt.Sprintf("%s=%s", aws.StringValue(container.Name), exitCode))
+		}
+		taskDefinitionArn := aws.StringValue(task.TaskDefinitionArn)
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			taskId(aws.StringValue(task.TaskArn)),
+			taskDefinitionArn[strings.LastIndex(taskDefinitionArn, ":")+1:],
+			aws.StringValue(task.StopCode),
+			aws.StringValue(task.StoppedReason),
+			strings.Join(exitCodes, ","),
+			formatTime(task.StartedAt),
+			formatTime(task.StoppedAt),
+		)
+	}
+	table.Flush()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/wafv2"
+)
+
+// serviceLoadBalancerArns returns the load balancers that the service target groups are attached to.
+func (sh *serviceHandler) serviceLoadBalancerArns() ([]string, error) {
+	arns := []string{}
+	seen := map[string]bool{}
+	for _, lb := range sh.currentOutput.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+		tg, err := sh.describeTargetGroup(aws.StringValue(lb.TargetGroupArn))
+		if err != nil {
+			return nil, err
+		}
+		for _, lbArn := range tg.LoadBalancerArns {
+			if !seen[aws.StringValue(lbArn)] {
+				seen[aws.StringValue(lbArn)] = true
+				arns = append(arns, aws.StringValue(lbArn))
+			}
+		}
+	}
+	return arns, nil
+}
+
+// checkWebAcl makes sure every load balancer in front of the service is still associated with the
+// web ACL. The web ACL can be given by ARN or by name. Infrastructure changes that go out with a
+// deploy have been known to drop the association without anyone noticing.
+func (sh *serviceHandler) checkWebAcl(expected string) error {
+	lbArns, err := sh.serviceLoadBalancerArns()
+	if err != nil {
+		return err
+	}
+	if len(lbArns) == 0 {
+		return fmt.Errorf("the service has no load balancer to check the web ACL of")
+	}
+
+	wafSession := wafv2.New(sh.awsSession)
+	for _, lbArn := range lbArns {
+		output, err := wafSession.GetWebACLForResourceWithContext(sh.ctx, &wafv2.GetWebACLForResourceInput{ResourceArn: aws.String(lbArn)})
+		if err != nil {
+			return err
+		}
+		if output.WebACL == nil {
+			return fmt.Errorf("load balancer %s has no web ACL, expected %s", lbArn, expected)
+		}
+		if aws.StringValue(output.WebACL.ARN) != expected && aws.StringValue(output.WebACL.Name) != expected {
+			return fmt.Errorf("load balancer %s is associated with web ACL %s, expected %s", lbArn, aws.StringValue(output.WebACL.ARN), expected)
+		}
+		sh.log.debugf("Load balancer %s is associated with web ACL %s.", lbArn, aws.StringValue(output.WebACL.ARN))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morfien101/are-we-there-yet/pkg/ecswait"
+)
+
+// clearScreen moves the cursor home and clears the terminal so the table is redrawn in place.
+const clearScreen = "\033[H\033[2J"
+
+// watchClusterEventLength is how much of the last event of a service fits in the table.
+const watchClusterEventLength = 80
+
+// rolloutSummary describes where the rollout of a service is up to.
+func rolloutSummary(service *ecs.Service) string {
+	if ecswait.Stable(service) {
+		return "STEADY"
+	}
+	deployment := ecswait.PrimaryDeployment(service)
+	if deployment == nil {
+		return "UNKNOWN"
+	}
+	state := aws.StringValue(deployment.RolloutState)
+	if state == "" {
+		state = ecs.DeploymentRolloutStateInProgress
+	}
+	if len(service.Deployments) > 1 {
+		return fmt.Sprintf("%s (%d deployments)", state, len(service.Deployments))
+	}
+	return state
+}
+
+// lastEvent returns the newest event of the service, cut to fit the table, and how long ago it was.
+func lastEvent(service *ecs.Service, now time.Time) string {
+	if len(service.Events) == 0 {
+		return ""
+	}
+	event := service.Events[0]
+	message := aws.StringValue(event.Message)
+	if len(message) > watchClusterEventLength {
+		message = message[:watchClusterEventLength-3] + "..."
+	}
+	return fmt.Sprintf("%s ago: %s", now.Sub(aws.TimeValue(event.CreatedAt)).Round(time.Second), message)
+}
+
+// printClusterTable writes one row for every service with its rollout and task counts.
+func printClusterTable(out io.Writer, cluster string, services []*ecs.Service, now time.Time) {
+	sort.Slice(services, func(i, j int) bool {
+		return aws.StringValue(services[i].ServiceName) < aws.StringValue(services[j].ServiceName)
+	})
+	fmt.Fprintf(out, "Cluster %s, %d services at %s.\n\n", cluster, len(services), now.Format(eventTimeFormat))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SERVICE\t%s\tRUNNING\tDESIRED\tPENDING\tLAST EVENT\n", colorCell("ROLLOUT", ""))
+	for _, service := range services {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n",
+			aws.StringValue(service.ServiceName),
+			colorStateCell(rolloutSummary(service)),
+			aws.Int64Value(service.RunningCount),
+			aws.Int64Value(service.DesiredCount),
+			aws.Int64Value(service.PendingCount),
+			lastEvent(service, now),
+		)
+	}
+	w.Flush()
+}
+
+// runWatchCluster is the watch-cluster subcommand. It redraws a table of every service in the
+// cluster and where its rollout is up to until it is interrupted.
+func runWatchCluster(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("watch-cluster", flag.ExitOnError)
+	cluster := flags.String("cluster", "", "Cluster to watch")
+	interval := flags.Int("interval", *flagCheckInterval, "Seconds between refreshes")
+	once := flags.Bool("once", false, "Print the table once and exit instead of refreshing it")
+	debugAws := flags.Bool("debug-aws", false, "Print every AWS API call with how long it took, its retries and request ID")
+	flags.Usage = func() {
+		fmt.Println("Usage: are-we-there-yet watch-cluster -cluster production")
+		flags.PrintDefaults()
+	}
+	region := flags.String("region", "", regionUsage)
+	logFlags := addLogFlags(flags)
+	flags.Parse(args)
+	setupLogging(logFlags, false)
+	if *cluster == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	awsSession, err := newAwsSession(*region)
+	if err != nil {
+		logger.errorf("There was an error starting the AWS Session. Error: %s", err)
+		os.Exit(1)
+	}
+	if *debugAws {
+		debugAwsRequests(awsSession)
+	}
+	client := ecs.New(awsSession)
+
+	for {
+		services, err := clusterServices(ctx, client, aws.String(*cluster))
+		if err != nil {
+			logger.errorf("There was an error describing the services of %s. Error: %s", *cluster, err)
+			os.Exit(1)
+		}
+		if *once {
+			printClusterTable(os.Stdout, *cluster, services, time.Now())
+			return
+		}
+		fmt.Print(clearScreen)
+		printClusterTable(os.Stdout, *cluster, services, time.Now())
+		if sleepContext(ctx, time.Second*time.Duration(*interval)) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// ruleTrafficShare returns the percentage of the traffic matched by the rule that it forwards to the
+// target group. Rules that forward without weights send all of it to their only target group.
+func ruleTrafficShare(rule *elbv2.Rule, targetGroupArn string) (float64, bool) {
+	for _, action := range rule.Actions {
+		if aws.StringValue(action.Type) != elbv2.ActionTypeEnumForward {
+			continue
+		}
+		if action.ForwardConfig == nil || len(action.ForwardConfig.TargetGroups) == 0 {
+			if aws.StringValue(action.TargetGroupArn) == targetGroupArn {
+				return 100, true
+			}
+			continue
+		}
+		total := int64(0)
+		weight := int64(-1)
+		for _, tg := range action.ForwardConfig.TargetGroups {
+			total += aws.Int64Value(tg.Weight)
+			if aws.StringValue(tg.TargetGroupArn) == targetGroupArn {
+				weight = aws.Int64Value(tg.Weight)
+			}
+		}
+		if weight < 0 {
+			continue
+		}
+		if total == 0 {
+			return 0, true
+		}
+		return 100 * float64(weight) / float64(total), true
+	}
+	return 0, false
+}
+
+// targetGroupHealthCounts returns how many targets of the target group are healthy out of all of them.
+func (sh *serviceHandler) targetGroupHealthCounts(targetGroupArn string) (int, int, error) {
+	output, err := sh.elbv2Session.DescribeTargetHealthWithContext(sh.ctx, &elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	healthy := 0
+	for _, target := range output.TargetHealthDescriptions {
+		if aws.StringValue(target.TargetHealth.State) == elbv2.TargetHealthStateEnumHealthy {
+			healthy++
+		}
+	}
+	return healthy, len(output.TargetHealthDescriptions), nil
+}
+
+// printTargetGroupWeights prints the health of each target group of the service and the share of
+// traffic that every listener rule forwarding to it gives it.
+func (sh *serviceHandler) printTargetGroupWeights() error {
+	for _, lb := range sh.currentOutput.LoadBalancers {
+		targetGroupArn := aws.StringValue(lb.TargetGroupArn)
+		if targetGroupArn == "" {
+			continue
+		}
+		healthy, total, err := sh.targetGroupHealthCounts(targetGroupArn)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Target group %s has %d of %d targets healthy.\n", targetGroupArn, healthy, total)
+
+		listeners, err := sh.listenerRulesForTargetGroup(targetGroupArn)
+		if err != nil {
+			return err
+		}
+		for _, listener := range listeners {
+			for _, rule := range listener.rules {
+				if share, ok := ruleTrafficShare(rule.rule, targetGroupArn); ok {
+					fmt.Printf("  Rule %s forwards %.0f%% of its traffic to it.\n", aws.StringValue(rule.rule.RuleArn), share)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// waitForTrafficShare waits until every listener rule that forwards to the target group gives it at
+// least the share of the traffic, for weighted blue/green deployments where something else
+// moves the weights.
+func (sh *serviceHandler) waitForTrafficShare(targetGroupArn string, share float64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var progress progressLine
+	for {
+		listeners, err := sh.listenerRulesForTargetGroup(targetGroupArn)
+		if err != nil {
+			return err
+		}
+		lowest := -1.0
+		for _, listener := range listeners {
+			for _, rule := range listener.rules {
+				if ruleShare, ok := ruleTrafficShare(rule.rule, targetGroupArn); ok && (lowest < 0 || ruleShare < lowest) {
+					lowest = ruleShare
+				}
+			}
+		}
+		if lowest < 0 {
+			return fmt.Errorf("no listener rule forwards to target group %s", targetGroupArn)
+		}
+		if lowest >= share {
+			sh.log.infof("Target group %s gets %.0f%% of the traffic.", targetGroupArn, lowest)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for target group %s to get %.0f%% of the traffic, it gets %.0f%%", targetGroupArn, share, lowest)
+		}
+		progress.logf(sh.log, fmt.Sprint(lowest), "Target group %s gets %.0f%% of the traffic, waiting another %d seconds for %.0f%%.", targetGroupArn, lowest, sh.checkInterval, share)
+		if err := sleepContext(sh.ctx, time.Second*time.Duration(sh.checkInterval)); err != nil {
+			return err
+		}
+	}
+}